@@ -73,7 +73,8 @@ export const secrets = {
       },
       mainValkey: {
         AdminPassword: new sst.Secret('MainMainValkeyAdminPassword'),
-        ClientPassword: new sst.Secret('MainMainValkeyClientPassword')
+        ClientPassword: new sst.Secret('MainMainValkeyClientPassword'),
+        ReconcilerPassword: new sst.Secret('MainMainValkeyReconcilerPassword')
       },
       mainClickhouse: {
         AdminPassword: new sst.Secret('MainMainClickhouseAdminPassword'),
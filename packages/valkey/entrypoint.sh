@@ -11,9 +11,37 @@ for v in \
   eval ": \${$v:?Missing $v}"
 done
 
+# the chart passes these. the defaults keep the image working on its own
+export CLIENT_PORT="${CLIENT_PORT:-6379}"
+export BUS_PORT="${BUS_PORT:-16379}"
+export CLUSTER_DOMAIN="${CLUSTER_DOMAIN:-cluster.local}"
+
 envsubst < /tmp/conf_templates/valkey.conf > /etc/valkey/valkey.conf
 envsubst < /tmp/conf_templates/users.acl > /etc/valkey/users.acl
 
+# secrets made before the reconciler user existed don't have its password. leave the user out instead of
+# giving it an empty one
+if [ -z "${RECONCILER_PASSWORD:-}" ]; then
+  echo "RECONCILER_PASSWORD not set. Leaving the reconciler user out of users.acl" >&2
+  sed -i '/^user reconciler /d' /etc/valkey/users.acl
+fi
+
+if [ "${TLS_ENABLED:-false}" = "true" ]; then
+  # the client port only takes tls connections. the cluster bus and replication use tls too
+  cat >> /etc/valkey/valkey.conf << EOF
+
+port 0
+tls-port ${CLIENT_PORT}
+cluster-announce-tls-port ${CLIENT_PORT}
+tls-cluster yes
+tls-replication yes
+tls-cert-file /tls/tls.crt
+tls-key-file /tls/tls.key
+tls-ca-cert-file /tls/ca.crt
+tls-auth-clients no
+EOF
+fi
+
 if [ -n "${PERSISTENCE:-}" ]; then
   echo "dir /data" >> /etc/valkey/valkey.conf
 
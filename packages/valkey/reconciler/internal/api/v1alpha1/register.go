@@ -0,0 +1,29 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "valkey.pandoks.com"
+	Version = "v1alpha1"
+	Kind    = "ValkeyCluster"
+	// plural name used in the api path (kubectl get valkeyclusters)
+	Resource = "valkeyclusters"
+)
+
+var (
+	SchemeGroupVersion   = schema.GroupVersion{Group: Group, Version: Version}
+	GroupVersionResource = SchemeGroupVersion.WithResource(Resource)
+
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	AddToScheme   = SchemeBuilder.AddToScheme
+)
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion, &ValkeyCluster{}, &ValkeyClusterList{})
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
@@ -0,0 +1,61 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type OperationResult string
+
+const (
+	OperationSucceeded OperationResult = "Succeeded"
+	OperationFailed    OperationResult = "Failed"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ValkeyCluster is the desired shape of a valkey cluster along with what the reconciler last observed
+type ValkeyCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ValkeyClusterSpec   `json:"spec,omitempty"`
+	Status ValkeyClusterStatus `json:"status,omitempty"`
+}
+
+type ValkeyClusterSpec struct {
+	Masters           int `json:"masters"`
+	ReplicasPerMaster int `json:"replicasPerMaster"`
+}
+
+type ValkeyClusterStatus struct {
+	// generation of the spec that the status was last computed against
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	Masters       int `json:"masters"`
+	Replicas      int `json:"replicas"`
+	Nodes         int `json:"nodes"`
+	SlotsAssigned int `json:"slotsAssigned"` // out of 16384
+
+	Healthy       bool   `json:"healthy"`
+	HealthMessage string `json:"healthMessage,omitempty"` // why the cluster is unhealthy
+
+	LastOperation *Operation `json:"lastOperation,omitempty"`
+}
+
+// Operation is a single run of a reconciler subcommand (init, scale-up, scale-down, controller pass)
+type Operation struct {
+	Name           string          `json:"name"`
+	Result         OperationResult `json:"result"`
+	Message        string          `json:"message,omitempty"`
+	StartTime      metav1.Time     `json:"startTime"`
+	CompletionTime metav1.Time     `json:"completionTime"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type ValkeyClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ValkeyCluster `json:"items"`
+}
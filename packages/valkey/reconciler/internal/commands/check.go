@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+type CheckReport struct {
+	Cluster   string           `json:"cluster"`
+	Namespace string           `json:"namespace"`
+	OK        bool             `json:"ok"`
+	Problems  []valkey.Problem `json:"problems"`
+}
+
+func (r CheckReport) Print(w io.Writer) {
+	if r.OK {
+		fmt.Fprintf(w, "Cluster %s/%s: all checks passed\n", r.Namespace, r.Cluster)
+		return
+	}
+	fmt.Fprintf(w, "Cluster %s/%s: %d problems\n", r.Namespace, r.Cluster, len(r.Problems))
+	for _, problem := range r.Problems {
+		fmt.Fprintf(w, "  %s\n", problem)
+	}
+}
+
+// Check reads CLUSTER NODES from every pod and prints every problem it finds. it returns an error when
+// there is at least one so the command exits non-zero
+func Check(ctx context.Context, env utils.Env, output OutputFormat) error {
+	if err := output.Validate(); err != nil {
+		return err
+	}
+
+	// pods that aren't ready are asked too so they show up as unreachable instead of being left out
+	pods, err := utils.DiscoverPods(ctx, env)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("no pods found for cluster %s", env.ClusterName)
+	}
+	addresses := make([]string, len(pods))
+	for i, pod := range pods {
+		addresses[i] = pod.Address
+	}
+
+	views, problems := valkey.GetClusterNodeViews(addresses, env)
+	problems = append(problems, valkey.CheckCluster(views)...)
+	problems = append(problems, valkey.CheckPodIPs(views, pods)...)
+	report := CheckReport{
+		Cluster:   env.ClusterName,
+		Namespace: env.Namespace,
+		OK:        len(problems) == 0,
+		Problems:  problems,
+	}
+	if report.Problems == nil {
+		report.Problems = []valkey.Problem{}
+	}
+
+	if output == OutputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		report.Print(os.Stdout)
+	}
+
+	if !report.OK {
+		return fmt.Errorf("cluster check found %d problems", len(report.Problems))
+	}
+	return nil
+}
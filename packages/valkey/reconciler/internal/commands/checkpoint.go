@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// checkpointer records which phase of a scale operation is running so an interrupted run can be picked
+// up by the next one. failing to read or write the checkpoint never fails the operation, it only means
+// a restarted run can't tell it is resuming. finding a checkpoint left by another operation or for
+// another shape does fail it.
+type checkpointer struct {
+	clientset  kubernetes.Interface
+	env        utils.Env
+	checkpoint utils.Checkpoint
+	resumed    *utils.Checkpoint // left behind by an interrupted run
+}
+
+func startCheckpoint(ctx context.Context, env utils.Env, operation string) (*checkpointer, error) {
+	now := time.Now()
+	c := &checkpointer{
+		env: env,
+		checkpoint: utils.Checkpoint{
+			Operation:         operation,
+			Masters:           env.Masters,
+			ReplicasPerMaster: env.ReplicasPerMaster,
+			StartTime:         now,
+			UpdateTime:        now,
+		},
+	}
+
+	logger := logging.FromContext(ctx)
+	clientset, err := utils.NewKubernetesClient()
+	if err != nil {
+		logger.Warn("Checkpoints disabled", "error", err)
+		return c, nil
+	}
+	c.clientset = clientset
+
+	resumed, err := utils.LoadCheckpoint(ctx, clientset, env)
+	if err != nil {
+		logger.Warn("Failed to load checkpoint", "error", err)
+		return c, nil
+	}
+	if resumed != nil {
+		if err := checkResumable(*resumed, operation, env); err != nil {
+			return nil, err
+		}
+		c.resumed = resumed
+		c.checkpoint.StartTime = resumed.StartTime
+		logger.Info("Resuming interrupted operation",
+			"resumed_operation", resumed.Operation,
+			"step", resumed.Phase,
+			"detail", resumed.Step,
+			"started", resumed.StartTime.Format(time.RFC3339),
+		)
+	}
+	return c, nil
+}
+
+// only the operation that was interrupted, towards the same shape, may pick it up. anything else would
+// relax the health checks for a change it didn't make and clear the checkpoint when it finishes
+func checkResumable(resumed utils.Checkpoint, operation string, env utils.Env) error {
+	if resumed.Operation == operation && resumed.Masters == env.Masters && resumed.ReplicasPerMaster == env.ReplicasPerMaster {
+		return nil
+	}
+	return fmt.Errorf(
+		"%s to %d masters and %d replicas per master was interrupted during %s. run it again with that shape to finish it, "+
+			"or once the cluster is healthy clear it with `kubectl -n %s delete configmap %s`",
+		resumed.Operation, resumed.Masters, resumed.ReplicasPerMaster, resumed.Phase,
+		env.Namespace, utils.GetCheckpointConfigMapName(env),
+	)
+}
+
+func (c *checkpointer) resuming() bool {
+	return c.resumed != nil
+}
+
+// a fresh run needs a healthy cluster. an interrupted run leaves missing pod indices or uneven replicas
+// behind so only the nodes themselves are checked when resuming.
+func (c *checkpointer) checkTopology(clusterTopology valkey.Topology) error {
+	if c.resuming() {
+		return clusterTopology.CheckNodes()
+	}
+	_, err := clusterTopology.IsHealthy()
+	return err
+}
+
+// the phase that is running. used to label failures
+func (c *checkpointer) step() string {
+	if c.checkpoint.Phase == "" {
+		return "prepare"
+	}
+	return c.checkpoint.Phase
+}
+
+func (c *checkpointer) phase(ctx context.Context, phase, step string) {
+	logger := logging.FromContext(ctx)
+	if phase != c.checkpoint.Phase {
+		logger.Info("Starting step", "step", phase)
+	}
+	if step != "" {
+		logger.Debug("Working on", "step", phase, "detail", step)
+	}
+
+	c.checkpoint.Phase, c.checkpoint.Step, c.checkpoint.UpdateTime = phase, step, time.Now()
+	if c.clientset == nil {
+		return
+	}
+	if err := utils.SaveCheckpoint(ctx, c.clientset, c.env, c.checkpoint); err != nil {
+		logger.Warn("Failed to save checkpoint", "step", phase, "error", err)
+	}
+}
+
+func (c *checkpointer) done(ctx context.Context) {
+	if c.clientset == nil {
+		return
+	}
+	if err := utils.ClearCheckpoint(ctx, c.clientset, c.env); err != nil {
+		logging.FromContext(ctx).Warn("Failed to clear checkpoint", "error", err)
+	}
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+	"valkey/reconciler/internal/utils"
+)
+
+func TestCheckResumable(t *testing.T) {
+	resumed := utils.Checkpoint{Operation: "scale-down", Phase: "remove-shards", Masters: 2, ReplicasPerMaster: 1}
+
+	tests := []struct {
+		name      string
+		operation string
+		env       utils.Env
+		wantErr   bool
+	}{
+		{name: "same operation and shape", operation: "scale-down", env: testEnv(2, 1)},
+		{name: "another operation", operation: "scale-up", env: testEnv(2, 1), wantErr: true},
+		{name: "other masters", operation: "scale-down", env: testEnv(3, 1), wantErr: true},
+		{name: "other replicas per master", operation: "scale-down", env: testEnv(2, 2), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkResumable(resumed, test.operation, test.env)
+			if !test.wantErr {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			// the operator has to be told how to get rid of the checkpoint
+			if err == nil || !strings.Contains(err.Error(), "delete configmap "+utils.GetCheckpointConfigMapName(testEnv(2, 1))) {
+				t.Errorf("checkResumable() = %v, want an error naming the checkpoint configmap", err)
+			}
+		})
+	}
+}
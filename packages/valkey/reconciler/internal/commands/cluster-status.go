@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+type NodeReport struct {
+	ID          string   `json:"id"`
+	Address     string   `json:"address"`
+	Hostname    string   `json:"hostname"`
+	Role        string   `json:"role"`
+	Flags       []string `json:"flags"`
+	LinkState   string   `json:"linkState"`
+	ConfigEpoch uint64   `json:"configEpoch"`
+	Slots       []string `json:"slots,omitempty"`     // ranges like 0-5460
+	SlotCount   int      `json:"slotCount,omitempty"` // masters only
+	Importing   []string `json:"importing,omitempty"` // slot<-node id
+	Migrating   []string `json:"migrating,omitempty"` // slot->node id
+}
+
+type ShardReport struct {
+	Index    int          `json:"index"` // lowest pod index in the shard
+	Master   NodeReport   `json:"master"`
+	Replicas []NodeReport `json:"replicas"`
+}
+
+type StatusReport struct {
+	Cluster       string        `json:"cluster"`
+	Namespace     string        `json:"namespace"`
+	Healthy       bool          `json:"healthy"`
+	Reason        string        `json:"reason,omitempty"` // why the cluster is unhealthy
+	Current       ClusterShape  `json:"current"`
+	Desired       *ClusterShape `json:"desired,omitempty"`
+	AssignedSlots int           `json:"assignedSlots"`
+	Shards        []ShardReport `json:"shards"`
+}
+
+// BuildStatusReport summarizes the topology shard by shard in pod index order. env.Masters is 0 when
+// the desired shape is unknown
+func BuildStatusReport(clusterTopology valkey.Topology, env utils.Env) StatusReport {
+	report := StatusReport{
+		Cluster:       env.ClusterName,
+		Namespace:     env.Namespace,
+		Healthy:       true,
+		Current:       topologyShape(clusterTopology),
+		AssignedSlots: clusterTopology.AssignedSlots(),
+		Shards:        make([]ShardReport, 0, len(clusterTopology.OrderedShards)),
+	}
+	if healthy, err := clusterTopology.IsHealthy(); !healthy {
+		report.Healthy, report.Reason = false, err.Error()
+	}
+	if env.Masters > 0 {
+		desired := desiredShape(env)
+		report.Desired = &desired
+	}
+
+	for _, shard := range clusterTopology.OrderedShards {
+		masterNode, exists := clusterTopology.Masters[shard.MasterId]
+		if !exists {
+			continue
+		}
+		shardReport := ShardReport{
+			Index:    shard.Index,
+			Master:   nodeReport(masterNode.Node),
+			Replicas: make([]NodeReport, 0, len(masterNode.SlaveIds)),
+		}
+		for _, node := range clusterTopology.OrderedNodes {
+			if node.Master == masterNode.Node.ID {
+				shardReport.Replicas = append(shardReport.Replicas, nodeReport(node))
+			}
+		}
+		report.Shards = append(report.Shards, shardReport)
+	}
+	return report
+}
+
+func nodeReport(node valkey.ClusterNode) NodeReport {
+	report := NodeReport{
+		ID:          node.ID,
+		Address:     node.Address(),
+		Hostname:    node.Hostname,
+		Role:        "master",
+		Flags:       make([]string, 0, len(node.Flags)),
+		LinkState:   string(node.LinkState),
+		ConfigEpoch: node.ConfigEp,
+	}
+	if node.Master != "" {
+		report.Role = "replica"
+	}
+	for _, flag := range node.Flags {
+		report.Flags = append(report.Flags, string(flag))
+	}
+	for _, slotRange := range node.Slots {
+		report.SlotCount += int(slotRange.EndSlot) - int(slotRange.StartSlot) + 1
+		report.Slots = append(report.Slots, slotRange.String())
+	}
+	for _, importing := range node.Importing {
+		report.Importing = append(report.Importing, fmt.Sprintf("%d<-%s", importing.Slot, importing.ImportingNodeID))
+	}
+	for _, migrating := range node.Migrating {
+		report.Migrating = append(report.Migrating, fmt.Sprintf("%d->%s", migrating.Slot, migrating.MigratingNodeID))
+	}
+	return report
+}
+
+func (r StatusReport) Print(w io.Writer) {
+	health := "healthy"
+	if !r.Healthy {
+		health = "unhealthy: " + r.Reason
+	}
+	fmt.Fprintf(w, "Cluster %s/%s is %s\n", r.Namespace, r.Cluster, health)
+	fmt.Fprintf(w, "  Current: %d masters, %d replicas per master, %d nodes\n", r.Current.Masters, r.Current.ReplicasPerMaster, r.Current.Nodes)
+	if r.Desired != nil {
+		fmt.Fprintf(w, "  Desired: %d masters, %d replicas per master, %d nodes\n", r.Desired.Masters, r.Desired.ReplicasPerMaster, r.Desired.Nodes)
+	}
+	fmt.Fprintf(w, "  Slots assigned: %d/%d\n", r.AssignedSlots, valkey.TotalSlots)
+	fmt.Fprintln(w)
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SHARD\tROLE\tID\tADDRESS\tFLAGS\tLINK\tEPOCH\tSLOTS\tOPEN SLOTS")
+	printRow := func(shardIndex int, node NodeReport) {
+		slots := "-"
+		if node.Role == "master" {
+			slots = fmt.Sprintf("%d [%s]", node.SlotCount, strings.Join(node.Slots, " "))
+		}
+		openSlots := append(append([]string{}, node.Importing...), node.Migrating...)
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			shardIndex,
+			node.Role,
+			node.ID,
+			node.Address,
+			strings.Join(node.Flags, ","),
+			node.LinkState,
+			node.ConfigEpoch,
+			slots,
+			orDash(strings.Join(openSlots, " ")),
+		)
+	}
+	for _, shard := range r.Shards {
+		printRow(shard.Index, shard.Master)
+		for _, replica := range shard.Replicas {
+			printRow(shard.Index, replica)
+		}
+	}
+	table.Flush()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Status prints the live cluster's health and shards without changing anything
+func Status(ctx context.Context, env utils.Env, output OutputFormat) error {
+	if err := output.Validate(); err != nil {
+		return err
+	}
+
+	clusterTopology, err := liveClusterTopology(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	report := BuildStatusReport(clusterTopology, env)
+	if output == OutputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	report.Print(os.Stdout)
+	return nil
+}
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"valkey/reconciler/internal/valkey"
+)
+
+func TestBuildStatusReport(t *testing.T) {
+	env := testEnv(2, 1)
+
+	tests := []struct {
+		name         string
+		nodes        func() []valkey.ClusterNode
+		wantHealthy  bool
+		wantShards   int
+		wantReplicas []string // replica ids per shard, in order
+	}{
+		{
+			name:         "healthy",
+			nodes:        func() []valkey.ClusterNode { return planNodes(2, 1) },
+			wantHealthy:  true,
+			wantShards:   2,
+			wantReplicas: []string{"node2", "node3"},
+		},
+		{
+			name: "failed replica",
+			nodes: func() []valkey.ClusterNode {
+				nodes := planNodes(2, 1)
+				nodes[3].Flags = []valkey.Flag{valkey.Slave, valkey.Fail}
+				return nodes
+			},
+			wantHealthy:  false,
+			wantShards:   2,
+			wantReplicas: []string{"node2", "node3"},
+		},
+		{
+			name: "missing replica",
+			nodes: func() []valkey.ClusterNode {
+				return planNodes(2, 1)[:3]
+			},
+			wantHealthy:  false,
+			wantShards:   2,
+			wantReplicas: []string{"node2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusterTopology, err := valkey.ClusterTopology(test.nodes())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			report := BuildStatusReport(clusterTopology, env)
+			if report.Healthy != test.wantHealthy {
+				t.Errorf("healthy = %v, want %v (reason %q)", report.Healthy, test.wantHealthy, report.Reason)
+			}
+			if !report.Healthy && report.Reason == "" {
+				t.Error("expected a reason for an unhealthy cluster")
+			}
+			if len(report.Shards) != test.wantShards {
+				t.Fatalf("expected %d shards, got %d", test.wantShards, len(report.Shards))
+			}
+			var replicas []string
+			for _, shard := range report.Shards {
+				for _, replica := range shard.Replicas {
+					replicas = append(replicas, replica.ID)
+				}
+			}
+			if !slices.Equal(replicas, test.wantReplicas) {
+				t.Errorf("replicas = %v, want %v", replicas, test.wantReplicas)
+			}
+			if report.Desired == nil || *report.Desired != desiredShape(env) {
+				t.Errorf("unexpected desired shape %+v", report.Desired)
+			}
+		})
+	}
+}
+
+func TestNodeReport(t *testing.T) {
+	node := planNode(0, "", []valkey.SlotRange{{StartSlot: 0, EndSlot: 99}, {StartSlot: 200, EndSlot: 200}})
+	node.Flags = []valkey.Flag{valkey.Myself, valkey.Master}
+	node.ConfigEp = 3
+	node.Importing = []valkey.ImportingSlot{{Slot: 150, ImportingNodeID: "node1"}}
+	node.Migrating = []valkey.MigratingSlot{{Slot: 50, MigratingNodeID: "node1"}}
+
+	report := nodeReport(node)
+	if report.Role != "master" || report.ConfigEpoch != 3 || report.LinkState != "connected" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if want := []string{"0-99", "200"}; !slices.Equal(report.Slots, want) {
+		t.Errorf("slots = %v, want %v", report.Slots, want)
+	}
+	if report.SlotCount != 101 {
+		t.Errorf("slot count = %d, want 101", report.SlotCount)
+	}
+	if want := []string{"myself", "master"}; !slices.Equal(report.Flags, want) {
+		t.Errorf("flags = %v, want %v", report.Flags, want)
+	}
+	if !slices.Equal(report.Importing, []string{"150<-node1"}) || !slices.Equal(report.Migrating, []string{"50->node1"}) {
+		t.Errorf("unexpected open slots %v %v", report.Importing, report.Migrating)
+	}
+
+	if replica := nodeReport(planNode(2, "node0", nil)); replica.Role != "replica" {
+		t.Errorf("expected a replica, got %s", replica.Role)
+	}
+}
+
+func TestStatusReportPrint(t *testing.T) {
+	clusterTopology, err := valkey.ClusterTopology(planNodes(2, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	BuildStatusReport(clusterTopology, testEnv(2, 1)).Print(&buf)
+	output := buf.String()
+
+	for _, want := range []string{
+		"Cluster default/test is healthy",
+		"Slots assigned: 16384/16384",
+		"8192 [0-8191]",
+		"8192 [8192-16383]",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+	// header plus one row per node
+	if rows := strings.Count(output[strings.Index(output, "SHARD"):], "\n"); rows != 5 {
+		t.Errorf("expected 5 table rows, got %d:\n%s", rows, output)
+	}
+}
@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"valkey/reconciler/internal/api/v1alpha1"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/metrics"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// Controller runs until ctx is cancelled and keeps the cluster in the desired shape. It reconciles
+// whenever the statefulset changes (pods replaced, replica count edited outside of helm, etc.) and on
+// every resync interval so drift that doesn't touch the statefulset (ie. a failed node) is also caught.
+func Controller(ctx context.Context, env utils.Env) error {
+	logger := logging.FromContext(ctx)
+	attrs := []any{"spec_source", env.SpecSource, "resync_interval", env.ResyncInterval, "metrics_address", env.MetricsAddress}
+	if env.SpecSource == utils.SpecFromEnv {
+		attrs = append(attrs, "masters", env.Masters, "replicas_per_master", env.ReplicasPerMaster)
+	}
+	logger.Info("Starting Valkey cluster controller", attrs...)
+
+	go func() {
+		if err := metrics.Serve(ctx, env.MetricsAddress); err != nil {
+			logger.Error("Metrics server stopped", "error", err)
+		}
+	}()
+
+	clientset, err := utils.NewKubernetesClient()
+	if err != nil {
+		return err
+	}
+
+	dynamicClient, err := utils.NewDynamicClient()
+	if err != nil {
+		return err
+	}
+
+	changes := make(chan struct{}, 1)
+	go utils.WatchStatefulSet(ctx, clientset, env.Namespace, utils.GetStatefulsetName(env), changes)
+	if env.SpecSource == utils.SpecFromResource {
+		go utils.WatchValkeyCluster(ctx, dynamicClient, env.Namespace, env.ClusterName, changes)
+	}
+
+	ticker := time.NewTicker(env.ResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		passEnv := env
+		var err error
+		if env.SpecSource == utils.SpecFromResource {
+			passEnv, err = utils.ApplyValkeyClusterSpec(ctx, dynamicClient, env)
+		}
+		// rotate-credentials may have given the reconciler a new password since the controller started
+		if password, passwordErr := utils.CurrentPassword(ctx, clientset, passEnv); passwordErr != nil {
+			logger.Warn("Failed to read the reconciler password from the secret. Using the one from startup", "error", passwordErr)
+		} else if password != "" {
+			passEnv.Password = password
+		}
+
+		var operation *v1alpha1.Operation
+		if err == nil {
+			// a new recorder every pass so a recreated statefulset or resource still gets the events
+			recorder := NewEventRecorder(ctx, clientset, passEnv)
+			startTime := time.Now()
+			var reconciled bool
+			reconciled, err = reconcileDrift(events.WithRecorder(ctx, recorder), clientset, passEnv)
+			recorder.Shutdown(5 * time.Second)
+
+			// a hook or manual run is already on it. not a failure, just check again on the next pass
+			var lockHeldErr *utils.LockHeldError
+			if errors.As(err, &lockHeldErr) {
+				logger.Info("Skipping pass", "reason", err)
+				reconciled, err = false, nil
+			}
+			if reconciled || err != nil {
+				operation = NewOperation("controller", startTime, err)
+			}
+		}
+		if err != nil {
+			logger.Error("Reconcile failed, retrying on next change or resync", "error", err)
+		}
+
+		if err := RecordStatus(ctx, passEnv, operation); err != nil {
+			logger.Error("Failed to record status", "error", err)
+		}
+		// also catches failovers the cluster did on its own
+		if err := SyncPodLabels(ctx, clientset, passEnv); err != nil {
+			logger.Error("Failed to update pod role labels", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Controller stopped")
+			return nil
+		case <-ticker.C:
+		case <-changes:
+		}
+	}
+}
+
+// reconciled is true when the cluster had drifted and something was changed to fix it
+func reconcileDrift(ctx context.Context, clientset kubernetes.Interface, env utils.Env) (reconciled bool, err error) {
+	logger := logging.FromContext(ctx)
+	statefulSetName := utils.GetStatefulsetName(env)
+
+	statefulSetReplicas, err := utils.GetStatefulSetReplicas(ctx, clientset, env.Namespace, statefulSetName)
+	if err != nil {
+		return false, err
+	}
+
+	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(ctx, env)
+	if err != nil {
+		return false, err
+	}
+	if len(clusterClientHostnames) > 0 {
+		client, err := valkey.NewClient(valkey.ReconcilerAuth(env), clusterClientHostnames...)
+		if err != nil {
+			return false, err
+		}
+		clusterTopology, err := valkey.GetClusterTopology(client)
+		client.Close()
+		if err != nil {
+			return false, err
+		}
+
+		// pods that lost their data leave failed nodes behind that keep the cluster unhealthy forever
+		reasons := detectDrift(clusterTopology, statefulSetReplicas, env, podPlacements(ctx, env))
+		if len(reasons) == 0 && len(valkey.StaleNodes(clusterTopology)) == 0 {
+			return false, nil
+		}
+		logger.Info("Drift detected", "reasons", reasons)
+	}
+
+	// held for the whole sequence so a helm hook or manual run can't slip in between the steps
+	err = utils.WithLock(ctx, clientset, env, func(ctx context.Context) (err error) {
+		reconciled, err = Reconcile(ctx, clientset, env)
+		return err
+	})
+	if err != nil {
+		return reconciled, err
+	}
+
+	if reconciled {
+		logger.Info("Drift reconciled")
+	}
+	return reconciled, nil
+}
+
+func detectDrift(clusterTopology valkey.Topology, statefulSetReplicas int, env utils.Env, placements map[int]utils.Placement) []string {
+	var reasons []string
+	desiredNodeCount := env.Masters + env.Masters*env.ReplicasPerMaster
+
+	if statefulSetReplicas != desiredNodeCount {
+		reasons = append(reasons, fmt.Sprintf("statefulset has %d replicas, desired %d", statefulSetReplicas, desiredNodeCount))
+	}
+
+	if currentMasterCount := len(clusterTopology.Masters); currentMasterCount != env.Masters {
+		reasons = append(reasons, fmt.Sprintf("cluster has %d masters, desired %d", currentMasterCount, env.Masters))
+	}
+
+	for _, shard := range clusterTopology.OrderedShards {
+		masterNode, exists := clusterTopology.Masters[shard.MasterId]
+		if !exists {
+			continue
+		}
+		if len(masterNode.SlaveIds) != env.ReplicasPerMaster {
+			reasons = append(reasons, fmt.Sprintf(
+				"master %s has %d replicas, desired %d",
+				masterNode.Node.Hostname,
+				len(masterNode.SlaveIds),
+				env.ReplicasPerMaster,
+			))
+		}
+	}
+
+	if currentNodeCount := len(clusterTopology.OrderedNodes); currentNodeCount != desiredNodeCount {
+		reasons = append(reasons, fmt.Sprintf("cluster has %d nodes, desired %d", currentNodeCount, desiredNodeCount))
+	}
+
+	if healthy, err := clusterTopology.IsHealthy(); !healthy {
+		reasons = append(reasons, fmt.Sprintf("cluster is unhealthy: %v", err))
+	} else if moves := valkey.PlanReplicaSpread(clusterTopology, placements); len(moves) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d replicas can be spread across more kubernetes nodes or zones", len(moves)))
+	}
+
+	return reasons
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+func TestDetectDrift(t *testing.T) {
+	healthyNodes := []valkey.ClusterNode{
+		{
+			ID:        "master1",
+			Hostname:  "valkey-0.valkey.default.svc.cluster.local",
+			LinkState: valkey.Connected,
+			Flags:     []valkey.Flag{valkey.Master},
+		},
+		{
+			ID:        "master2",
+			Hostname:  "valkey-1.valkey.default.svc.cluster.local",
+			LinkState: valkey.Connected,
+			Flags:     []valkey.Flag{valkey.Master},
+		},
+		{
+			ID:        "slave1",
+			Hostname:  "valkey-2.valkey.default.svc.cluster.local",
+			Master:    "master1",
+			LinkState: valkey.Connected,
+			Flags:     []valkey.Flag{valkey.Slave},
+		},
+		{
+			ID:        "slave2",
+			Hostname:  "valkey-3.valkey.default.svc.cluster.local",
+			Master:    "master2",
+			LinkState: valkey.Connected,
+			Flags:     []valkey.Flag{valkey.Slave},
+		},
+	}
+
+	tests := []struct {
+		name                string
+		nodes               []valkey.ClusterNode
+		statefulSetReplicas int
+		env                 utils.Env
+		placements          map[int]utils.Placement
+		wantReasons         []string
+	}{
+		{
+			name:                "no drift",
+			nodes:               healthyNodes,
+			statefulSetReplicas: 4,
+			env:                 utils.Env{Masters: 2, ReplicasPerMaster: 1},
+			wantReasons:         nil,
+		},
+		{
+			name:                "statefulset replicas edited outside of helm",
+			nodes:               healthyNodes,
+			statefulSetReplicas: 6,
+			env:                 utils.Env{Masters: 2, ReplicasPerMaster: 1},
+			wantReasons:         []string{"statefulset has 6 replicas, desired 4"},
+		},
+		{
+			name:                "more replicas desired",
+			nodes:               healthyNodes,
+			statefulSetReplicas: 6,
+			env:                 utils.Env{Masters: 2, ReplicasPerMaster: 2},
+			wantReasons: []string{
+				"master valkey-0.valkey.default.svc.cluster.local has 1 replicas, desired 2",
+				"master valkey-1.valkey.default.svc.cluster.local has 1 replicas, desired 2",
+				"cluster has 4 nodes, desired 6",
+			},
+		},
+		{
+			name:                "fewer masters desired",
+			nodes:               healthyNodes,
+			statefulSetReplicas: 4,
+			env:                 utils.Env{Masters: 1, ReplicasPerMaster: 1},
+			wantReasons: []string{
+				"statefulset has 4 replicas, desired 2",
+				"cluster has 2 masters, desired 1",
+				"cluster has 4 nodes, desired 2",
+			},
+		},
+		{
+			name: "failed node",
+			nodes: func() []valkey.ClusterNode {
+				nodes := make([]valkey.ClusterNode, len(healthyNodes))
+				copy(nodes, healthyNodes)
+				nodes[3].Flags = []valkey.Flag{valkey.Slave, valkey.Fail}
+				return nodes
+			}(),
+			statefulSetReplicas: 4,
+			env:                 utils.Env{Masters: 2, ReplicasPerMaster: 1},
+			wantReasons:         []string{"cluster is unhealthy: node slave2 is in fail state"},
+		},
+		{
+			name:                "replicas in their master's zone",
+			nodes:               healthyNodes,
+			statefulSetReplicas: 4,
+			env:                 utils.Env{Masters: 2, ReplicasPerMaster: 1},
+			placements: map[int]utils.Placement{
+				0: {Node: "node-a", Zone: "a"},
+				1: {Node: "node-b", Zone: "b"},
+				2: {Node: "node-c", Zone: "a"},
+				3: {Node: "node-d", Zone: "b"},
+			},
+			wantReasons: []string{"2 replicas can be spread across more kubernetes nodes or zones"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topology, err := valkey.ClusterTopology(test.nodes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			reasons := detectDrift(topology, test.statefulSetReplicas, test.env, test.placements)
+			if len(reasons) != len(test.wantReasons) {
+				t.Fatalf("detectDrift() = %v, want %v", reasons, test.wantReasons)
+			}
+			for i, reason := range reasons {
+				if !strings.Contains(reason, test.wantReasons[i]) {
+					t.Errorf("reason[%d] = %q, want %q", i, reason, test.wantReasons[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+type FailoverCommandOptions struct {
+	Shard   string // any node of the shard to fail over (node id or pod name)
+	Replica string // replica to promote (node id or pod name). picks the one furthest along when empty
+	Mode    valkey.FailoverMode
+	MaxLag  int64
+	Unsafe  bool
+	DryRun  bool // only print the check
+}
+
+// ManualFailover fails a shard over to one of its replicas. the replica's replication offset is compared
+// to the master's first and the failover is refused if it would lose writes unless options.Unsafe is set
+func ManualFailover(ctx context.Context, env utils.Env, options FailoverCommandOptions) (err error) {
+	ctx = logging.With(ctx, "operation", "failover")
+	if !options.DryRun {
+		defer func(startTime time.Time) {
+			observeOperation(ctx, "failover", "failover", startTime, err)
+		}(time.Now())
+	}
+
+	clusterTopology, err := liveClusterTopology(ctx, env)
+	if err != nil {
+		return err
+	}
+	failoverOptions, err := resolveFailover(clusterTopology, options)
+	if err != nil {
+		return err
+	}
+	failoverOptions.Auth = valkey.ReconcilerAuth(env)
+
+	if options.DryRun {
+		check, err := valkey.CheckFailover(ctx, failoverOptions)
+		if err != nil {
+			return err
+		}
+		printFailoverCheck(os.Stdout, check)
+		return nil
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	check, err := valkey.Failover(timeoutCtx, failoverOptions)
+	if check.Replica.ID != "" {
+		printFailoverCheck(os.Stdout, check)
+	}
+	if err != nil {
+		return err
+	}
+	relabelPods(ctx, env)
+	return nil
+}
+
+// turns the node ids or pod names the command was given into the shard's master and the replica
+func resolveFailover(clusterTopology valkey.Topology, options FailoverCommandOptions) (valkey.FailoverOptions, error) {
+	if options.Shard == "" && options.Replica == "" {
+		return valkey.FailoverOptions{}, fmt.Errorf("either a shard or a replica to fail over to is required")
+	}
+
+	failoverOptions := valkey.FailoverOptions{
+		Topology: clusterTopology,
+		Mode:     options.Mode,
+		MaxLag:   options.MaxLag,
+		Unsafe:   options.Unsafe,
+	}
+	if options.Replica != "" {
+		replica, err := findNode(clusterTopology, options.Replica)
+		if err != nil {
+			return valkey.FailoverOptions{}, err
+		}
+		if replica.Master == "" {
+			return valkey.FailoverOptions{}, fmt.Errorf("%s is already a master", options.Replica)
+		}
+		failoverOptions.ReplicaID, failoverOptions.MasterID = replica.ID, replica.Master
+	}
+	if options.Shard != "" {
+		node, err := findNode(clusterTopology, options.Shard)
+		if err != nil {
+			return valkey.FailoverOptions{}, err
+		}
+		masterID := node.ID
+		if node.Master != "" {
+			masterID = node.Master
+		}
+		if failoverOptions.MasterID != "" && failoverOptions.MasterID != masterID {
+			return valkey.FailoverOptions{}, fmt.Errorf("%s is not in the shard of %s", options.Replica, options.Shard)
+		}
+		failoverOptions.MasterID = masterID
+	}
+	return failoverOptions, nil
+}
+
+// by node id or by pod name (the first label of the hostname)
+func findNode(clusterTopology valkey.Topology, ref string) (valkey.ClusterNode, error) {
+	for _, node := range clusterTopology.OrderedNodes {
+		podName, _, _ := strings.Cut(node.Hostname, ".")
+		if node.ID == ref || (podName != "" && podName == ref) {
+			return node, nil
+		}
+	}
+	return valkey.ClusterNode{}, fmt.Errorf("no node %s in the cluster", ref)
+}
+
+func printFailoverCheck(w io.Writer, check valkey.FailoverCheck) {
+	fmt.Fprintf(w, "Failover (%s):\n", check.Mode)
+	fmt.Fprintf(w, "  Master:  %s (%s) offset %s\n", check.Master.ID, check.Master.Hostname, formatOffset(check.MasterOffset))
+	fmt.Fprintf(w, "  Replica: %s (%s) offset %d\n", check.Replica.ID, check.Replica.Hostname, check.ReplicaOffset)
+	fmt.Fprintf(w, "  Lag:     %s\n", formatOffset(check.Lag))
+	if len(check.Problems) == 0 {
+		fmt.Fprintln(w, "  Safe:    yes")
+		return
+	}
+	fmt.Fprintln(w, "  Safe:    no")
+	for _, problem := range check.Problems {
+		fmt.Fprintf(w, "    - %s\n", problem)
+	}
+}
+
+func formatOffset(offset int64) string {
+	if offset == -1 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d", offset)
+}
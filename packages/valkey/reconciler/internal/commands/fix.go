@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+// Fix repairs half-migrated, uncovered and doubly owned slots and prints every action as it goes. with
+// dryRun it only prints what it would do
+func Fix(ctx context.Context, env utils.Env, dryRun bool) (err error) {
+	ctx = logging.With(ctx, "operation", "fix")
+	logger := logging.FromContext(ctx)
+	if !dryRun {
+		defer func(startTime time.Time) {
+			observeOperation(ctx, "fix", "fix", startTime, err)
+		}(time.Now())
+	}
+
+	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(ctx, env)
+	if err != nil {
+		return err
+	}
+	if len(clusterClientHostnames) == 0 {
+		return fmt.Errorf("cluster is not initialized")
+	}
+
+	lastColonIndex := strings.LastIndex(clusterClientHostnames[0], ":")
+	cliHostname := clusterClientHostnames[0][:lastColonIndex]
+	options := valkey.FixOptions{
+		RebalanceOptions: valkey.RebalanceOptions{
+			CliBaseOptions: valkey.CliBaseOptions{
+				Connection: valkey.Connection{
+					Hostname: cliHostname,
+					Port:     uint16(env.ClientPort),
+				},
+				Auth: valkey.ReconcilerAuth(env),
+			},
+		},
+		DryRun: dryRun,
+		Progress: func(action valkey.FixAction) {
+			if dryRun {
+				fmt.Printf("would %s\n", action)
+				return
+			}
+			fmt.Println(action)
+			logger.Info("Fixing cluster", "action", action.Type, "detail", action.String())
+		},
+	}
+
+	actions, err := valkey.Fix(ctx, options)
+	if err != nil {
+		return err
+	}
+	if len(actions) == 0 {
+		fmt.Println("nothing to fix")
+	}
+	return nil
+}
@@ -2,92 +2,78 @@ package commands
 
 import (
 	"context"
-	"fmt"
-	"strings"
+	"errors"
 	"time"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
 	"valkey/reconciler/internal/utils"
 	"valkey/reconciler/internal/valkey"
-
-	valkeygo "github.com/valkey-io/valkey-go"
 )
 
-func Init(env utils.Env) error {
-	fmt.Println("=== Valkey Cluster Initialization ===")
+func Init(ctx context.Context, env utils.Env) (err error) {
+	ctx = logging.With(ctx, "operation", "init")
+	logger := logging.FromContext(ctx)
+	defer func(startTime time.Time) {
+		step := "prepare"
+		var createErr *valkey.CreateError
+		if errors.As(err, &createErr) {
+			step = string(createErr.Step)
+		}
+		observeOperation(ctx, "init", step, startTime, err)
+	}(time.Now())
 
 	totalNodes := env.Masters + env.Masters*env.ReplicasPerMaster
+	logger.Info("Initializing Valkey cluster",
+		"masters", env.Masters,
+		"replicas_per_master", env.ReplicasPerMaster,
+		"total_nodes", totalNodes,
+	)
 
-	fmt.Printf("Configuration:\n")
-	fmt.Printf("  Masters: %d\n", env.Masters)
-	fmt.Printf("  Replicas per master: %d\n", env.ReplicasPerMaster)
-	fmt.Printf("  Total nodes: %d\n", totalNodes)
-	fmt.Printf("  Cluster name: %s\n", env.ClusterName)
-	fmt.Printf("  Namespace: %s\n", env.Namespace)
-	fmt.Println()
-
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	statefulSetName := utils.GetStatefulsetName(env.ClusterName)
-	err := utils.WaitForStatefulSetReady(timeoutCtx, env.Namespace, statefulSetName, totalNodes)
+	statefulSetName := utils.GetStatefulsetName(env)
+	err = utils.WaitForStatefulSetReady(timeoutCtx, env.Namespace, statefulSetName, totalNodes)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Building node list...")
 	nodeList := make([]string, 0, totalNodes)
 	for i := range totalNodes {
-		nodeList = append(nodeList, fmt.Sprintf("%s:%d", utils.GetPodHeadlessServiceFQDN(env.ClusterName, env.Namespace, i), 6379))
+		nodeList = append(nodeList, utils.GetPodAddress(env, i))
 	}
 
-	fmt.Println("Nodes:", nodeList)
-	fmt.Println()
+	logger.Debug("Built node list", "nodes", nodeList)
 
-	clusterClient, err := valkey.NewClient(valkeygo.ClientOption{
-		InitAddress: []string{nodeList[0]},
-		Username:    valkey.AdminUser,
-		Password:    env.AdminPassword,
-	})
+	clusterClient, err := valkey.NewClient(valkey.ReconcilerAuth(env), nodeList[0])
 	if err != nil {
 		return err
 	}
 	defer clusterClient.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-	infoCmd := clusterClient.B().ClusterInfo().Build()
-	infoResponse := clusterClient.Do(ctx, infoCmd)
-	cancel()
-
-	info, err := infoResponse.ToString()
-	if err == nil && strings.Contains(info, "cluster_state:ok") {
-		fmt.Println("Cluster already initialized; skipping initialization.")
+	info, err := valkey.GetClusterInfo(clusterClient)
+	if err == nil && info.State == valkey.ClusterStateOK {
+		logger.Info("Cluster already initialized; skipping initialization")
 		return nil
 	}
 
-	fmt.Println("Creating Valkey cluster...")
+	logger.Info("Creating Valkey cluster")
 	createClusterOptions := valkey.CreateClusterOptions{
-		CliBaseOptions: valkey.CliBaseOptions{
-			Auth: valkey.Auth{
-				Username: valkey.AdminUser,
-				Password: env.AdminPassword,
-			},
-		},
+		Auth:              valkey.ReconcilerAuth(env),
 		Nodes:             nodeList,
 		ReplicasPerMaster: env.ReplicasPerMaster,
+		BusPort:           env.BusPort,
 	}
-	if err := valkey.CreateCluster(createClusterOptions); err != nil {
-		fmt.Println("ERROR: Failed to create cluster")
+	createCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	clusterTopology, err := valkey.CreateCluster(createCtx, createClusterOptions)
+	if err != nil {
 		return err
 	}
 
-	fmt.Println()
-	fmt.Println("✓ Cluster created successfully!")
-	fmt.Println()
-
-	valkey.PrintClusterInfo(clusterClient)
-	fmt.Println()
-
-	valkey.PrintClusterNodes(clusterClient)
-
-	fmt.Println("=== Initialization Complete ===")
+	logger.Info("Cluster created", "topology", clusterTopology)
+	events.Normal(ctx, events.ReasonClusterCreated, "Created cluster with %d masters and %d replicas per master", env.Masters, env.ReplicasPerMaster)
+	valkey.LogClusterInfo(ctx, clusterClient)
+	valkey.LogClusterNodes(ctx, clusterClient)
 	return nil
 }
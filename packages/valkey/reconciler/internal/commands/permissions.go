@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+// VerifyPermissions makes sure the reconciler's acl user can run everything it needs before anything
+// touches the cluster. every node loads the same users.acl so the first pod that answers is asked.
+// nothing is checked when no pod is up yet (ie. before init waits for the statefulset)
+func VerifyPermissions(ctx context.Context, env utils.Env) error {
+	logger := logging.FromContext(ctx)
+
+	addresses, err := valkey.GetPodAddresses(ctx, env)
+	if err != nil || len(addresses) == 0 {
+		logger.Debug("No pod to check acl permissions against yet", "error", err)
+		return nil
+	}
+
+	for _, address := range addresses {
+		client, err := valkey.NewNodeClient(valkey.ReconcilerAuth(env), address)
+		if err != nil {
+			if strings.Contains(err.Error(), "WRONGPASS") {
+				return fmt.Errorf("authenticate as %s: %w", env.Username, err)
+			}
+			logger.Debug("Pod not reachable for the acl check", "address", address, "error", err)
+			continue
+		}
+		err = valkey.CheckPermissions(ctx, client, env.Username)
+		client.Close()
+		if err != nil {
+			return err
+		}
+		logger.Debug("Acl user has every permission it needs", "username", env.Username, "address", address)
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,503 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+type OutputFormat string
+
+const (
+	OutputText OutputFormat = "text"
+	OutputJSON OutputFormat = "json"
+)
+
+func (f OutputFormat) Validate() error {
+	switch f {
+	case OutputText, OutputJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q. expected %s or %s", f, OutputText, OutputJSON)
+	}
+}
+
+type PlanAction string
+
+const (
+	PlanAddMaster    PlanAction = "add-master"
+	PlanAddReplica   PlanAction = "add-replica"
+	PlanFailover     PlanAction = "failover"
+	PlanMigrateSlots PlanAction = "migrate-slots"
+	PlanDelNode      PlanAction = "del-node"
+	PlanResize       PlanAction = "resize-statefulset"
+	PlanMoveReplica  PlanAction = "move-replica"
+)
+
+// nodes that haven't joined the cluster yet don't have an id
+type PlanNode struct {
+	ID      string `json:"id,omitempty"`
+	Address string `json:"address"`
+}
+
+func (n PlanNode) String() string {
+	if n.ID == "" {
+		return n.Address
+	}
+	return fmt.Sprintf("%s (%s)", n.ID, n.Address)
+}
+
+// PlanStep is a single operation scale up or scale down runs against the cluster. target is the master
+// a replica is attached (or moved) to, the master demoted by a failover or the master receiving migrated slots.
+// resizing the statefulset has the statefulset name as its node and the new size in pods.
+type PlanStep struct {
+	Action     PlanAction         `json:"action"`
+	Node       PlanNode           `json:"node"`
+	Target     *PlanNode          `json:"target,omitempty"`
+	Slots      int                `json:"slots,omitempty"`
+	SlotRanges []valkey.SlotRange `json:"slotRanges,omitempty"`
+	Pods       int                `json:"pods,omitempty"`
+	Reason     string             `json:"reason"`
+}
+
+type ClusterShape struct {
+	Masters           int `json:"masters"`
+	ReplicasPerMaster int `json:"replicasPerMaster"`
+	Nodes             int `json:"nodes"`
+}
+
+type ScalePlan struct {
+	Command string       `json:"command"`
+	Current ClusterShape `json:"current"`
+	Desired ClusterShape `json:"desired"`
+	Steps   []PlanStep   `json:"steps"`
+}
+
+func (p ScalePlan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Plan for %s:\n", p.Command)
+	fmt.Fprintf(w, "  Current: %d masters, %d replicas per master, %d nodes\n", p.Current.Masters, p.Current.ReplicasPerMaster, p.Current.Nodes)
+	fmt.Fprintf(w, "  Desired: %d masters, %d replicas per master, %d nodes\n", p.Desired.Masters, p.Desired.ReplicasPerMaster, p.Desired.Nodes)
+	fmt.Fprintln(w)
+
+	if len(p.Steps) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+
+	fmt.Fprintln(w, "Steps:")
+	for i, step := range p.Steps {
+		switch step.Action {
+		case PlanMigrateSlots:
+			fmt.Fprintf(w, "  %d. %s: %d slots %s -> %s\n", i+1, step.Action, step.Slots, step.Node, step.Target)
+		case PlanAddReplica, PlanMoveReplica:
+			fmt.Fprintf(w, "  %d. %s: %s replicating %s\n", i+1, step.Action, step.Node, step.Target)
+		case PlanFailover:
+			fmt.Fprintf(w, "  %d. %s: %s takes over from %s\n", i+1, step.Action, step.Node, step.Target)
+		case PlanResize:
+			fmt.Fprintf(w, "  %d. %s: %s to %d pods\n", i+1, step.Action, step.Node, step.Pods)
+		default:
+			fmt.Fprintf(w, "  %d. %s: %s\n", i+1, step.Action, step.Node)
+		}
+		fmt.Fprintf(w, "     %s\n", step.Reason)
+	}
+}
+
+type PlanOptions struct {
+	Command string // scale-up, scale-down or reconcile
+	Output  OutputFormat
+}
+
+// Plan prints what scale up, scale down or reconcile would do to the live cluster without changing
+// anything
+func Plan(ctx context.Context, env utils.Env, options PlanOptions) error {
+	if err := options.Output.Validate(); err != nil {
+		return err
+	}
+
+	clusterTopology, err := liveClusterTopology(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	var plan ScalePlan
+	switch options.Command {
+	case "scale-up":
+		plan, err = PlanScaleUp(clusterTopology, env, podPlacements(ctx, env))
+	case "scale-down":
+		plan, err = PlanScaleDown(clusterTopology, env)
+	case "reconcile":
+		var pods int
+		pods, err = liveStatefulSetReplicas(ctx, env)
+		if err != nil {
+			return err
+		}
+		plan, err = PlanReconcile(clusterTopology, pods, env, podPlacements(ctx, env))
+	default:
+		return fmt.Errorf("can't plan %q. expected scale-up, scale-down or reconcile", options.Command)
+	}
+	if err != nil {
+		return err
+	}
+
+	if options.Output == OutputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+	plan.Print(os.Stdout)
+	return nil
+}
+
+func liveClusterTopology(ctx context.Context, env utils.Env) (valkey.Topology, error) {
+	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(ctx, env)
+	if err != nil {
+		return valkey.Topology{}, err
+	}
+	if len(clusterClientHostnames) == 0 {
+		if err := valkey.CheckUninitialized(ctx, env); err != nil {
+			return valkey.Topology{}, fmt.Errorf("no pod answered as part of a cluster: %w", err)
+		}
+		return valkey.Topology{}, fmt.Errorf("cluster is not initialized")
+	}
+
+	client, err := valkey.NewClient(valkey.ReconcilerAuth(env), clusterClientHostnames...)
+	if err != nil {
+		return valkey.Topology{}, err
+	}
+	defer client.Close()
+
+	return valkey.GetClusterTopology(client)
+}
+
+// PlanScaleDown walks through the same decisions as ScaleDown against a simulated copy of the
+// topology and records every operation instead of running it
+func PlanScaleDown(clusterTopology valkey.Topology, env utils.Env) (ScalePlan, error) {
+	if healthy, err := clusterTopology.IsHealthy(); !healthy {
+		return ScalePlan{}, err
+	}
+	if len(clusterTopology.Masters) == 0 {
+		return ScalePlan{}, fmt.Errorf("cluster has no masters")
+	}
+
+	plan := ScalePlan{Command: "scale-down", Current: topologyShape(clusterTopology), Desired: desiredShape(env)}
+	p := newPlanner(clusterTopology, env)
+	if err := p.scaleDown(clusterTopology, env); err != nil {
+		return ScalePlan{}, err
+	}
+	plan.Steps = p.steps
+	return plan, nil
+}
+
+// PlanScaleUp walks through the same decisions as ScaleUp against a simulated copy of the topology
+// and records every operation instead of running it. the statefulset is expected to already be scaled.
+func PlanScaleUp(clusterTopology valkey.Topology, env utils.Env, placements map[int]utils.Placement) (ScalePlan, error) {
+	plan := ScalePlan{Command: "scale-up", Current: topologyShape(clusterTopology), Desired: desiredShape(env)}
+	p := newPlanner(clusterTopology, env)
+	p.placements = placements
+	if err := p.scaleUp(clusterTopology, env); err != nil {
+		return ScalePlan{}, err
+	}
+	plan.Steps = p.steps
+	return plan, nil
+}
+
+// scaleDown records the ScaleDown steps. clusterTopology has to be what the planner starts from
+func (p *planner) scaleDown(clusterTopology valkey.Topology, env utils.Env) error {
+	phases := decideScaleDown(clusterTopology, env)
+
+	if phases.removeShards {
+		for _, shard := range shardsToRemove(clusterTopology, env) {
+			if err := p.removeShard(shard); err != nil {
+				return err
+			}
+		}
+	} else if phases.makeRoom {
+		for _, node := range nodesInTheWayOfMasters(clusterTopology, env) {
+			if node.Master == "" {
+				if err := p.failover(node.ID, "master is in a spot needed for a new master"); err != nil {
+					return err
+				}
+			}
+			p.delNode(node.ID, "making room for a new master")
+		}
+	}
+
+	if phases.removeReplicas {
+		current, err := p.topology()
+		if err != nil {
+			return err
+		}
+		excess, err := excessReplicas(current, env)
+		if err != nil {
+			return err
+		}
+		for _, shard := range excess {
+			for _, node := range shard.replicas {
+				p.delNode(node.ID, fmt.Sprintf("master %s has more than %d replicas", shard.master.ID, env.ReplicasPerMaster))
+			}
+		}
+	}
+
+	if phases.removeDangerZone {
+		current, err := p.topology()
+		if err != nil {
+			return err
+		}
+		for _, shard := range mastersInDangerZone(current, env) {
+			if err := p.failover(shard.MasterId, "master is on a pod that will be removed by the statefulset scale down"); err != nil {
+				return err
+			}
+		}
+
+		current, err = p.topology()
+		if err != nil {
+			return err
+		}
+		for _, node := range dangerZoneNodes(current, env) {
+			p.delNode(node.ID, "pod will be removed by the statefulset scale down")
+		}
+	}
+	return nil
+}
+
+// scaleUp records the ScaleUp steps for the statefulset scaled to the desired size
+func (p *planner) scaleUp(clusterTopology valkey.Topology, env utils.Env) error {
+	masterHostnames, err := mastersToAdd(clusterTopology, env)
+	if err != nil {
+		return err
+	}
+	for _, hostname := range masterHostnames {
+		if err := p.addNode(hostname, "", "new master for the desired master count"); err != nil {
+			return err
+		}
+	}
+
+	current, err := p.topology()
+	if err != nil {
+		return err
+	}
+	if len(current.OrderedNodes) != desiredShape(env).Nodes {
+		freeHostnames, err := freeNodeHostnames(env, current)
+		if err != nil {
+			return err
+		}
+		assignments, err := assignReplicas(current, env, freeHostnames, p.placements)
+		if err != nil {
+			return err
+		}
+		for _, assignment := range assignments {
+			if err := p.addNode(assignment.hostname, assignment.masterID, "new replica for the desired replicas per master"); err != nil {
+				return err
+			}
+		}
+	}
+
+	current, err = p.topology()
+	if err != nil {
+		return err
+	}
+	if healthy, err := current.IsHealthy(); !healthy {
+		return fmt.Errorf("cluster would be unhealthy after adding nodes: %w", err)
+	}
+	p.rebalance(current, nil, "rebalance slots onto the new masters")
+	return nil
+}
+
+func topologyShape(clusterTopology valkey.Topology) ClusterShape {
+	shape := ClusterShape{Masters: len(clusterTopology.Masters), Nodes: len(clusterTopology.OrderedNodes)}
+	if shape.Masters > 0 {
+		shape.ReplicasPerMaster = len(clusterTopology.Slaves) / shape.Masters
+	}
+	return shape
+}
+
+func desiredShape(env utils.Env) ClusterShape {
+	return ClusterShape{
+		Masters:           env.Masters,
+		ReplicasPerMaster: env.ReplicasPerMaster,
+		Nodes:             env.Masters + env.Masters*env.ReplicasPerMaster,
+	}
+}
+
+// planner keeps a simulated copy of the cluster nodes that every recorded step is applied to so later
+// decisions see the cluster the way it would look at that point
+type planner struct {
+	nodes      []valkey.ClusterNode
+	pending    map[string]struct{} // ids made up for nodes that haven't joined yet
+	steps      []PlanStep
+	clientPort uint16                  // port new nodes join on
+	placements map[int]utils.Placement // where the pods run. nil places replicas by pod index
+}
+
+func newPlanner(clusterTopology valkey.Topology, env utils.Env) *planner {
+	return &planner{
+		nodes:      slices.Clone(clusterTopology.OrderedNodes),
+		pending:    map[string]struct{}{},
+		clientPort: uint16(env.ClientPort),
+	}
+}
+
+func (p *planner) topology() (valkey.Topology, error) {
+	return valkey.ClusterTopology(p.nodes)
+}
+
+func (p *planner) node(id string) (valkey.ClusterNode, int) {
+	for i, node := range p.nodes {
+		if node.ID == id {
+			return node, i
+		}
+	}
+	return valkey.ClusterNode{}, -1
+}
+
+func (p *planner) planNode(node valkey.ClusterNode) PlanNode {
+	if _, pending := p.pending[node.ID]; pending {
+		return PlanNode{Address: node.Address()}
+	}
+	return PlanNode{ID: node.ID, Address: node.Address()}
+}
+
+func (p *planner) delNode(id, reason string) {
+	node, i := p.node(id)
+	if i == -1 {
+		return
+	}
+	p.steps = append(p.steps, PlanStep{Action: PlanDelNode, Node: p.planNode(node), Reason: reason})
+	p.nodes = slices.Delete(p.nodes, i, i+1)
+}
+
+// empty masterID adds a master
+func (p *planner) addNode(hostname, masterID, reason string) error {
+	for _, node := range p.nodes {
+		if node.Hostname == hostname {
+			return fmt.Errorf("pod %s is already part of the cluster. expected pod to not be part of cluster", hostname)
+		}
+	}
+
+	node := valkey.ClusterNode{
+		ID:        hostname,
+		Hostname:  hostname,
+		Port:      p.clientPort,
+		Master:    masterID,
+		LinkState: valkey.Connected,
+	}
+	p.pending[node.ID] = struct{}{}
+	p.nodes = append(p.nodes, node)
+	sort.SliceStable(p.nodes, func(i, j int) bool {
+		return p.nodes[i].Index() < p.nodes[j].Index()
+	})
+
+	step := PlanStep{Action: PlanAddMaster, Node: p.planNode(node), Reason: reason}
+	if masterID != "" {
+		master, _ := p.node(masterID)
+		target := p.planNode(master)
+		step.Action, step.Target = PlanAddReplica, &target
+	}
+	p.steps = append(p.steps, step)
+	return nil
+}
+
+// moves the master of the shard to the original shard leader the same way PromoteOriginalShardLeader does
+func (p *planner) failover(masterID, reason string) error {
+	current, err := p.topology()
+	if err != nil {
+		return err
+	}
+	leader, err := valkey.OriginalShardLeader(current, valkey.Shard{MasterId: masterID})
+	if err != nil {
+		return err
+	}
+	if leader.ID == masterID {
+		return nil
+	}
+
+	master, _ := p.node(masterID)
+	target := p.planNode(master)
+	p.steps = append(p.steps, PlanStep{Action: PlanFailover, Node: p.planNode(leader), Target: &target, Reason: reason})
+
+	for i, node := range p.nodes {
+		switch {
+		case node.ID == leader.ID:
+			p.nodes[i].Master = ""
+			p.nodes[i].Slots = master.Slots
+		case node.ID == masterID:
+			p.nodes[i].Master = leader.ID
+			p.nodes[i].Slots = nil
+		case node.Master == masterID:
+			p.nodes[i].Master = leader.ID
+		}
+	}
+	return nil
+}
+
+// moves replicas between shards the way valkey.PlanReplicaSpread lays out
+func (p *planner) spread() error {
+	current, err := p.topology()
+	if err != nil {
+		return err
+	}
+	for _, move := range valkey.PlanReplicaSpread(current, p.placements) {
+		master, _ := p.node(move.MasterID)
+		target := p.planNode(master)
+		p.steps = append(p.steps, PlanStep{
+			Action: PlanMoveReplica,
+			Node:   p.planNode(move.Replica),
+			Target: &target,
+			Reason: "spreads both shards across more kubernetes nodes or zones",
+		})
+		_, i := p.node(move.Replica.ID)
+		p.nodes[i].Master = move.MasterID
+	}
+	return nil
+}
+
+// drains the shard the same way DelShard does: replicas first, then the master's slots and the master
+func (p *planner) removeShard(shard valkey.Shard) error {
+	current, err := p.topology()
+	if err != nil {
+		return err
+	}
+	masterNode, exists := current.Masters[shard.MasterId]
+	if !exists {
+		return fmt.Errorf("master %s not found in topology", shard.MasterId)
+	}
+
+	for _, slaveId := range masterNode.SlaveIds {
+		p.delNode(slaveId, fmt.Sprintf("replica of removed shard %s", shard.MasterId))
+	}
+
+	p.rebalance(current, valkey.DrainWeights(current, shard.MasterId), fmt.Sprintf("drain slots from removed shard %s", shard.MasterId))
+
+	p.delNode(shard.MasterId, "master of removed shard")
+	return nil
+}
+
+func (p *planner) rebalance(current valkey.Topology, weights map[string]float64, reason string) {
+	masters := make([]valkey.ClusterNode, 0, len(current.Masters))
+	for _, shard := range current.OrderedShards {
+		master, _ := p.node(shard.MasterId)
+		masters = append(masters, master)
+	}
+
+	moves := valkey.PlanRebalance(masters, valkey.RebalanceOptions{UseEmptyMasters: true, Weights: weights})
+	for _, transfer := range valkey.GroupSlotMoves(moves) {
+		source, _ := p.node(transfer.SourceID)
+		target, _ := p.node(transfer.TargetID)
+		planTarget := p.planNode(target)
+		p.steps = append(p.steps, PlanStep{
+			Action:     PlanMigrateSlots,
+			Node:       p.planNode(source),
+			Target:     &planTarget,
+			Slots:      transfer.SlotCount(),
+			SlotRanges: transfer.Slots,
+			Reason:     reason,
+		})
+	}
+	p.nodes = valkey.ApplySlotMoves(p.nodes, moves)
+}
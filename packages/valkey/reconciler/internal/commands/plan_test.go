@@ -0,0 +1,354 @@
+package commands
+
+import (
+	"fmt"
+	"testing"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+func TestPlanScaleDown(t *testing.T) {
+	tests := []struct {
+		name      string
+		nodes     []valkey.ClusterNode
+		env       utils.Env
+		wantSteps []string
+		wantErr   bool
+	}{
+		{
+			name:      "already the desired shape",
+			nodes:     planNodes(2, 1),
+			env:       testEnv(2, 1),
+			wantSteps: nil,
+		},
+		{
+			name:  "remove a shard",
+			nodes: planNodes(3, 0),
+			env:   testEnv(2, 0),
+			wantSteps: []string{
+				"migrate-slots node2 -> node0",
+				"migrate-slots node2 -> node1",
+				"del-node node2",
+			},
+		},
+		{
+			name:  "remove replicas from the highest pod indices",
+			nodes: planNodes(2, 2),
+			env:   testEnv(2, 1),
+			wantSteps: []string{
+				"del-node node4",
+				"del-node node5",
+			},
+		},
+		{
+			name: "fail over a master out of the spot needed for a new master",
+			nodes: []valkey.ClusterNode{
+				planNode(0, "node1", nil),
+				planNode(1, "", []valkey.SlotRange{{StartSlot: 0, EndSlot: 16383}}),
+			},
+			env: testEnv(2, 0),
+			wantSteps: []string{
+				"failover node0 -> node1",
+				"del-node node1",
+			},
+		},
+		{
+			name: "unhealthy cluster",
+			nodes: []valkey.ClusterNode{
+				planNode(0, "", []valkey.SlotRange{{StartSlot: 0, EndSlot: 16383}}),
+				planNode(2, "node0", nil),
+			},
+			env:     testEnv(1, 0),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusterTopology, err := valkey.ClusterTopology(test.nodes)
+			if err != nil {
+				t.Fatalf("unexpected topology error: %v", err)
+			}
+
+			plan, err := PlanScaleDown(clusterTopology, test.env)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got plan %v", plan.Steps)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertPlanSteps(t, plan, test.wantSteps)
+		})
+	}
+}
+
+func TestPlanScaleUp(t *testing.T) {
+	tests := []struct {
+		name       string
+		nodes      []valkey.ClusterNode
+		env        utils.Env
+		placements map[int]utils.Placement
+		wantSteps  []string
+		wantErr    bool
+	}{
+		{
+			name:      "already the desired shape",
+			nodes:     planNodes(2, 1),
+			env:       testEnv(2, 1),
+			wantSteps: nil,
+		},
+		{
+			name:  "add a master and replicas",
+			nodes: planNodes(1, 0),
+			env:   testEnv(2, 1),
+			wantSteps: []string{
+				"add-master valkey-test-1",
+				"add-replica valkey-test-2 -> node0",
+				"add-replica valkey-test-3 -> valkey-test-1",
+				"migrate-slots node0 -> valkey-test-1",
+			},
+		},
+		{
+			name:       "replicas in another zone than their master",
+			nodes:      planNodes(1, 0),
+			env:        testEnv(2, 1),
+			placements: zonedPlacements(4),
+			// pod 2 is in node0's zone so node0 gets pod 3
+			wantSteps: []string{
+				"add-master valkey-test-1",
+				"add-replica valkey-test-3 -> node0",
+				"add-replica valkey-test-2 -> valkey-test-1",
+				"migrate-slots node0 -> valkey-test-1",
+			},
+		},
+		{
+			name:    "more masters than desired",
+			nodes:   planNodes(3, 0),
+			env:     testEnv(2, 0),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusterTopology, err := valkey.ClusterTopology(test.nodes)
+			if err != nil {
+				t.Fatalf("unexpected topology error: %v", err)
+			}
+
+			plan, err := PlanScaleUp(clusterTopology, test.env, test.placements)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got plan %v", plan.Steps)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertPlanSteps(t, plan, test.wantSteps)
+		})
+	}
+}
+
+// masters on the first pods with the slots split evenly and replicas handed out round robin, the same
+// layout init creates
+func planNodes(masters, replicasPerMaster int) []valkey.ClusterNode {
+	nodes := make([]valkey.ClusterNode, 0, masters+masters*replicasPerMaster)
+	for i := range masters {
+		nodes = append(nodes, planNode(i, "", []valkey.SlotRange{{
+			StartSlot: uint16(i * valkey.TotalSlots / masters),
+			EndSlot:   uint16((i+1)*valkey.TotalSlots/masters - 1),
+		}}))
+	}
+	for i := range masters * replicasPerMaster {
+		nodes = append(nodes, planNode(masters+i, fmt.Sprintf("node%d", i%masters), nil))
+	}
+	return nodes
+}
+
+// the "test" cluster in the "default" namespace with the defaults Load fills in
+func testEnv(masters, replicasPerMaster int) utils.Env {
+	return utils.Env{
+		ClusterName:       "test",
+		Namespace:         "default",
+		Masters:           masters,
+		ReplicasPerMaster: replicasPerMaster,
+		ClientPort:        6379,
+		BusPort:           16379,
+		NamePrefix:        "valkey",
+		ClusterDomain:     "cluster.local",
+	}
+}
+
+func planNode(index int, master string, slots []valkey.SlotRange) valkey.ClusterNode {
+	return valkey.ClusterNode{
+		ID:        fmt.Sprintf("node%d", index),
+		Hostname:  utils.GetPodHeadlessServiceFQDN(testEnv(0, 0), index),
+		Port:      6379,
+		Master:    master,
+		LinkState: valkey.Connected,
+		Slots:     slots,
+	}
+}
+
+// steps are compared as "<action> <node> [-> <target>]" using the node id or the pod name for new nodes
+func assertPlanSteps(t *testing.T, plan ScalePlan, want []string) {
+	t.Helper()
+
+	name := func(node PlanNode) string {
+		if node.ID != "" {
+			return node.ID
+		}
+		for i := range 16 {
+			if node.Address == utils.GetPodAddress(testEnv(0, 0), i) {
+				return utils.GetStatefulsetPodName(testEnv(0, 0), i)
+			}
+		}
+		return node.Address
+	}
+
+	got := make([]string, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		summary := fmt.Sprintf("%s %s", step.Action, name(step.Node))
+		if step.Target != nil {
+			summary += " -> " + name(*step.Target)
+		}
+		got = append(got, summary)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected steps %v, got %v", want, got)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("step %d = %q, want %q", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestPlanReconcile(t *testing.T) {
+	tests := []struct {
+		name       string
+		nodes      []valkey.ClusterNode
+		pods       int
+		env        utils.Env
+		placements map[int]utils.Placement
+		wantSteps  []string
+		wantErr    bool
+	}{
+		{
+			name:      "already the desired shape",
+			nodes:     planNodes(2, 1),
+			pods:      4,
+			env:       testEnv(2, 1),
+			wantSteps: nil,
+		},
+		{
+			name:  "only the statefulset is off",
+			nodes: planNodes(2, 1),
+			pods:  6,
+			env:   testEnv(2, 1),
+			wantSteps: []string{
+				"resize-statefulset valkey-test",
+			},
+		},
+		{
+			name:  "replicas spread across zones",
+			nodes: planNodes(2, 1),
+			pods:  4,
+			env:   testEnv(2, 1),
+			placements: map[int]utils.Placement{
+				0: {Node: "node-0", Zone: "a"},
+				1: {Node: "node-1", Zone: "b"},
+				2: {Node: "node-2", Zone: "b"},
+				3: {Node: "node-3", Zone: "a"},
+			},
+			wantSteps: nil,
+		},
+		{
+			name:       "replicas in their master's zone",
+			nodes:      planNodes(2, 1),
+			pods:       4,
+			env:        testEnv(2, 1),
+			placements: zonedPlacements(4),
+			wantSteps: []string{
+				"move-replica node2 -> node1",
+				"move-replica node3 -> node0",
+			},
+		},
+		{
+			name:  "more masters and fewer replicas",
+			nodes: planNodes(2, 2),
+			pods:  6,
+			env:   testEnv(3, 1),
+			// the replica on pod 2 makes room for the new master and node1 drops its extra replica
+			wantSteps: []string{
+				"del-node node2",
+				"del-node node5",
+				"add-master valkey-test-2",
+				"add-replica valkey-test-5 -> valkey-test-2",
+				"migrate-slots node1 -> valkey-test-2",
+				"migrate-slots node0 -> valkey-test-2",
+			},
+		},
+		{
+			name:  "fewer masters and more replicas",
+			nodes: planNodes(3, 0),
+			pods:  3,
+			env:   testEnv(2, 1),
+			// the replicas go on the pod the removed shard leaves behind and the one the resize adds
+			wantSteps: []string{
+				"migrate-slots node2 -> node0",
+				"migrate-slots node2 -> node1",
+				"del-node node2",
+				"resize-statefulset valkey-test",
+				"add-replica valkey-test-2 -> node0",
+				"add-replica valkey-test-3 -> node1",
+			},
+		},
+		{
+			name: "unhealthy cluster",
+			nodes: []valkey.ClusterNode{
+				planNode(0, "", []valkey.SlotRange{{StartSlot: 0, EndSlot: 16383}}),
+				planNode(2, "node0", nil),
+			},
+			pods:    3,
+			env:     testEnv(1, 0),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusterTopology, err := valkey.ClusterTopology(test.nodes)
+			if err != nil {
+				t.Fatalf("unexpected topology error: %v", err)
+			}
+
+			plan, err := PlanReconcile(clusterTopology, test.pods, test.env, test.placements)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got plan %v", plan.Steps)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertPlanSteps(t, plan, test.wantSteps)
+		})
+	}
+}
+
+// pods alternate between zone a and zone b, each on its own kubernetes node
+func zonedPlacements(pods int) map[int]utils.Placement {
+	placements := make(map[int]utils.Placement, pods)
+	for i := range pods {
+		placements[i] = utils.Placement{Node: fmt.Sprintf("node-%d", i), Zone: string(rune('a' + i%2))}
+	}
+	return placements
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"context"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// SyncPodLabels labels every pod with its role and shard in the live cluster and annotates it with its
+// node id. before the cluster is initialized the labels are only removed
+func SyncPodLabels(ctx context.Context, clientset kubernetes.Interface, env utils.Env) error {
+	var roles map[int]utils.PodRole
+	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(ctx, env)
+	if err != nil {
+		return err
+	}
+	if len(clusterClientHostnames) > 0 {
+		client, err := valkey.NewClient(valkey.ReconcilerAuth(env), clusterClientHostnames...)
+		if err != nil {
+			return err
+		}
+		clusterTopology, err := valkey.GetClusterTopology(client)
+		client.Close()
+		if err != nil {
+			return err
+		}
+		roles = clusterTopology.PodRoles()
+	}
+
+	patched, err := utils.SyncPodRoles(ctx, clientset, env, roles)
+	if patched > 0 {
+		logging.FromContext(ctx).Info("Updated pod role labels", "pods", patched)
+	}
+	return err
+}
+
+// relabelPods is SyncPodLabels right after a failover. it is best effort: a reconciler that isn't
+// allowed to patch pods still fails over, the labels just lag behind
+func relabelPods(ctx context.Context, env utils.Env) {
+	clientset, err := utils.NewKubernetesClient()
+	if err == nil {
+		err = SyncPodLabels(ctx, clientset, env)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to update pod role labels", "error", err)
+	}
+}
@@ -0,0 +1,290 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// runPlanStep runs a single step of the reconcile plan against the live cluster. every step first checks
+// whether it already happened so the step a reconcile was interrupted in can be run again when it resumes
+func runPlanStep(ctx context.Context, clientset kubernetes.Interface, env utils.Env, step PlanStep) error {
+	if step.Action == PlanResize {
+		return resizeStatefulSet(ctx, clientset, env, step.Pods)
+	}
+
+	clusterTopology, err := liveClusterTopology(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	switch step.Action {
+	case PlanDelNode:
+		return runDelNode(ctx, env, clusterTopology, step)
+	case PlanAddMaster:
+		return runAddMaster(ctx, env, clusterTopology, step)
+	case PlanAddReplica, PlanMoveReplica:
+		return runAttachReplica(ctx, env, clusterTopology, step)
+	case PlanFailover:
+		return runFailover(ctx, env, clusterTopology, step)
+	case PlanMigrateSlots:
+		return runMigrateSlots(ctx, env, clusterTopology, step)
+	default:
+		return fmt.Errorf("unknown plan step %q", step.Action)
+	}
+}
+
+// findPlanNode looks up the node a step refers to. nodes that hadn't joined when the plan was made are
+// looked up by address
+func findPlanNode(clusterTopology valkey.Topology, node PlanNode) (valkey.ClusterNode, bool) {
+	for _, clusterNode := range clusterTopology.OrderedNodes {
+		if node.ID != "" && clusterNode.ID == node.ID || node.ID == "" && clusterNode.Address() == node.Address {
+			return clusterNode, true
+		}
+	}
+	return valkey.ClusterNode{}, false
+}
+
+// valkey-cli connects to any node of the cluster other than the one the step is about
+func cliOptionsExcept(env utils.Env, clusterTopology valkey.Topology, nodeID string) (valkey.CliBaseOptions, error) {
+	for _, node := range clusterTopology.OrderedNodes {
+		if node.ID != nodeID {
+			return valkey.CliBaseOptions{
+				Connection: valkey.Connection{Hostname: node.Hostname, Port: node.Port},
+				Auth:       valkey.ReconcilerAuth(env),
+			}, nil
+		}
+	}
+	return valkey.CliBaseOptions{}, fmt.Errorf("no node to run valkey-cli against")
+}
+
+func nodeAddresses(clusterTopology valkey.Topology, exceptID string) []string {
+	addresses := make([]string, 0, len(clusterTopology.OrderedNodes))
+	for _, node := range clusterTopology.OrderedNodes {
+		if node.ID != exceptID {
+			addresses = append(addresses, node.Address())
+		}
+	}
+	return addresses
+}
+
+func resizeStatefulSet(ctx context.Context, clientset kubernetes.Interface, env utils.Env, pods int) error {
+	statefulSetName := utils.GetStatefulsetName(env)
+	if err := utils.ScaleStatefulSet(ctx, clientset, env.Namespace, statefulSetName, pods); err != nil {
+		return err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+	return utils.WaitForStatefulSetReady(timeoutCtx, env.Namespace, statefulSetName, pods)
+}
+
+func runDelNode(ctx context.Context, env utils.Env, clusterTopology valkey.Topology, step PlanStep) error {
+	node, exists := findPlanNode(clusterTopology, step.Node)
+	if !exists {
+		logging.FromContext(ctx).Info("Node already removed", "node", step.Node.String())
+		return nil
+	}
+
+	cliBaseOptions, err := cliOptionsExcept(env, clusterTopology, node.ID)
+	if err != nil {
+		return err
+	}
+	if err := valkey.DelNode(ctx, valkey.DelNodeOptions{CliBaseOptions: cliBaseOptions, NodeID: node.ID}); err != nil {
+		return err
+	}
+
+	leftOverNodeHostnames := nodeAddresses(clusterTopology, node.ID)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	return valkey.WaitForAllNodesClusterInfo(timeoutCtx, env, leftOverNodeHostnames, valkey.KnownNodesAre(len(leftOverNodeHostnames)), valkey.DefaultWaitOptions)
+}
+
+// joins the pod at address to the cluster. returns its hostname
+func addPlanNode(ctx context.Context, env utils.Env, clusterTopology valkey.Topology, address string) (string, error) {
+	hostname, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid node address %s: %w", address, err)
+	}
+	newPort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid node address %s: %w", address, err)
+	}
+
+	cliBaseOptions, err := cliOptionsExcept(env, clusterTopology, "")
+	if err != nil {
+		return "", err
+	}
+	addNodeOptions := valkey.AddNodeOptions{
+		CliBaseOptions: cliBaseOptions,
+		NewHostname:    hostname,
+		NewPort:        uint16(newPort),
+	}
+	if err := valkey.AddNode(ctx, addNodeOptions); err != nil {
+		return "", err
+	}
+	return hostname, nil
+}
+
+func runAddMaster(ctx context.Context, env utils.Env, clusterTopology valkey.Topology, step PlanStep) error {
+	if node, joined := findPlanNode(clusterTopology, step.Node); joined {
+		if node.Master != "" {
+			return fmt.Errorf("pod %s is already a replica of %s. expected it to not be part of the cluster", node.Hostname, node.Master)
+		}
+		logging.FromContext(ctx).Info("Master already added", "hostname", node.Hostname)
+		return nil
+	}
+
+	hostname, err := addPlanNode(ctx, env, clusterTopology, step.Node.Address)
+	if err != nil {
+		return err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	hostnames := append(nodeAddresses(clusterTopology, ""), step.Node.Address)
+	if err := valkey.WaitForAllNodes(timeoutCtx, env, hostnames, valkey.KnowsHostname(hostname), valkey.DefaultWaitOptions); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("Master added", "hostname", hostname)
+	return nil
+}
+
+// adds the replica when it isn't part of the cluster yet and has it replicate the target master. a
+// replica that joined but was never attached (ie. an interrupted run) is attached as is
+func runAttachReplica(ctx context.Context, env utils.Env, clusterTopology valkey.Topology, step PlanStep) error {
+	if step.Target == nil {
+		return fmt.Errorf("%s step for %s has no master", step.Action, step.Node)
+	}
+	master, exists := findPlanNode(clusterTopology, *step.Target)
+	if !exists || master.Master != "" {
+		return fmt.Errorf("master %s not found in topology", step.Target)
+	}
+
+	replica, joined := findPlanNode(clusterTopology, step.Node)
+	if joined && replica.Master == master.ID {
+		logging.FromContext(ctx).Info("Replica already attached", "hostname", replica.Hostname, "master_id", master.ID)
+		return nil
+	}
+
+	hostnames := nodeAddresses(clusterTopology, "")
+	hostname := replica.Hostname
+	if !joined {
+		var err error
+		if hostname, err = addPlanNode(ctx, env, clusterTopology, step.Node.Address); err != nil {
+			return err
+		}
+		hostnames = append(hostnames, step.Node.Address)
+	}
+
+	if err := attachReplica(ctx, env, hostnames, hostname, step.Node.Address, master); err != nil {
+		return err
+	}
+	if joined && replica.Master != "" {
+		events.Normal(ctx, events.ReasonReplicaAttached, "Moved replica %s to master %s (%s) to spread the shard across failure domains",
+			hostname, master.ID, master.Hostname)
+	} else {
+		events.Normal(ctx, events.ReasonReplicaAttached, "Attached replica %s to master %s (%s)", hostname, master.ID, master.Hostname)
+	}
+	return nil
+}
+
+// has the replica at address replicate master and waits for every node at hostnames to see it
+func attachReplica(ctx context.Context, env utils.Env, hostnames []string, hostname, address string, master valkey.ClusterNode) error {
+	replicaClient, err := valkey.NewNodeClient(valkey.ReconcilerAuth(env), address)
+	if err != nil {
+		return err
+	}
+	defer replicaClient.Close()
+
+	// wait for metadata (master id) to be received by the replica via bus
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	if err := valkey.WaitForNode(timeoutCtx, replicaClient, valkey.KnowsNode(master.ID), valkey.DefaultWaitOptions); err != nil {
+		return err
+	}
+	if err := valkey.Replicate(replicaClient, master.ID); err != nil {
+		return fmt.Errorf("attach replica %s to master %s: %w", hostname, master.ID, err)
+	}
+
+	timeoutCtx, cancel = context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	if err := valkey.WaitForAllNodes(timeoutCtx, env, hostnames, valkey.HostnameIsReplicaOf(hostname, master.ID), valkey.DefaultWaitOptions); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("Replica attached", "hostname", hostname, "master_id", master.ID)
+	return nil
+}
+
+func runFailover(ctx context.Context, env utils.Env, clusterTopology valkey.Topology, step PlanStep) error {
+	leader, exists := findPlanNode(clusterTopology, step.Node)
+	if !exists {
+		return fmt.Errorf("node %s not found in topology", step.Node)
+	}
+	if leader.Master == "" {
+		logging.FromContext(ctx).Info("Node is already master", "hostname", leader.Hostname)
+		return nil
+	}
+
+	promoteOriginalShardLeaderOptions := valkey.PromoteOriginalShardLeaderOptions{
+		Auth:     valkey.ReconcilerAuth(env),
+		Shard:    valkey.Shard{MasterId: leader.Master},
+		Topology: clusterTopology,
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	newMasterHostname, newSlaveHostname, err := valkey.PromoteOriginalShardLeader(timeoutCtx, promoteOriginalShardLeaderOptions)
+	if err != nil {
+		return err
+	}
+	if newMasterHostname != leader.Hostname {
+		return fmt.Errorf("shard of %s failed over to %s instead", leader.Hostname, newMasterHostname)
+	}
+
+	leaderRestored := valkey.AllOf(valkey.HostnameIsMaster(newMasterHostname), valkey.HostnameIsReplica(newSlaveHostname))
+	timeoutCtx, cancel = context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	if err := valkey.WaitForAllNodes(timeoutCtx, env, nodeAddresses(clusterTopology, ""), leaderRestored, valkey.DefaultWaitOptions); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("Master moved", "hostname", newMasterHostname)
+	relabelPods(ctx, env)
+	return nil
+}
+
+func runMigrateSlots(ctx context.Context, env utils.Env, clusterTopology valkey.Topology, step PlanStep) error {
+	if step.Target == nil {
+		return fmt.Errorf("%s step for %s has no target", step.Action, step.Node)
+	}
+	source, exists := findPlanNode(clusterTopology, step.Node)
+	if !exists {
+		return fmt.Errorf("master %s not found in topology", step.Node)
+	}
+	target, exists := findPlanNode(clusterTopology, *step.Target)
+	if !exists {
+		return fmt.Errorf("master %s not found in topology", step.Target)
+	}
+
+	cliBaseOptions, err := cliOptionsExcept(env, clusterTopology, "")
+	if err != nil {
+		return err
+	}
+	rebalanceOptions := valkey.RebalanceOptions{
+		CliBaseOptions: cliBaseOptions,
+		Replace:        true,
+	}
+	return valkey.TransferSlots(ctx, rebalanceOptions, valkey.SlotTransfer{
+		SourceID: source.ID,
+		TargetID: target.ID,
+		Slots:    step.SlotRanges,
+	})
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+func TestFindPlanNode(t *testing.T) {
+	env := testEnv(2, 1)
+	clusterTopology, err := valkey.ClusterTopology(planNodes(2, 1))
+	if err != nil {
+		t.Fatalf("unexpected topology error: %v", err)
+	}
+	node3 := clusterTopology.OrderedNodes[3]
+
+	tests := []struct {
+		name   string
+		node   PlanNode
+		wantID string
+	}{
+		{name: "by id", node: PlanNode{ID: "node3", Address: node3.Address()}, wantID: "node3"},
+		// the pod now runs another node than the one the plan was made for
+		{name: "removed node", node: PlanNode{ID: "node7", Address: node3.Address()}},
+		{name: "new node that joined", node: PlanNode{Address: node3.Address()}, wantID: "node3"},
+		{name: "new node that hasn't joined", node: PlanNode{Address: utils.GetPodHeadlessServiceFQDN(env, 4) + ":6379"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, exists := findPlanNode(clusterTopology, test.node)
+			if exists != (test.wantID != "") || node.ID != test.wantID {
+				t.Errorf("findPlanNode() = %q, %v, want %q", node.ID, exists, test.wantID)
+			}
+		})
+	}
+}
+
+func TestReconcilePlanResumes(t *testing.T) {
+	clusterTopology, err := valkey.ClusterTopology(planNodes(3, 0))
+	if err != nil {
+		t.Fatalf("unexpected topology error: %v", err)
+	}
+	plan, err := PlanReconcile(clusterTopology, 3, testEnv(2, 1), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the interrupted run already drained node2 so planning again would see a different cluster
+	checkpoints := &checkpointer{resumed: &utils.Checkpoint{Operation: "reconcile", Plan: data, Completed: 2}}
+	resumed, completed, err := reconcilePlan(context.Background(), checkpoints, valkey.Topology{}, 3, testEnv(2, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if completed != 2 {
+		t.Errorf("completed = %d, want 2", completed)
+	}
+	if !reflect.DeepEqual(resumed, plan) {
+		t.Errorf("reconcilePlan() = %+v, want the stored plan %+v", resumed, plan)
+	}
+	if len(resumed.Steps[0].SlotRanges) == 0 {
+		t.Errorf("migrate-slots step lost its slot ranges: %+v", resumed.Steps[0])
+	}
+	if string(checkpoints.checkpoint.Plan) != string(data) {
+		t.Errorf("resumed plan isn't kept in the checkpoint")
+	}
+
+	checkpoints.resumed.Completed = len(plan.Steps) + 1
+	if _, _, err := reconcilePlan(context.Background(), checkpoints, valkey.Topology{}, 3, testEnv(2, 1)); err == nil {
+		t.Errorf("expected an error for more finished steps than the plan has")
+	}
+}
@@ -0,0 +1,237 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// PlanReconcile plans scale down, resizing the statefulset from pods to the desired size, scale up and
+// spreading replicas across failure domains as one sequence. scale up is planned against the cluster as
+// scale down would leave it so any mix of more/fewer masters and more/fewer replicas ends up in a single
+// ordered plan. Reconcile runs exactly these steps.
+func PlanReconcile(clusterTopology valkey.Topology, pods int, env utils.Env, placements map[int]utils.Placement) (ScalePlan, error) {
+	if healthy, err := clusterTopology.IsHealthy(); !healthy {
+		return ScalePlan{}, err
+	}
+	return planReconcile(clusterTopology, pods, env, placements)
+}
+
+// the caller checks the topology is healthy enough to plan against
+func planReconcile(clusterTopology valkey.Topology, pods int, env utils.Env, placements map[int]utils.Placement) (ScalePlan, error) {
+	if len(clusterTopology.Masters) == 0 {
+		return ScalePlan{}, fmt.Errorf("cluster has no masters")
+	}
+
+	plan := ScalePlan{Command: "reconcile", Current: topologyShape(clusterTopology), Desired: desiredShape(env)}
+	p := newPlanner(clusterTopology, env)
+	p.placements = placements
+
+	if err := p.scaleDown(clusterTopology, env); err != nil {
+		return ScalePlan{}, err
+	}
+
+	if pods != plan.Desired.Nodes {
+		p.steps = append(p.steps, PlanStep{
+			Action: PlanResize,
+			Node:   PlanNode{Address: utils.GetStatefulsetName(env)},
+			Pods:   plan.Desired.Nodes,
+			Reason: fmt.Sprintf("statefulset has %d pods", pods),
+		})
+	}
+
+	scaledDown, err := p.topology()
+	if err != nil {
+		return ScalePlan{}, err
+	}
+	if err := p.scaleUp(scaledDown, env); err != nil {
+		return ScalePlan{}, err
+	}
+	if err := p.spread(); err != nil {
+		return ScalePlan{}, err
+	}
+
+	plan.Steps = p.steps
+	return plan, nil
+}
+
+// Reconcile converges the cluster from whatever shape it is in to the desired one: an uninitialized
+// cluster is created, pods removed from the statefulset behind the reconciler's back are brought back,
+// pods that lost their data are replaced and then the steps PlanReconcile plans are run one by one.
+// running it again once the cluster has the desired shape changes nothing. changed is false when there
+// was nothing to do.
+//
+// NOTE: the caller has to hold the lock
+func Reconcile(ctx context.Context, clientset kubernetes.Interface, env utils.Env) (changed bool, err error) {
+	ctx = logging.With(ctx, "operation", "reconcile")
+	logger := logging.FromContext(ctx)
+	logger.Info("Reconciling Valkey cluster", "masters", env.Masters, "replicas_per_master", env.ReplicasPerMaster)
+
+	step := "plan"
+	defer func(startTime time.Time) {
+		observeOperation(ctx, "reconcile", step, startTime, err)
+	}(time.Now())
+
+	statefulSetName := utils.GetStatefulsetName(env)
+	desiredNodeCount := env.Masters + env.Masters*env.ReplicasPerMaster
+
+	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(ctx, env)
+	if err != nil {
+		return false, err
+	}
+	if len(clusterClientHostnames) == 0 {
+		// no ready pod is in a cluster but pods that aren't ready could be. scaling them away would drop slots
+		if err := valkey.CheckUninitialized(ctx, env); err != nil {
+			return false, fmt.Errorf("no pod answered as part of a cluster but can't tell it isn't initialized: %w", err)
+		}
+		logger.Info("Cluster is not initialized")
+		step = "init"
+		if err := utils.ScaleStatefulSet(ctx, clientset, env.Namespace, statefulSetName, desiredNodeCount); err != nil {
+			return false, err
+		}
+		return true, Init(ctx, env)
+	}
+
+	clusterTopology, err := liveClusterTopology(ctx, env)
+	if err != nil {
+		return false, err
+	}
+	pods, err := utils.GetStatefulSetReplicas(ctx, clientset, env.Namespace, statefulSetName)
+	if err != nil {
+		return false, err
+	}
+
+	// the missing pods still hold slots/replicas. they have to come back before scale down can drain them
+	if clusterNodeCount := len(clusterTopology.OrderedNodes); pods < clusterNodeCount {
+		step = "restore-pods"
+		logger.Info("StatefulSet has fewer pods than the cluster has nodes. Restoring pods before scaling", "pods", pods, "nodes", clusterNodeCount)
+		if err := resizeStatefulSet(ctx, clientset, env, clusterNodeCount); err != nil {
+			return true, err
+		}
+		changed, pods = true, clusterNodeCount
+		clusterTopology, err = liveClusterTopology(ctx, env)
+		if err != nil {
+			return changed, err
+		}
+	}
+
+	if len(valkey.StaleNodes(clusterTopology)) > 0 {
+		step = "replace-lost-nodes"
+		replaced, err := ReplaceLostNodes(ctx, env)
+		if err != nil {
+			return replaced > 0, err
+		}
+		changed = changed || replaced > 0
+		clusterTopology, err = liveClusterTopology(ctx, env)
+		if err != nil {
+			return changed, err
+		}
+	}
+
+	// an interrupted scale-up or scale-down is finished by the same command before anything is planned.
+	// it has to be for the same shape, otherwise the plan could take away pods it still needs
+	checkpoint, err := utils.LoadCheckpoint(ctx, clientset, env)
+	if err != nil {
+		return changed, err
+	}
+	if checkpoint != nil && checkpoint.Operation != "reconcile" {
+		if err := checkResumable(*checkpoint, checkpoint.Operation, env); err != nil {
+			return changed, err
+		}
+		logger.Info("Previous operation was interrupted, finishing it first", "resumed_operation", checkpoint.Operation, "step", checkpoint.Phase)
+		step = checkpoint.Operation
+		if checkpoint.Operation == "scale-up" {
+			if err := resizeStatefulSet(ctx, clientset, env, desiredNodeCount); err != nil {
+				return true, err
+			}
+			err = ScaleUp(ctx, env)
+		} else {
+			err = ScaleDown(ctx, env)
+		}
+		if err != nil {
+			return true, err
+		}
+		changed = true
+
+		step = "plan"
+		if clusterTopology, err = liveClusterTopology(ctx, env); err != nil {
+			return changed, err
+		}
+		if pods, err = utils.GetStatefulSetReplicas(ctx, clientset, env.Namespace, statefulSetName); err != nil {
+			return changed, err
+		}
+	}
+
+	checkpoints, err := startCheckpoint(ctx, env, "reconcile")
+	if err != nil {
+		return changed, err
+	}
+	if err := checkpoints.checkTopology(clusterTopology); err != nil {
+		return changed, fmt.Errorf("cluster is unhealthy: %w", err)
+	}
+	plan, completed, err := reconcilePlan(ctx, checkpoints, clusterTopology, pods, env)
+	if err != nil {
+		return changed, err
+	}
+	if completed == len(plan.Steps) {
+		logger.Info("Cluster already has the desired shape")
+		checkpoints.done(ctx)
+		return changed, nil
+	}
+	logger.Info("Running reconcile plan", "steps", len(plan.Steps), "completed", completed)
+
+	for i := completed; i < len(plan.Steps); i++ {
+		planStep := plan.Steps[i]
+		step = string(planStep.Action)
+		checkpoints.checkpoint.Completed = i
+		checkpoints.phase(ctx, step, fmt.Sprintf("step %d of %d: %s", i+1, len(plan.Steps), planStep.Node))
+		if err := runPlanStep(ctx, clientset, env, planStep); err != nil {
+			return true, fmt.Errorf("step %d (%s %s): %w", i+1, planStep.Action, planStep.Node, err)
+		}
+	}
+
+	checkpoints.done(ctx)
+	logger.Info("Cluster reconciled")
+	return true, nil
+}
+
+// the plan an interrupted reconcile left behind with the steps it finished, otherwise a new plan. the
+// plan is stored in the checkpoint before the first step runs
+func reconcilePlan(ctx context.Context, checkpoints *checkpointer, clusterTopology valkey.Topology, pods int, env utils.Env) (ScalePlan, int, error) {
+	if resumed := checkpoints.resumed; resumed != nil && len(resumed.Plan) > 0 {
+		var plan ScalePlan
+		if err := json.Unmarshal(resumed.Plan, &plan); err != nil {
+			return ScalePlan{}, 0, fmt.Errorf("decode the interrupted reconcile plan: %w", err)
+		}
+		if resumed.Completed < 0 || resumed.Completed > len(plan.Steps) {
+			return ScalePlan{}, 0, fmt.Errorf("interrupted reconcile finished %d of %d steps", resumed.Completed, len(plan.Steps))
+		}
+		checkpoints.checkpoint.Plan = resumed.Plan
+		return plan, resumed.Completed, nil
+	}
+
+	plan, err := planReconcile(clusterTopology, pods, env, podPlacements(ctx, env))
+	if err != nil {
+		return ScalePlan{}, 0, fmt.Errorf("plan reconcile: %w", err)
+	}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return ScalePlan{}, 0, fmt.Errorf("encode reconcile plan: %w", err)
+	}
+	checkpoints.checkpoint.Plan = data
+	return plan, 0, nil
+}
+
+func liveStatefulSetReplicas(ctx context.Context, env utils.Env) (int, error) {
+	clientset, err := utils.NewKubernetesClient()
+	if err != nil {
+		return 0, err
+	}
+	return utils.GetStatefulSetReplicas(ctx, clientset, env.Namespace, utils.GetStatefulsetName(env))
+}
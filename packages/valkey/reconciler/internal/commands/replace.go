@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+// ReplaceLostNodes is replaceLostNodes with its own client for callers that don't have one (the
+// controller)
+func ReplaceLostNodes(ctx context.Context, env utils.Env) (replaced int, err error) {
+	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(ctx, env)
+	if err != nil {
+		return 0, err
+	}
+	client, err := valkey.NewClient(valkey.ReconcilerAuth(env), clusterClientHostnames...)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	clusterTopology, err := valkey.GetClusterTopology(client)
+	if err != nil {
+		return 0, err
+	}
+	_, replaced, err = replaceLostNodes(ctx, env, client, clusterTopology)
+	return replaced, err
+}
+
+// replaceLostNodes looks for pods that came back as a fresh node (their data was lost) while the cluster
+// still has their old node in fail/noaddr, and swaps the old node for the new one. lost masters go
+// first so their replicas have a master to go back to. returns the topology after the replacements.
+func replaceLostNodes(ctx context.Context, env utils.Env, client *valkey.ValkeyClient, clusterTopology valkey.Topology) (valkey.Topology, int, error) {
+	logger := logging.FromContext(ctx)
+	replaced := 0
+	for {
+		replacement, found, err := findLostNode(ctx, env, clusterTopology)
+		if err != nil || !found {
+			return clusterTopology, replaced, err
+		}
+
+		if err := valkey.ReplaceNode(ctx, valkey.ReplaceNodeOptions{
+			Auth:        valkey.ReconcilerAuth(env),
+			Replacement: replacement,
+			Topology:    clusterTopology,
+			BusPort:     env.BusPort,
+		}); err != nil {
+			return clusterTopology, replaced, fmt.Errorf("replace node %s: %w", replacement.Stale.ID, err)
+		}
+		replaced++
+
+		if err := client.Refresh(); err != nil {
+			return clusterTopology, replaced, err
+		}
+		clusterTopology, err = valkey.GetClusterTopology(client)
+		if err != nil {
+			return clusterTopology, replaced, err
+		}
+		logger.Info("Replaced node", "node_id", replacement.Stale.ID, "new_node_id", replacement.New.ID, "topology", clusterTopology)
+		// a lost master is replaced by failing over to one of its replicas
+		relabelPods(ctx, env)
+	}
+}
+
+func findLostNode(ctx context.Context, env utils.Env, clusterTopology valkey.Topology) (valkey.NodeReplacement, bool, error) {
+	staleNodes := valkey.StaleNodes(clusterTopology)
+	slices.SortStableFunc(staleNodes, func(a, b valkey.ClusterNode) int {
+		return boolOrder(a.Master == "", b.Master == "")
+	})
+
+	for _, stale := range staleNodes {
+		podAddress := utils.GetPodAddress(env, stale.Index())
+		podClient, err := valkey.NewNodeClient(valkey.ReconcilerAuth(env), podAddress)
+		if err != nil {
+			// the pod is still down. nothing to replace it with yet
+			logging.FromContext(ctx).Debug("Pod of unreachable node is down", "node_id", stale.ID, "address", podAddress, "error", err)
+			continue
+		}
+		podNodes, err := valkey.ClusterNodes(podClient)
+		podClient.Close()
+		if err != nil {
+			return valkey.NodeReplacement{}, false, err
+		}
+
+		if replacement, ok := valkey.PlanNodeReplacement(clusterTopology, stale, podAddress, podNodes); ok {
+			return replacement, true, nil
+		}
+	}
+	return valkey.NodeReplacement{}, false, nil
+}
+
+// sorts true before false
+func boolOrder(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return -1
+	default:
+		return 1
+	}
+}
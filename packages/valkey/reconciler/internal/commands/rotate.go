@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// the acl user rotate-credentials changes the other users' passwords as
+const credentialsAdminUser = "admin"
+
+// RotateCredentials gives every one of users a new password without restarting the nodes:
+//  1. the new password is added next to the old one on every node and checked by logging in with it
+//  2. the new password is written to the credentials secret
+//  3. the old password is removed on every node and the users are saved to the aclfile
+//
+// the secret is written before any old password is removed so an interrupted rotation never leaves a
+// password that isn't in the secret. running it again finishes the job (with another new password)
+func RotateCredentials(ctx context.Context, clientset kubernetes.Interface, env utils.Env, users []string) (err error) {
+	ctx = logging.With(ctx, "operation", "rotate-credentials")
+	logger := logging.FromContext(ctx)
+	defer func(startTime time.Time) {
+		observeOperation(ctx, "rotate-credentials", "rotate-credentials", startTime, err)
+	}(time.Now())
+
+	if err := validateRotation(env.Credentials, users); err != nil {
+		return err
+	}
+
+	data, err := utils.GetSecretData(ctx, clientset, env.Namespace, env.Credentials.Secret)
+	if err != nil {
+		return err
+	}
+	adminPassword := string(data[env.Credentials.Keys[credentialsAdminUser]])
+	if adminPassword == "" {
+		return fmt.Errorf("secret %s has no %s password", env.Credentials.Secret, credentialsAdminUser)
+	}
+
+	replicas, err := utils.GetStatefulSetReplicas(ctx, clientset, env.Namespace, utils.GetStatefulsetName(env))
+	if err != nil {
+		return err
+	}
+	addresses := make([]string, 0, replicas)
+	for i := range replicas {
+		addresses = append(addresses, utils.GetPodAddress(env, i))
+	}
+
+	newPasswords := make(map[string]string, len(users))
+	for _, user := range users {
+		if newPasswords[user], err = generatePassword(); err != nil {
+			return err
+		}
+	}
+
+	// 1. add & check the new passwords. a node that can't be reached would reject the new passwords once
+	// the secret changes so nothing else happens until every node has them
+	adminAuth := valkey.Auth{Username: credentialsAdminUser, Password: adminPassword, TLS: env.TLS}
+	for _, address := range addresses {
+		if err := forEachUser(ctx, adminAuth, address, users, func(client *valkey.ValkeyClient, user string) error {
+			return valkey.AddPassword(ctx, client, user, newPasswords[user])
+		}); err != nil {
+			return err
+		}
+		for _, user := range users {
+			userClient, err := valkey.NewNodeClient(valkey.Auth{Username: user, Password: newPasswords[user], TLS: env.TLS}, address)
+			if err != nil {
+				return fmt.Errorf("log in to %s as %s with the new password: %w", address, user, err)
+			}
+			userClient.Close()
+		}
+		logger.Info("Added new passwords", "address", address, "users", users)
+	}
+
+	// 2. the secret is the source of truth from here on
+	secretData := make(map[string]string, len(users))
+	for _, user := range users {
+		secretData[env.Credentials.Keys[user]] = newPasswords[user]
+	}
+	if err := utils.UpdateSecretData(ctx, clientset, env.Namespace, env.Credentials.Secret, secretData); err != nil {
+		return err
+	}
+	logger.Info("Wrote new passwords to the secret", "secret", env.Credentials.Secret)
+
+	// 3. drop the old passwords (and any left over from an interrupted rotation)
+	if newPassword, rotated := newPasswords[credentialsAdminUser]; rotated {
+		adminAuth.Password = newPassword
+	}
+	for _, address := range addresses {
+		if err := forEachUser(ctx, adminAuth, address, users, func(client *valkey.ValkeyClient, user string) error {
+			return valkey.SetPassword(ctx, client, user, newPasswords[user])
+		}); err != nil {
+			return err
+		}
+		logger.Info("Removed old passwords", "address", address, "users", users)
+	}
+
+	events.Normal(ctx, events.ReasonCredentialsRotated, "Rotated the passwords of %s on %d nodes", strings.Join(users, ", "), len(addresses))
+	return nil
+}
+
+// runs apply for every user on the node at address then saves the users to its aclfile
+func forEachUser(ctx context.Context, auth valkey.Auth, address string, users []string, apply func(*valkey.ValkeyClient, string) error) error {
+	client, err := valkey.NewNodeClient(auth, address)
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", address, err)
+	}
+	defer client.Close()
+
+	for _, user := range users {
+		if err := apply(client, user); err != nil {
+			return fmt.Errorf("%s: %w", address, err)
+		}
+	}
+	if err := valkey.SaveACL(ctx, client); err != nil {
+		return fmt.Errorf("%s: %w", address, err)
+	}
+	return nil
+}
+
+func validateRotation(credentials utils.Credentials, users []string) error {
+	if credentials.Secret == "" {
+		return fmt.Errorf("CREDENTIALS_SECRET environment variable is not set")
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("no users to rotate")
+	}
+	if _, exists := credentials.Keys[credentialsAdminUser]; !exists {
+		return fmt.Errorf("no secret key for the %s password", credentialsAdminUser)
+	}
+	for i, user := range users {
+		if _, exists := credentials.Keys[user]; !exists {
+			known := make([]string, 0, len(credentials.Keys))
+			for name := range credentials.Keys {
+				known = append(known, name)
+			}
+			slices.Sort(known)
+			return fmt.Errorf("can't rotate acl user %q. users: %s", user, strings.Join(known, ", "))
+		}
+		if slices.Contains(users[:i], user) {
+			return fmt.Errorf("acl user %q listed twice", user)
+		}
+	}
+	return nil
+}
+
+// 32 random bytes, hex encoded so it is safe in users.acl, the cli and shell scripts
+func generatePassword() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate password: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"testing"
+	"valkey/reconciler/internal/utils"
+)
+
+func TestValidateRotation(t *testing.T) {
+	credentials := utils.Credentials{
+		Secret: "valkey-test-creds",
+		Keys:   map[string]string{"admin": "ADMIN_PASSWORD", "client": "CLIENT_PASSWORD", "reconciler": "RECONCILER_PASSWORD"},
+	}
+
+	tests := []struct {
+		name        string
+		credentials utils.Credentials
+		users       []string
+		wantErr     bool
+	}{
+		{name: "both users", credentials: credentials, users: []string{"admin", "client"}},
+		{name: "only the client", credentials: credentials, users: []string{"client"}},
+		{name: "the reconciler", credentials: credentials, users: []string{"reconciler"}},
+		{name: "no secret", credentials: utils.Credentials{Keys: credentials.Keys}, users: []string{"client"}, wantErr: true},
+		{name: "no users", credentials: credentials, wantErr: true},
+		{name: "unknown user", credentials: credentials, users: []string{"default"}, wantErr: true},
+		{name: "user listed twice", credentials: credentials, users: []string{"client", "client"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateRotation(test.credentials, test.users)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validateRotation() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	first, err := generatePassword()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := generatePassword()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first) != 64 {
+		t.Errorf("password length = %d, want 64", len(first))
+	}
+	if first == second {
+		t.Errorf("generated the same password twice: %s", first)
+	}
+}
@@ -3,27 +3,32 @@ package commands
 import (
 	"context"
 	"fmt"
-	"sort"
+	"slices"
 	"strings"
 	"time"
+	"valkey/reconciler/internal/logging"
 	"valkey/reconciler/internal/utils"
 	"valkey/reconciler/internal/valkey"
-
-	valkeygo "github.com/valkey-io/valkey-go"
 )
 
-func ScaleDown(env utils.Env) error {
-	fmt.Println("=== Valkey Cluster Scaling Down ===")
+func ScaleDown(ctx context.Context, env utils.Env) (err error) {
+	ctx = logging.With(ctx, "operation", "scale-down")
+	logger := logging.FromContext(ctx)
+	logger.Info("Scaling down Valkey cluster", "masters", env.Masters, "replicas_per_master", env.ReplicasPerMaster)
+
+	checkpoints, err := startCheckpoint(ctx, env, "scale-down")
+	if err != nil {
+		return err
+	}
+	defer func(startTime time.Time) {
+		observeOperation(ctx, "scale-down", checkpoints.step(), startTime, err)
+	}(time.Now())
 
-	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(utils.GetHeadlessServiceFQDN(env.ClusterName, env.Namespace), env)
+	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(ctx, env)
 	if err != nil {
 		return err
 	}
-	client, err := valkey.NewClient(valkeygo.ClientOption{
-		InitAddress: clusterClientHostnames,
-		Username:    valkey.AdminUser,
-		Password:    env.AdminPassword,
-	})
+	client, err := valkey.NewClient(valkey.ReconcilerAuth(env), clusterClientHostnames...)
 	if err != nil {
 		return err
 	}
@@ -33,43 +38,42 @@ func ScaleDown(env utils.Env) error {
 	if err != nil {
 		return err
 	}
-	if healthy, err := clusterTopology.IsHealthy(); !healthy {
+	clusterTopology, _, err = replaceLostNodes(ctx, env, client, clusterTopology)
+	if err != nil {
+		return err
+	}
+	if err := checkpoints.checkTopology(clusterTopology); err != nil {
 		return err
 	}
 
-	valkey.PrintClusterInfo(client)
-	valkey.PrintClusterNodes(client)
-	fmt.Println()
+	valkey.LogClusterInfo(ctx, client)
+	valkey.LogClusterNodes(ctx, client)
 
 	currentMasterCount := len(clusterTopology.Masters)
 	currentSlaveCount := len(clusterTopology.Slaves)
 	originalClusterNodeCount := len(clusterTopology.OrderedNodes)
 	nodeCount := originalClusterNodeCount
 	currentReplicasPerMaster := currentSlaveCount / currentMasterCount
+	phases := decideScaleDown(clusterTopology, env)
 
 	desiredNodeCount := env.Masters + env.Masters*env.ReplicasPerMaster
 
-	fmt.Printf("Current cluster information:\n")
-	fmt.Printf("  Masters: %d\n", currentMasterCount)
-	fmt.Printf("  Slaves: %d\n", currentSlaveCount)
-	fmt.Printf("  Total nodes: %d\n", originalClusterNodeCount)
-	fmt.Printf("  Replicas per master: %d\n", currentReplicasPerMaster)
-	fmt.Println()
-
-	fmt.Printf("Desired total nodes: %d\n", desiredNodeCount)
-	fmt.Println()
+	logger.Info("Current cluster",
+		"masters", currentMasterCount,
+		"replicas", currentSlaveCount,
+		"total_nodes", originalClusterNodeCount,
+		"replicas_per_master", currentReplicasPerMaster,
+		"desired_total_nodes", desiredNodeCount,
+	)
 
 	lastColonIndex := strings.LastIndex(clusterClientHostnames[0], ":")
 	cliHostname := clusterClientHostnames[0][:lastColonIndex]
 	cliBaseOptions := valkey.CliBaseOptions{
 		Connection: valkey.Connection{
 			Hostname: cliHostname,
-			Port:     uint16(6379),
-		},
-		Auth: valkey.Auth{
-			Username: valkey.AdminUser,
-			Password: env.AdminPassword,
+			Port:     uint16(env.ClientPort),
 		},
+		Auth: valkey.ReconcilerAuth(env),
 	}
 
 	helperOptions := &scaleDownOptions{
@@ -78,42 +82,48 @@ func ScaleDown(env utils.Env) error {
 		topology:       &clusterTopology,
 		nodeCount:      &nodeCount,
 		cliBaseOptions: cliBaseOptions,
+		checkpoints:    checkpoints,
 	}
 
-	if currentMasterCount > env.Masters {
-		if err := removeShards(helperOptions); err != nil {
+	if phases.removeShards {
+		checkpoints.phase(ctx, "remove-shards", "")
+		if err := removeShards(ctx, helperOptions); err != nil {
 			return err
 		}
-	} else if currentMasterCount < env.Masters {
-		if err := makeRoomForMasters(helperOptions); err != nil {
+	} else if phases.makeRoom {
+		checkpoints.phase(ctx, "make-room-for-masters", "")
+		if err := makeRoomForMasters(ctx, helperOptions); err != nil {
 			return err
 		}
 	}
 
-	if currentReplicasPerMaster > env.ReplicasPerMaster {
-		if err := removeReplicasFromMasters(helperOptions); err != nil {
+	if phases.removeReplicas {
+		checkpoints.phase(ctx, "remove-replicas", "")
+		if err := removeReplicasFromMasters(ctx, helperOptions); err != nil {
 			return err
 		}
 	}
 
-	if originalClusterNodeCount <= desiredNodeCount {
-		fmt.Println("No need to scale down nodes")
-		valkey.PrintClusterInfo(client)
-		valkey.PrintClusterNodes(client)
-		fmt.Println("=== Scale Down Complete ===")
+	if !phases.removeDangerZone {
+		logger.Info("No need to scale down nodes")
+		valkey.LogClusterInfo(ctx, client)
+		valkey.LogClusterNodes(ctx, client)
+		checkpoints.done(ctx)
 		return nil
 	}
 
-	if err := moveMastersToSafeSpots(helperOptions); err != nil {
+	checkpoints.phase(ctx, "move-masters-to-safe-spots", "")
+	if err := moveMastersToSafeSpots(ctx, helperOptions); err != nil {
 		return err
 	}
 
-	if err := removeDangerZoneNodes(helperOptions); err != nil {
+	checkpoints.phase(ctx, "remove-danger-zone-nodes", "")
+	if err := removeDangerZoneNodes(ctx, helperOptions); err != nil {
 		return err
 	}
 
-	valkey.PrintClusterNodes(client)
-	fmt.Println("=== Scale Down Complete ===")
+	valkey.LogClusterNodes(ctx, client)
+	checkpoints.done(ctx)
 	return nil
 }
 
@@ -123,23 +133,39 @@ type scaleDownOptions struct {
 	topology       *valkey.Topology
 	nodeCount      *int
 	cliBaseOptions valkey.CliBaseOptions
+	checkpoints    *checkpointer
+}
+
+func nodeIDs(nodes []valkey.ClusterNode) []string {
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+	return ids
 }
 
-func removeShards(options *scaleDownOptions) error {
-	fmt.Println("Removing shards...")
+func maxReplicasPerMaster(clusterTopology valkey.Topology) int {
+	mostReplicas := 0
+	for _, masterNode := range clusterTopology.Masters {
+		mostReplicas = max(mostReplicas, len(masterNode.SlaveIds))
+	}
+	return mostReplicas
+}
 
+func removeShards(ctx context.Context, options *scaleDownOptions) error {
+	logger := logging.FromContext(ctx)
 	client, clusterTopology, env := options.client, *options.topology, options.env
-	currentMasterCount := len(clusterTopology.Masters)
-	currentSlaveCount := len(clusterTopology.Slaves)
-	currentReplicasPerMaster := currentSlaveCount / currentMasterCount
 
-	shardsToRemove := clusterTopology.OrderedShards[env.Masters:]
-	removedNodeHostnames := make(map[string]struct{}, len(shardsToRemove)*currentReplicasPerMaster)
+	shards := shardsToRemove(clusterTopology, env)
+	removedNodeHostnames := make(map[string]struct{}, len(shards)*(1+maxReplicasPerMaster(clusterTopology)))
 
-	fmt.Println("Shards to remove:")
-	for _, shard := range shardsToRemove {
-		fmt.Printf("  Master ID: %s\n", shard.MasterId)
+	shardMasterIds := make([]string, len(shards))
+	for i, shard := range shards {
+		shardMasterIds[i] = shard.MasterId
+	}
+	logger.Info("Removing shards", "master_ids", shardMasterIds)
 
+	for _, shard := range shards {
 		masterNode, exists := clusterTopology.Masters[shard.MasterId]
 		if !exists {
 			return fmt.Errorf("master %s not found in topology", shard.MasterId)
@@ -153,19 +179,22 @@ func removeShards(options *scaleDownOptions) error {
 			removedNodeHostnames[fmt.Sprintf("%s:%d", slaveNode.Hostname, slaveNode.Port)] = struct{}{}
 		}
 
+		options.checkpoints.phase(ctx, "remove-shards", fmt.Sprintf("shard %s", shard.MasterId))
 		forgetShardOptions := valkey.DelShardOptions{
 			Shard:    shard,
 			Topology: clusterTopology,
 			Env:      env,
 		}
-		newClusterTopology, err := valkey.DelShard(forgetShardOptions)
+		newClusterTopology, err := valkey.DelShard(ctx, forgetShardOptions)
 		if err != nil {
 			return err
 		}
 		clusterTopology = newClusterTopology
+		logger.Info("Shard removed", "master_id", shard.MasterId)
 	}
 
-	*options.nodeCount -= len(shardsToRemove) + len(shardsToRemove)*currentReplicasPerMaster
+	// count what was actually removed. a resumed run can have shards that already lost some replicas
+	*options.nodeCount -= len(removedNodeHostnames)
 
 	leftOverNodeHostnames := make([]string, 0, *options.nodeCount)
 	for _, node := range clusterTopology.OrderedNodes {
@@ -175,13 +204,9 @@ func removeShards(options *scaleDownOptions) error {
 		}
 	}
 
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
-	if err := valkey.WaitForAllNodesClusterInfoState(
-		timeoutCtx,
-		env,
-		leftOverNodeHostnames,
-		fmt.Sprintf("cluster_known_nodes:%d", *options.nodeCount)); err != nil {
+	if err := valkey.WaitForAllNodesClusterInfo(timeoutCtx, env, leftOverNodeHostnames, valkey.KnownNodesAre(*options.nodeCount), valkey.DefaultWaitOptions); err != nil {
 		return err
 	}
 
@@ -194,47 +219,31 @@ func removeShards(options *scaleDownOptions) error {
 	}
 	options.topology = &clusterTopology
 
-	clusterTopology.Print()
-	fmt.Println("✓ Shards removed")
-	valkey.PrintClusterNodes(client)
+	logger.Info("Shards removed", "topology", clusterTopology)
+	valkey.LogClusterNodes(ctx, client)
 	return nil
 }
 
-func makeRoomForMasters(options *scaleDownOptions) error {
-	fmt.Println("Making room for new masters in safe spots...")
-
+func makeRoomForMasters(ctx context.Context, options *scaleDownOptions) error {
+	logger := logging.FromContext(ctx)
 	client, env, clusterTopology := options.client, options.env, *options.topology
-	currentMasterCount := len(clusterTopology.Masters)
 
-	var nodesToRemove []valkey.ClusterNode
-	var leftOverNodes []valkey.ClusterNode
-	if env.Masters > *options.nodeCount {
-		nodesToRemove = clusterTopology.OrderedNodes[currentMasterCount:]
-		leftOverNodes = make([]valkey.ClusterNode, currentMasterCount)
-		copy(leftOverNodes, clusterTopology.OrderedNodes[:currentMasterCount])
-	} else {
-		nodesToRemove = clusterTopology.OrderedNodes[currentMasterCount:env.Masters]
-		leftOverNodes = make([]valkey.ClusterNode, 0, len(clusterTopology.OrderedNodes)-(env.Masters-currentMasterCount))
-		leftOverNodes = append(leftOverNodes, clusterTopology.OrderedNodes[:currentMasterCount]...)
-		leftOverNodes = append(leftOverNodes, clusterTopology.OrderedNodes[env.Masters:]...)
-	}
-	leftOverNodeHostnames := make([]string, 0, len(leftOverNodes))
-	for _, node := range leftOverNodes {
-		leftOverNodeHostnames = append(leftOverNodeHostnames, fmt.Sprintf("%s:%d", node.Hostname, node.Port))
+	nodesToRemove := nodesInTheWayOfMasters(clusterTopology, env)
+	leftOverNodeHostnames := make([]string, 0, len(clusterTopology.OrderedNodes)-len(nodesToRemove))
+	for _, node := range clusterTopology.OrderedNodes {
+		if !slices.ContainsFunc(nodesToRemove, func(removed valkey.ClusterNode) bool { return removed.ID == node.ID }) {
+			leftOverNodeHostnames = append(leftOverNodeHostnames, fmt.Sprintf("%s:%d", node.Hostname, node.Port))
+		}
 	}
 
-	fmt.Println("Nodes to remove:")
-	for _, node := range nodesToRemove {
-		fmt.Printf("  %s\n", node.ID)
-	}
-	fmt.Println()
+	logger.Info("Making room for new masters in safe spots", "node_ids", nodeIDs(nodesToRemove))
 
 	for _, node := range nodesToRemove {
 		if node.Master == "" {
 			// NOTE: because the topology is healthy at the start of scale down function,
 			// we should only be removing replicas. If we encounter a master, that means that there is a
 			// pod in the safe zone
-			fmt.Println("Node is a master, moving master to a safe spot...")
+			logger.Info("Node is a master, moving master to a safe spot", "node_id", node.ID)
 
 			var shard valkey.Shard
 			for _, shard = range clusterTopology.OrderedShards {
@@ -247,45 +256,38 @@ func makeRoomForMasters(options *scaleDownOptions) error {
 			}
 
 			promoteOriginalShardLeaderOptions := valkey.PromoteOriginalShardLeaderOptions{
-				ClusterClient: client.Client,
-				Shard:         shard,
-				Topology:      clusterTopology,
+				Auth:     valkey.ReconcilerAuth(env),
+				Shard:    shard,
+				Topology: clusterTopology,
 			}
-			timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 			defer cancel()
 			newMasterHostname, newSlaveHostname, err := valkey.PromoteOriginalShardLeader(timeoutCtx, promoteOriginalShardLeaderOptions)
 			if err != nil {
 				return err
 			}
 
-			newMasterMatchingStrings := []string{
-				fmt.Sprintf("%s master", newMasterHostname),
-				fmt.Sprintf("%s myself,master", newMasterHostname),
-			}
-			newSlaveMatchingStrings := []string{
-				fmt.Sprintf("%s slave", newSlaveHostname),
-				fmt.Sprintf("%s myself,slave", newSlaveHostname),
-			}
-			newlyReshardedOriginalLeaderStringMatches := [][]string{newMasterMatchingStrings, newSlaveMatchingStrings}
-			timeoutCtx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+			leaderRestored := valkey.AllOf(valkey.HostnameIsMaster(newMasterHostname), valkey.HostnameIsReplica(newSlaveHostname))
+			timeoutCtx, cancel = context.WithTimeout(ctx, 5*time.Minute)
 			defer cancel()
-			if err := valkey.WaitForAllNodesClusterNodeContains(timeoutCtx, env, leftOverNodeHostnames, newlyReshardedOriginalLeaderStringMatches...); err != nil {
+			if err := valkey.WaitForAllNodes(timeoutCtx, env, leftOverNodeHostnames, leaderRestored, valkey.DefaultWaitOptions); err != nil {
 				return err
 			}
 
-			fmt.Println("✓ Master moved to safe spot")
+			logger.Info("Master moved to safe spot", "hostname", newMasterHostname)
+			relabelPods(ctx, env)
 		}
 
-		if err := valkey.DelNode(valkey.DelNodeOptions{CliBaseOptions: options.cliBaseOptions, NodeID: node.ID}); err != nil {
+		if err := valkey.DelNode(ctx, valkey.DelNodeOptions{CliBaseOptions: options.cliBaseOptions, NodeID: node.ID}); err != nil {
 			return err
 		}
 	}
 
 	*options.nodeCount -= len(nodesToRemove)
 
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
-	if err := valkey.WaitForAllNodesClusterInfoState(timeoutCtx, env, leftOverNodeHostnames, fmt.Sprintf("cluster_known_nodes:%d", *options.nodeCount)); err != nil {
+	if err := valkey.WaitForAllNodesClusterInfo(timeoutCtx, env, leftOverNodeHostnames, valkey.KnownNodesAre(*options.nodeCount), valkey.DefaultWaitOptions); err != nil {
 		return err
 	}
 
@@ -298,56 +300,31 @@ func makeRoomForMasters(options *scaleDownOptions) error {
 	}
 	options.topology = &clusterTopology
 
-	clusterTopology.Print()
-	fmt.Println("✓ Nodes removed")
-	fmt.Println()
-
+	logger.Info("Nodes removed", "topology", clusterTopology)
 	return nil
 }
 
-func removeReplicasFromMasters(options *scaleDownOptions) error {
-	fmt.Println("Removing replicas...")
-
+func removeReplicasFromMasters(ctx context.Context, options *scaleDownOptions) error {
+	logger := logging.FromContext(ctx)
 	client, clusterTopology, env := options.client, *options.topology, options.env
-	clusterTopology.Print()
+	logger.Info("Removing replicas", "topology", clusterTopology)
 
 	removedNodeHostnames := map[string]struct{}{}
 
-	for _, masterNode := range clusterTopology.Masters {
-		if len(masterNode.SlaveIds) <= env.ReplicasPerMaster {
-			continue
-		}
-
-		slaveNodes := make([]valkey.ClusterNode, 0, len(masterNode.SlaveIds))
-		for _, slaveId := range masterNode.SlaveIds {
-			slaveNode, exists := clusterTopology.Slaves[slaveId]
-			if !exists {
-				return fmt.Errorf("slave %s not found in topology", slaveId)
-			}
-			slaveNodes = append(slaveNodes, slaveNode)
-		}
-
-		sort.Slice(slaveNodes, func(i, j int) bool {
-			return slaveNodes[i].Index() < slaveNodes[j].Index()
-		})
-
-		nodesToDelete := slaveNodes[env.ReplicasPerMaster:] // remove the replicas from the later statefulset pod indices
-		fmt.Printf("Nodes to remove for master %s:\n", masterNode.Node.ID)
-
-		for _, node := range nodesToDelete {
-			fmt.Printf("  %s\n", node.ID)
-		}
-		fmt.Println()
-		for _, node := range nodesToDelete {
+	excess, err := excessReplicas(clusterTopology, env)
+	if err != nil {
+		return err
+	}
+	for _, shard := range excess {
+		logger.Info("Removing replicas from master", "master_id", shard.master.ID, "node_ids", nodeIDs(shard.replicas))
+		for _, node := range shard.replicas {
 			removedNodeHostnames[fmt.Sprintf("%s:%d", node.Hostname, node.Port)] = struct{}{}
 
-			if err := valkey.DelNode(valkey.DelNodeOptions{CliBaseOptions: options.cliBaseOptions, NodeID: node.ID}); err != nil {
+			if err := valkey.DelNode(ctx, valkey.DelNodeOptions{CliBaseOptions: options.cliBaseOptions, NodeID: node.ID}); err != nil {
 				return err
 			}
 			*options.nodeCount -= 1
 		}
-		fmt.Printf("✓ Nodes removed for master %s\n", masterNode.Node.ID)
-		fmt.Println()
 	}
 
 	leftOverNodeHostnames := make([]string, 0, *options.nodeCount)
@@ -357,38 +334,28 @@ func removeReplicasFromMasters(options *scaleDownOptions) error {
 		}
 	}
 
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
-	if err := valkey.WaitForAllNodesClusterInfoState(
-		timeoutCtx,
-		env,
-		leftOverNodeHostnames,
-		fmt.Sprintf("cluster_known_nodes:%d", *options.nodeCount)); err != nil {
+	if err := valkey.WaitForAllNodesClusterInfo(timeoutCtx, env, leftOverNodeHostnames, valkey.KnownNodesAre(*options.nodeCount), valkey.DefaultWaitOptions); err != nil {
 		return err
 	}
 
 	if err := client.Refresh(leftOverNodeHostnames...); err != nil {
 		return fmt.Errorf("refresh client after shard removal: %w", err)
 	}
-	clusterTopology, err := valkey.GetClusterTopology(client.Client)
+	clusterTopology, err = valkey.GetClusterTopology(client.Client)
 	if err != nil {
 		return err
 	}
 	options.topology = &clusterTopology
 
-	clusterTopology.Print()
-	fmt.Println("✓ Replicas removed")
-	fmt.Println()
-
+	logger.Info("Replicas removed", "topology", clusterTopology)
 	return nil
 }
 
-func moveMastersToSafeSpots(options *scaleDownOptions) error {
-	fmt.Println("Moving masters to safe spots...")
-
+func moveMastersToSafeSpots(ctx context.Context, options *scaleDownOptions) error {
+	logger := logging.FromContext(ctx)
 	client, clusterTopology, env := options.client, *options.topology, options.env
-	desiredNodeCount := env.Masters + env.Masters*env.ReplicasPerMaster
-	lastSafeNodeIndex := desiredNodeCount - 1
 
 	hostnames := make([]string, 0, len(clusterTopology.OrderedNodes))
 	for _, node := range clusterTopology.OrderedNodes {
@@ -396,53 +363,38 @@ func moveMastersToSafeSpots(options *scaleDownOptions) error {
 	}
 
 	modifiedTopology := false
-	for _, shard := range clusterTopology.OrderedShards {
-		masterNode, exists := clusterTopology.Masters[shard.MasterId]
-		if !exists {
-			return fmt.Errorf("master %s not found in topology", shard.MasterId)
-		}
-		if masterNode.Node.Index() <= lastSafeNodeIndex {
-			continue
-		}
-
-		fmt.Printf("Moving master %s to safe spot...\n", masterNode.Node.ID)
+	for _, shard := range mastersInDangerZone(clusterTopology, env) {
+		masterNode := clusterTopology.Masters[shard.MasterId]
+		logger.Info("Moving master to safe spot", "node_id", masterNode.Node.ID, "hostname", masterNode.Node.Hostname)
 		// NOTE: because the topology is healthy at the start of scale down function,
 		// there will always be a pod that isn't going to be removed from a statefulset scale down
 		promoteOriginalShardLeaderOptions := valkey.PromoteOriginalShardLeaderOptions{
-			ClusterClient: client.Client,
-			Shard:         shard,
-			Topology:      clusterTopology,
+			Auth:     valkey.ReconcilerAuth(env),
+			Shard:    shard,
+			Topology: clusterTopology,
 		}
-		timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 		defer cancel()
 		newMasterHostname, newSlaveHostname, err := valkey.PromoteOriginalShardLeader(timeoutCtx, promoteOriginalShardLeaderOptions)
 		if err != nil {
 			return err
 		}
 
-		newMasterMatchingStrings := []string{
-			fmt.Sprintf("%s master", newMasterHostname),
-			fmt.Sprintf("%s myself,master", newMasterHostname),
-		}
-		newSlaveMatchingStrings := []string{
-			fmt.Sprintf("%s slave", newSlaveHostname),
-			fmt.Sprintf("%s myself,slave", newSlaveHostname),
-		}
-		newlyReshardedOriginalLeaderStringMatches := [][]string{newMasterMatchingStrings, newSlaveMatchingStrings}
-		timeoutCtx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+		leaderRestored := valkey.AllOf(valkey.HostnameIsMaster(newMasterHostname), valkey.HostnameIsReplica(newSlaveHostname))
+		timeoutCtx, cancel = context.WithTimeout(ctx, 5*time.Minute)
 		defer cancel()
-		if err := valkey.WaitForAllNodesClusterNodeContains(timeoutCtx, env, hostnames, newlyReshardedOriginalLeaderStringMatches...); err != nil {
+		if err := valkey.WaitForAllNodes(timeoutCtx, env, hostnames, leaderRestored, valkey.DefaultWaitOptions); err != nil {
 			return err
 		}
 
-		fmt.Println("✓ Master moved to safe spot")
-		fmt.Println()
+		logger.Info("Master moved to safe spot", "hostname", newMasterHostname)
+		relabelPods(ctx, env)
 
 		modifiedTopology = true
 	}
 
 	if !modifiedTopology {
-		fmt.Println("No need to move masters to safe spots. Masters are already in safe spots")
+		logger.Info("No need to move masters to safe spots. Masters are already in safe spots")
 		return nil
 	}
 
@@ -452,39 +404,34 @@ func moveMastersToSafeSpots(options *scaleDownOptions) error {
 	}
 	options.topology = &newTopology
 
-	newTopology.Print()
-	fmt.Println("✓ Masters moved to safe spots")
-	fmt.Println()
+	logger.Info("Masters moved to safe spots", "topology", newTopology)
 	return nil
 }
 
-func removeDangerZoneNodes(options *scaleDownOptions) error {
-	fmt.Println("Removing nodes in danger zones...")
-	fmt.Println("Nodes in danger zones:")
-
+func removeDangerZoneNodes(ctx context.Context, options *scaleDownOptions) error {
+	logger := logging.FromContext(ctx)
 	client, clusterTopology, env := options.client, *options.topology, options.env
 	desiredNodeCount := env.Masters + env.Masters*env.ReplicasPerMaster
 	lastSafeNodeIndex := desiredNodeCount - 1
 
 	leftOverNodeHostnames := make([]string, 0, desiredNodeCount)
+	logger.Info("Removing nodes in danger zones", "last_safe_index", lastSafeNodeIndex)
 
-	// NOTE: can't precompute using OrderedNodes[lastSafeNodeIndex:] because it's not guaranteed to all be in the topology
 	for _, node := range clusterTopology.OrderedNodes {
 		if node.Index() <= lastSafeNodeIndex {
 			leftOverNodeHostnames = append(leftOverNodeHostnames, fmt.Sprintf("%s:%d", node.Hostname, node.Port))
-			continue
 		}
-
-		fmt.Printf("  %s\n", node.ID)
-		if err := valkey.DelNode(valkey.DelNodeOptions{CliBaseOptions: options.cliBaseOptions, NodeID: node.ID}); err != nil {
+	}
+	for _, node := range dangerZoneNodes(clusterTopology, env) {
+		if err := valkey.DelNode(ctx, valkey.DelNodeOptions{CliBaseOptions: options.cliBaseOptions, NodeID: node.ID}); err != nil {
 			return err
 		}
 		*options.nodeCount -= 1
 	}
 
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
-	if err := valkey.WaitForAllNodesClusterInfoState(timeoutCtx, env, leftOverNodeHostnames, fmt.Sprintf("cluster_known_nodes:%d", *options.nodeCount)); err != nil {
+	if err := valkey.WaitForAllNodesClusterInfo(timeoutCtx, env, leftOverNodeHostnames, valkey.KnownNodesAre(*options.nodeCount), valkey.DefaultWaitOptions); err != nil {
 		return err
 	}
 	if err := client.Refresh(leftOverNodeHostnames...); err != nil {
@@ -496,9 +443,6 @@ func removeDangerZoneNodes(options *scaleDownOptions) error {
 	}
 	options.topology = &clusterTopology
 
-	clusterTopology.Print()
-	fmt.Println("✓ Nodes removed from danger zones")
-	fmt.Println()
-
+	logger.Info("Nodes removed from danger zones", "topology", clusterTopology)
 	return nil
 }
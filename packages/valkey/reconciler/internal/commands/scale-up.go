@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
 	"valkey/reconciler/internal/utils"
 	"valkey/reconciler/internal/valkey"
 
@@ -13,55 +15,73 @@ import (
 
 const confusedMessage = "how tf did this even happen... maybe something went wrong during scale down?"
 
-func ScaleUp(env utils.Env) error {
-	fmt.Println("=== Valkey Cluster Scaling Up ===")
+func ScaleUp(ctx context.Context, env utils.Env) (err error) {
+	ctx = logging.With(ctx, "operation", "scale-up")
+	logger := logging.FromContext(ctx)
+	logger.Info("Scaling up Valkey cluster", "masters", env.Masters, "replicas_per_master", env.ReplicasPerMaster)
+
+	checkpoints, err := startCheckpoint(ctx, env, "scale-up")
+	if err != nil {
+		return err
+	}
+	defer func(startTime time.Time) {
+		observeOperation(ctx, "scale-up", checkpoints.step(), startTime, err)
+	}(time.Now())
 
 	totalNodes := env.Masters + env.Masters*env.ReplicasPerMaster
 
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
-	statefulSetName := utils.GetStatefulsetName(env.ClusterName)
-	err := utils.WaitForStatefulSetReady(timeoutCtx, env.Namespace, statefulSetName, totalNodes)
+	statefulSetName := utils.GetStatefulsetName(env)
+	err = utils.WaitForStatefulSetReady(timeoutCtx, env.Namespace, statefulSetName, totalNodes)
 	if err != nil {
 		return err
 	}
 
-	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(utils.GetHeadlessServiceFQDN(env.ClusterName, env.Namespace), env)
+	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(ctx, env)
 	if err != nil {
 		return err
 	}
 
-	client, err := valkey.NewClient(valkeygo.ClientOption{
-		InitAddress: clusterClientHostnames,
-		Username:    valkey.AdminUser,
-		Password:    env.AdminPassword,
-	})
+	client, err := valkey.NewClient(valkey.ReconcilerAuth(env), clusterClientHostnames...)
 	if err != nil {
 		return err
 	}
 	defer client.Close()
 
-	valkey.PrintClusterInfo(client)
-	valkey.PrintClusterNodes(client)
-	fmt.Println()
+	valkey.LogClusterInfo(ctx, client)
+	valkey.LogClusterNodes(ctx, client)
 
 	clusterTopology, err := valkey.GetClusterTopology(client)
 	if err != nil {
 		return err
 	}
+	// a pod that lost its data would otherwise look like a free node next to a failed one
+	clusterTopology, _, err = replaceLostNodes(ctx, env, client, clusterTopology)
+	if err != nil {
+		return err
+	}
+
+	joinedFreeNodes := map[string]struct{}{}
+	if checkpoints.resuming() {
+		clusterTopology, joinedFreeNodes, err = halfAddedReplicas(clusterTopology, env)
+		if err != nil {
+			return err
+		}
+		for hostname := range joinedFreeNodes {
+			logger.Info("Node joined the cluster but was never attached to a master. Treating it as a free node", "hostname", hostname)
+		}
+	}
 
 	lastColonIndex := strings.LastIndex(clusterClientHostnames[0], ":")
 	cliHostname := clusterClientHostnames[0][:lastColonIndex]
 	cliBaseOptions := valkey.CliBaseOptions{
 		Connection: valkey.Connection{
 			Hostname: cliHostname,
-			Port:     uint16(6379),
-		},
-		Auth: valkey.Auth{
-			Username: valkey.AdminUser,
-			Password: env.AdminPassword,
+			Port:     uint16(env.ClientPort),
 		},
+		Auth: valkey.ReconcilerAuth(env),
 	}
 
 	helperOptions := &scaleUpOptions{
@@ -69,32 +89,37 @@ func ScaleUp(env utils.Env) error {
 		env:            env,
 		topology:       &clusterTopology,
 		cliBaseOptions: cliBaseOptions,
+		checkpoints:    checkpoints,
+		joinedNodes:    joinedFreeNodes,
+		placements:     podPlacements(ctx, env),
 	}
 
-	currentMasterCount := len(clusterTopology.Masters)
-	if currentMasterCount < env.Masters {
-		if err := addMasters(helperOptions); err != nil {
+	masterHostnames, err := mastersToAdd(clusterTopology, env)
+	if err != nil {
+		logger.Error(confusedMessage)
+		return err
+	}
+	if len(masterHostnames) > 0 {
+		checkpoints.phase(ctx, "add-masters", "")
+		if err := addMasters(ctx, helperOptions, masterHostnames); err != nil {
 			return err
 		}
-	} else if currentMasterCount > env.Masters {
-		fmt.Println(confusedMessage)
-		return fmt.Errorf(
-			"current cluster has more masters than desired during scale up. desired masters: %d, current cluster masters: %d",
-			env.Masters,
-			currentMasterCount,
-		)
 	}
 
 	currentNodeCount := len(clusterTopology.OrderedNodes)
-	if currentNodeCount == totalNodes {
-		return finalizeScaleUp(helperOptions)
+	if currentNodeCount != totalNodes {
+		checkpoints.phase(ctx, "add-replicas", "")
+		if err := addReplicas(ctx, helperOptions); err != nil {
+			return err
+		}
 	}
 
-	if err := addReplicas(helperOptions); err != nil {
+	checkpoints.phase(ctx, "rebalance", "")
+	if err := finalizeScaleUp(ctx, helperOptions); err != nil {
 		return err
 	}
-
-	return finalizeScaleUp(helperOptions)
+	checkpoints.done(ctx)
+	return nil
 }
 
 type scaleUpOptions struct {
@@ -102,49 +127,72 @@ type scaleUpOptions struct {
 	env            utils.Env
 	topology       *valkey.Topology
 	cliBaseOptions valkey.CliBaseOptions
+	checkpoints    *checkpointer
+	joinedNodes    map[string]struct{}     // free node hostnames that already joined the cluster
+	placements     map[int]utils.Placement // where the pods run so a shard's replicas are spread out
 }
 
-func addMasters(options *scaleUpOptions) error {
-	fmt.Println("Adding new masters...")
+// valkey-cli adds a replica as an empty master before it is told to replicate. a run interrupted between
+// the two leaves an empty master on a pod meant for a replica. those are taken out of the topology and
+// returned so they are handed out as free nodes again.
+func halfAddedReplicas(clusterTopology valkey.Topology, env utils.Env) (valkey.Topology, map[string]struct{}, error) {
+	joinedFreeNodes := map[string]struct{}{}
+	nodes := make([]valkey.ClusterNode, 0, len(clusterTopology.OrderedNodes))
+	for _, node := range clusterTopology.OrderedNodes {
+		masterNode, isMaster := clusterTopology.Masters[node.ID]
+		if isMaster && node.Index() >= env.Masters && len(node.Slots) == 0 && len(masterNode.SlaveIds) == 0 {
+			joinedFreeNodes[node.Hostname] = struct{}{}
+			continue
+		}
+		nodes = append(nodes, node)
+	}
 
+	if len(joinedFreeNodes) == 0 {
+		return clusterTopology, joinedFreeNodes, nil
+	}
+	filteredTopology, err := valkey.ClusterTopology(nodes)
+	if err != nil {
+		return valkey.Topology{}, nil, err
+	}
+	return filteredTopology, joinedFreeNodes, nil
+}
+
+func addMasters(ctx context.Context, options *scaleUpOptions, masterHostnames []string) error {
+	logger := logging.FromContext(ctx)
 	client, env, clusterTopology := options.client, options.env, *options.topology
-	currentMasterCount := len(clusterTopology.Masters)
 
-	numberOfMastersToAdd := env.Masters - currentMasterCount
-	hostnames := make([]string, 0, len(clusterTopology.Masters)+numberOfMastersToAdd)
-	hostnameMatching := make([][]string, 0, numberOfMastersToAdd)
+	logger.Info("Adding new masters", "count", len(masterHostnames))
+	hostnames := make([]string, 0, len(clusterTopology.Masters)+len(masterHostnames))
+	knowsMasters := make([]valkey.NodesPredicate, 0, len(clusterTopology.Masters)+len(masterHostnames))
 	for _, master := range clusterTopology.Masters {
 		hostnames = append(hostnames, fmt.Sprintf("%s:%d", master.Node.Hostname, master.Node.Port))
-		hostnameMatching = append(hostnameMatching, []string{master.Node.Hostname})
+		knowsMasters = append(knowsMasters, valkey.KnowsHostname(master.Node.Hostname))
 	}
 
-	for i := range numberOfMastersToAdd {
-		masterPodIndex := currentMasterCount + i
-		masterHostname := utils.GetPodHeadlessServiceFQDN(env.ClusterName, env.Namespace, masterPodIndex)
-		if _, exists := client.Nodes()[fmt.Sprintf("%s:%d", masterHostname, 6379)]; exists {
+	for _, masterHostname := range masterHostnames {
+		if _, exists := client.Nodes()[fmt.Sprintf("%s:%d", masterHostname, env.ClientPort)]; exists {
 			return fmt.Errorf("pod %s is already part of the cluster. expected pod to not be part of cluster", masterHostname)
 		}
 
-		fmt.Printf("  Adding master %s...\n", masterHostname)
 		addNodeOptions := valkey.AddNodeOptions{
 			CliBaseOptions: options.cliBaseOptions,
 			NewHostname:    masterHostname,
-			NewPort:        uint16(6379),
+			NewPort:        uint16(env.ClientPort),
 		}
-		if err := valkey.AddNode(addNodeOptions); err != nil {
+		if err := valkey.AddNode(ctx, addNodeOptions); err != nil {
 			return err
 		}
 
-		hostnames = append(hostnames, fmt.Sprintf("%s:%d", masterHostname, 6379))
-		hostnameMatching = append(hostnameMatching, []string{masterHostname})
+		hostnames = append(hostnames, fmt.Sprintf("%s:%d", masterHostname, env.ClientPort))
+		knowsMasters = append(knowsMasters, valkey.KnowsHostname(masterHostname))
 
-		timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 		defer cancel()
-		if err := valkey.WaitForAllNodesClusterNodeContains(timeoutCtx, env, hostnames, hostnameMatching...); err != nil {
+		if err := valkey.WaitForAllNodes(timeoutCtx, env, hostnames, valkey.AllOf(knowsMasters...), valkey.DefaultWaitOptions); err != nil {
 			return err
 		}
 
-		fmt.Printf("  ✓ Master %s added\n", masterHostname)
+		logger.Info("Master added", "hostname", masterHostname)
 	}
 
 	clusterTopology, err := valkey.GetClusterTopology(client)
@@ -154,98 +202,61 @@ func addMasters(options *scaleUpOptions) error {
 
 	options.topology = &clusterTopology
 
-	clusterTopology.Print()
-	fmt.Println("✓ Masters added")
+	logger.Info("Masters added", "topology", clusterTopology)
 	return nil
 }
 
-func addReplicas(options *scaleUpOptions) error {
+func addReplicas(ctx context.Context, options *scaleUpOptions) error {
 	client, env, clusterTopology := options.client, options.env, *options.topology
 
-	freeNodeHostnames, err := findFreeNodeHostnames(env, clusterTopology)
+	logger := logging.FromContext(ctx)
+	freeNodeHostnames, err := findFreeNodeHostnames(ctx, env, clusterTopology)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Adding/checking replicas...")
-	replicasAdded := make(map[string]string, env.Masters*env.ReplicasPerMaster-len(clusterTopology.Slaves))
-	for _, masterNode := range clusterTopology.Masters {
-		slaveNodeCount := len(masterNode.SlaveIds)
-		replicasToAdd := env.ReplicasPerMaster - slaveNodeCount
-
-		if replicasToAdd == 0 {
-			continue
-		} else if replicasToAdd < 0 {
-			fmt.Println(confusedMessage)
-			return fmt.Errorf("master has more replicas than desired")
-		}
-
-		for range replicasToAdd {
-			if len(freeNodeHostnames) == 0 {
-				fmt.Println(confusedMessage)
-				return fmt.Errorf("not enough free nodes to add replicas")
-			}
-			freeNodeHostname := freeNodeHostnames[0]
-			freeNodeHostnames = freeNodeHostnames[1:]
+	logger.Info("Adding/checking replicas", "replicas_per_master", env.ReplicasPerMaster)
+	assignments, err := assignReplicas(clusterTopology, env, freeNodeHostnames, options.placements)
+	if err != nil {
+		logger.Error(confusedMessage)
+		return err
+	}
 
-			fmt.Printf("  Adding replica %s for master %s...\n", freeNodeHostname, masterNode.Node.ID)
+	replicasAdded := make(map[string]string, len(assignments))
+	for _, assignment := range assignments {
+		freeNodeHostname, masterNode := assignment.hostname, clusterTopology.Masters[assignment.masterID]
+		options.checkpoints.phase(ctx, "add-replicas", fmt.Sprintf("replica %s for master %s", freeNodeHostname, masterNode.Node.ID))
 
+		if _, joined := options.joinedNodes[freeNodeHostname]; !joined {
 			addNodeOptions := valkey.AddNodeOptions{
 				CliBaseOptions: options.cliBaseOptions,
 				NewHostname:    freeNodeHostname,
-				NewPort:        uint16(6379),
-			}
-			if err := valkey.AddNode(addNodeOptions); err != nil {
-				return err
-			}
-
-			replicaClient, err := valkey.NewClient(valkeygo.ClientOption{
-				InitAddress:       []string{fmt.Sprintf("%s:%d", freeNodeHostname, 6379)},
-				Username:          valkey.AdminUser,
-				Password:          env.AdminPassword,
-				ForceSingleClient: true,
-			})
-			if err != nil {
-				return err
-			}
-
-			// wait for metadata (master id) to be received by the replica via bus
-			timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-			defer cancel()
-			if err := valkey.WaitForClusterNodeContains(timeoutCtx, replicaClient, []string{masterNode.Node.ID}); err != nil {
-				return err
+				NewPort:        uint16(env.ClientPort),
 			}
-
-			if err := valkey.Replicate(replicaClient, masterNode.Node.ID); err != nil {
+			if err := valkey.AddNode(ctx, addNodeOptions); err != nil {
 				return err
 			}
+		}
 
-			currentClusterHostnames := make([]string, 0, len(clusterTopology.OrderedNodes)+len(replicasAdded))
-			for _, node := range clusterTopology.OrderedNodes {
-				currentClusterHostnames = append(currentClusterHostnames, fmt.Sprintf("%s:%d", node.Hostname, node.Port))
-			}
-			for hostname := range replicasAdded {
-				currentClusterHostnames = append(currentClusterHostnames, fmt.Sprintf("%s:%d", hostname, 6379))
-			}
-			timeoutCtx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
-			defer cancel()
-			if err := valkey.WaitForAllNodesClusterNodeContains(
-				timeoutCtx,
-				env,
-				currentClusterHostnames,
-				[]string{fmt.Sprintf("%s slave %s", freeNodeHostname, masterNode.Node.ID)}); err != nil {
-				return err
-			}
-
-			replicaClient.Close()
-			replicasAdded[freeNodeHostname] = masterNode.Node.ID
-
-			fmt.Printf("✓ Replica %s added for master %s\n", freeNodeHostname, masterNode.Node.ID)
+		currentClusterHostnames := make([]string, 0, len(clusterTopology.OrderedNodes)+len(replicasAdded))
+		for _, node := range clusterTopology.OrderedNodes {
+			currentClusterHostnames = append(currentClusterHostnames, fmt.Sprintf("%s:%d", node.Hostname, node.Port))
+		}
+		for hostname := range replicasAdded {
+			currentClusterHostnames = append(currentClusterHostnames, fmt.Sprintf("%s:%d", hostname, env.ClientPort))
 		}
+		// closes the replica's client before the next one is opened, on errors too
+		replicaAddress := fmt.Sprintf("%s:%d", freeNodeHostname, env.ClientPort)
+		if err := attachReplica(ctx, env, currentClusterHostnames, freeNodeHostname, replicaAddress, masterNode.Node); err != nil {
+			return err
+		}
+		replicasAdded[freeNodeHostname] = masterNode.Node.ID
+
+		events.Normal(ctx, events.ReasonReplicaAttached, "Attached replica %s to master %s (%s)", freeNodeHostname, masterNode.Node.ID, masterNode.Node.Hostname)
 	}
 
 	if len(replicasAdded) > 0 {
-		if err := waitForEntireClusterForReplicas(env, replicasAdded); err != nil {
+		if err := waitForEntireClusterForReplicas(ctx, env, replicasAdded); err != nil {
 			return err
 		}
 
@@ -255,16 +266,26 @@ func addReplicas(options *scaleUpOptions) error {
 		}
 		options.topology = &clusterTopology
 
-		clusterTopology.Print()
+		logger.Info("Replicas added", "replicas", len(replicasAdded), "topology", clusterTopology)
 	}
 
-	fmt.Println("✓ Replicas added or checked")
 	return nil
 }
 
-func findFreeNodeHostnames(env utils.Env, clusterTopology valkey.Topology) ([]string, error) {
-	fmt.Println("Finding free nodes...")
+func findFreeNodeHostnames(ctx context.Context, env utils.Env, clusterTopology valkey.Topology) ([]string, error) {
+	logger := logging.FromContext(ctx)
+	freeNodeHostnames, err := freeNodeHostnames(env, clusterTopology)
+	if err != nil {
+		logger.Error(confusedMessage)
+		return nil, err
+	}
+	logger.Info("Found free nodes", "hostnames", freeNodeHostnames)
 
+	return freeNodeHostnames, nil
+}
+
+// pods in the desired statefulset size that aren't part of the cluster yet ordered by pod index
+func freeNodeHostnames(env utils.Env, clusterTopology valkey.Topology) ([]string, error) {
 	totalNodes, currentNodeCount := env.Masters+env.Masters*env.ReplicasPerMaster, len(clusterTopology.OrderedNodes)
 
 	freeNodeHostnames := make([]string, 0, totalNodes-currentNodeCount)
@@ -273,50 +294,38 @@ func findFreeNodeHostnames(env utils.Env, clusterTopology valkey.Topology) ([]st
 		existingNodeHostnameSet[node.Hostname] = struct{}{}
 	}
 	for i := range totalNodes {
-		hostname := utils.GetPodHeadlessServiceFQDN(env.ClusterName, env.Namespace, i)
+		hostname := utils.GetPodHeadlessServiceFQDN(env, i)
 		if _, exists := existingNodeHostnameSet[hostname]; !exists {
 			freeNodeHostnames = append(freeNodeHostnames, hostname)
 		}
 	}
 	if len(freeNodeHostnames) < totalNodes-currentNodeCount {
-		fmt.Println(confusedMessage)
 		return nil, fmt.Errorf("expected %d free nodes, got %d", totalNodes-currentNodeCount, len(freeNodeHostnames))
 	}
-	fmt.Println("Free nodes found:")
-	for _, hostname := range freeNodeHostnames {
-		fmt.Printf("  %s\n", hostname)
-	}
-	fmt.Println("✓ Found free nodes")
-
 	return freeNodeHostnames, nil
 }
 
 // wait for entire cluster to be fully updated via bus
-func waitForEntireClusterForReplicas(env utils.Env, replicasAdded map[string]string) error {
-	replicaStringMatches := make([][]string, 0, len(replicasAdded))
-	for replicaHostname, masterId := range replicasAdded {
-		slaveMatchingString := fmt.Sprintf("%s slave %s", replicaHostname, masterId)
-		myselfSlaveMatchingString := fmt.Sprintf("%s myself,slave %s", replicaHostname, masterId)
-		replicaStringMatches = append(replicaStringMatches, []string{slaveMatchingString, myselfSlaveMatchingString})
-	}
-
+func waitForEntireClusterForReplicas(ctx context.Context, env utils.Env, replicasAdded map[string]string) error {
 	totalNodes := env.Masters + env.Masters*env.ReplicasPerMaster
-	allHostnames := make([][]string, 0, totalNodes)
+	predicates := make([]valkey.NodesPredicate, 0, totalNodes+len(replicasAdded))
 	for i := range totalNodes {
-		allHostnames = append(allHostnames, []string{utils.GetPodHeadlessServiceFQDN(env.ClusterName, env.Namespace, i)})
+		predicates = append(predicates, valkey.KnowsHostname(utils.GetPodHeadlessServiceFQDN(env, i)))
+	}
+	for replicaHostname, masterId := range replicasAdded {
+		predicates = append(predicates, valkey.HostnameIsReplicaOf(replicaHostname, masterId))
 	}
 
-	allMatches := append(allHostnames, replicaStringMatches...)
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
-	if err := valkey.WaitForEntireClusterConsistencyClusterNodeContains(timeoutCtx, env, allMatches...); err != nil {
+	if err := valkey.WaitForEntireCluster(timeoutCtx, env, valkey.AllOf(predicates...), valkey.DefaultWaitOptions); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func finalizeScaleUp(options *scaleUpOptions) error {
+func finalizeScaleUp(ctx context.Context, options *scaleUpOptions) error {
 	client, clusterTopology := options.client, *options.topology
 	rebalanceOptions := valkey.RebalanceOptions{
 		CliBaseOptions:  options.cliBaseOptions,
@@ -324,21 +333,19 @@ func finalizeScaleUp(options *scaleUpOptions) error {
 		Replace:         true,
 	}
 
+	logger := logging.FromContext(ctx)
 	if healthy, err := clusterTopology.IsHealthy(); !healthy {
-		fmt.Println(confusedMessage)
-		fmt.Println("Cluster is unhealthy with a proper amount of nodes. Something went wrong!")
-		valkey.PrintClusterNodes(client)
+		logger.Error("Cluster is unhealthy with a proper amount of nodes. Something went wrong!", "reason", confusedMessage, "error", err)
+		valkey.LogClusterNodes(ctx, client)
 		return err
 	}
 
-	fmt.Println("Rebalancing slots...")
-	if err := valkey.Rebalance(rebalanceOptions); err != nil {
+	logger.Info("Rebalancing slots")
+	if err := valkey.Rebalance(ctx, rebalanceOptions); err != nil {
 		return err
 	}
-	fmt.Println("✓ Slots rebalanced")
-	fmt.Println()
+	logger.Info("Slots rebalanced")
 
-	valkey.PrintClusterNodes(client)
-	fmt.Println("=== Scale Up Complete ===")
+	valkey.LogClusterNodes(ctx, client)
 	return nil
 }
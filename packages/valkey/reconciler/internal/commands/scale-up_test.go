@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"testing"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+func TestHalfAddedReplicas(t *testing.T) {
+	env := testEnv(2, 1)
+
+	tests := []struct {
+		name        string
+		nodes       []valkey.ClusterNode
+		wantJoined  []int // pod indices treated as free nodes
+		wantMasters int
+	}{
+		{
+			name:        "complete cluster",
+			nodes:       planNodes(2, 1),
+			wantJoined:  nil,
+			wantMasters: 2,
+		},
+		{
+			name: "replica joined as an empty master",
+			nodes: append(planNodes(2, 0),
+				planNode(2, "node0", nil),
+				planNode(3, "", nil),
+			),
+			wantJoined:  []int{3},
+			wantMasters: 2,
+		},
+		{
+			name:        "new master without slots yet is kept",
+			nodes:       append(planNodes(1, 0), planNode(1, "", nil)),
+			wantJoined:  nil,
+			wantMasters: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusterTopology, err := valkey.ClusterTopology(test.nodes)
+			if err != nil {
+				t.Fatalf("unexpected topology error: %v", err)
+			}
+
+			filteredTopology, joined, err := halfAddedReplicas(clusterTopology, env)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(filteredTopology.Masters) != test.wantMasters {
+				t.Errorf("expected %d masters, got %d", test.wantMasters, len(filteredTopology.Masters))
+			}
+			if len(joined) != len(test.wantJoined) {
+				t.Fatalf("expected %d joined free nodes, got %v", len(test.wantJoined), joined)
+			}
+			for _, index := range test.wantJoined {
+				hostname := utils.GetPodHeadlessServiceFQDN(env, index)
+				if _, exists := joined[hostname]; !exists {
+					t.Errorf("expected %s to be a joined free node", hostname)
+				}
+				for _, node := range filteredTopology.OrderedNodes {
+					if node.Hostname == hostname {
+						t.Errorf("expected %s to be removed from the topology", hostname)
+					}
+				}
+			}
+		})
+	}
+}
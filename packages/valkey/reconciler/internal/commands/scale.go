@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+// the decisions behind scale down and scale up. ScaleDown and ScaleUp act on them against the live
+// cluster and the planner applies them to its simulated copy so plan and --dry-run show what a real
+// run does
+
+// the parts of scale down that have anything to do. decided once from the topology scale down starts from
+type scaleDownPhases struct {
+	removeShards     bool
+	makeRoom         bool // nodes sit on the pod indices new masters are added on
+	removeReplicas   bool
+	removeDangerZone bool // pods past the desired node count go away with the statefulset
+}
+
+func decideScaleDown(clusterTopology valkey.Topology, env utils.Env) scaleDownPhases {
+	return scaleDownPhases{
+		removeShards: len(clusterTopology.Masters) > env.Masters,
+		makeRoom:     len(clusterTopology.Masters) < env.Masters,
+		// the most replicas instead of the average because a resumed run can have uneven shards
+		removeReplicas:   maxReplicasPerMaster(clusterTopology) > env.ReplicasPerMaster,
+		removeDangerZone: len(clusterTopology.OrderedNodes) > desiredShape(env).Nodes,
+	}
+}
+
+// shards past the desired master count
+func shardsToRemove(clusterTopology valkey.Topology, env utils.Env) []valkey.Shard {
+	if len(clusterTopology.OrderedShards) <= env.Masters {
+		return nil
+	}
+	return clusterTopology.OrderedShards[env.Masters:]
+}
+
+// nodes on the pod indices the new masters are added on. picked by pod index instead of slicing
+// OrderedNodes because a resumed run can have gaps
+func nodesInTheWayOfMasters(clusterTopology valkey.Topology, env utils.Env) []valkey.ClusterNode {
+	currentMasterCount, nodeCount := len(clusterTopology.Masters), len(clusterTopology.OrderedNodes)
+
+	var nodes []valkey.ClusterNode
+	for _, node := range clusterTopology.OrderedNodes {
+		index := node.Index()
+		if index < currentMasterCount || (env.Masters <= nodeCount && index >= env.Masters) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+type shardReplicas struct {
+	master   valkey.ClusterNode
+	replicas []valkey.ClusterNode
+}
+
+// the replicas of every shard past the desired replicas per master, in shard order. the replicas on the
+// later statefulset pod indices are the ones removed
+func excessReplicas(clusterTopology valkey.Topology, env utils.Env) ([]shardReplicas, error) {
+	var excess []shardReplicas
+	for _, shard := range clusterTopology.OrderedShards {
+		masterNode := clusterTopology.Masters[shard.MasterId]
+		if len(masterNode.SlaveIds) <= env.ReplicasPerMaster {
+			continue
+		}
+
+		slaveNodes := make([]valkey.ClusterNode, 0, len(masterNode.SlaveIds))
+		for _, slaveId := range masterNode.SlaveIds {
+			slaveNode, exists := clusterTopology.Slaves[slaveId]
+			if !exists {
+				return nil, fmt.Errorf("slave %s not found in topology", slaveId)
+			}
+			slaveNodes = append(slaveNodes, slaveNode)
+		}
+		sort.Slice(slaveNodes, func(i, j int) bool {
+			return slaveNodes[i].Index() < slaveNodes[j].Index()
+		})
+		excess = append(excess, shardReplicas{master: masterNode.Node, replicas: slaveNodes[env.ReplicasPerMaster:]})
+	}
+	return excess, nil
+}
+
+// shards whose master is on a pod the statefulset scale down removes
+func mastersInDangerZone(clusterTopology valkey.Topology, env utils.Env) []valkey.Shard {
+	lastSafeNodeIndex := desiredShape(env).Nodes - 1
+
+	var shards []valkey.Shard
+	for _, shard := range clusterTopology.OrderedShards {
+		if clusterTopology.Masters[shard.MasterId].Node.Index() > lastSafeNodeIndex {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
+
+// nodes on pods the statefulset scale down removes.
+//
+// NOTE: can't slice OrderedNodes[lastSafeNodeIndex:] because it's not guaranteed to all be in the topology
+func dangerZoneNodes(clusterTopology valkey.Topology, env utils.Env) []valkey.ClusterNode {
+	lastSafeNodeIndex := desiredShape(env).Nodes - 1
+
+	var nodes []valkey.ClusterNode
+	for _, node := range clusterTopology.OrderedNodes {
+		if node.Index() > lastSafeNodeIndex {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// hostnames of the pods new masters are added on
+func mastersToAdd(clusterTopology valkey.Topology, env utils.Env) ([]string, error) {
+	currentMasterCount := len(clusterTopology.Masters)
+	if currentMasterCount > env.Masters {
+		return nil, fmt.Errorf(
+			"current cluster has more masters than desired during scale up. desired masters: %d, current cluster masters: %d",
+			env.Masters,
+			currentMasterCount,
+		)
+	}
+
+	hostnames := make([]string, 0, env.Masters-currentMasterCount)
+	for i := range env.Masters - currentMasterCount {
+		hostnames = append(hostnames, utils.GetPodHeadlessServiceFQDN(env, currentMasterCount+i))
+	}
+	return hostnames, nil
+}
+
+type replicaAssignment struct {
+	hostname string // free pod the replica is added on
+	masterID string
+}
+
+// hands the free pods out to the shards that are missing replicas. the shards are walked in order so the
+// free pods are handed out the same way every time and every replica goes on the free pod that spreads
+// its shard the most
+func assignReplicas(clusterTopology valkey.Topology, env utils.Env, freeHostnames []string, placements map[int]utils.Placement) ([]replicaAssignment, error) {
+	freeHostnames = slices.Clone(freeHostnames)
+
+	var assignments []replicaAssignment
+	for _, shard := range clusterTopology.OrderedShards {
+		masterNode := clusterTopology.Masters[shard.MasterId]
+		replicasToAdd := env.ReplicasPerMaster - len(masterNode.SlaveIds)
+		if replicasToAdd < 0 {
+			return nil, fmt.Errorf("master %s has more replicas than desired", masterNode.Node.ID)
+		}
+
+		shardPods := clusterTopology.ShardPods(masterNode.Node.ID)
+		for range replicasToAdd {
+			if len(freeHostnames) == 0 {
+				return nil, fmt.Errorf("not enough free nodes to add replicas")
+			}
+			i := valkey.PickReplica(shardPods, freeHostnames, placements)
+			assignments = append(assignments, replicaAssignment{hostname: freeHostnames[i], masterID: masterNode.Node.ID})
+			shardPods = append(shardPods, valkey.HostnameIndex(freeHostnames[i]))
+			freeHostnames = slices.Delete(freeHostnames, i, i+1)
+		}
+	}
+	return assignments, nil
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"slices"
+	"testing"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+)
+
+func TestDecideScaleDown(t *testing.T) {
+	// node0 kept both replicas, node1 lost one of its replicas to an interrupted run
+	uneven := []valkey.ClusterNode{
+		planNode(0, "", []valkey.SlotRange{{StartSlot: 0, EndSlot: 8191}}),
+		planNode(1, "", []valkey.SlotRange{{StartSlot: 8192, EndSlot: 16383}}),
+		planNode(2, "node0", nil),
+		planNode(3, "node1", nil),
+		planNode(4, "node0", nil),
+	}
+
+	tests := []struct {
+		name  string
+		nodes []valkey.ClusterNode
+		env   utils.Env
+		want  scaleDownPhases
+	}{
+		{name: "desired shape", nodes: planNodes(2, 1), env: testEnv(2, 1)},
+		{
+			name:  "fewer masters",
+			nodes: planNodes(3, 1),
+			env:   testEnv(2, 1),
+			want:  scaleDownPhases{removeShards: true, removeDangerZone: true},
+		},
+		{
+			name:  "more masters",
+			nodes: planNodes(2, 1),
+			env:   testEnv(3, 1),
+			want:  scaleDownPhases{makeRoom: true},
+		},
+		{
+			name:  "uneven replicas go by the shard with the most",
+			nodes: uneven,
+			env:   testEnv(2, 1),
+			want:  scaleDownPhases{removeReplicas: true, removeDangerZone: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusterTopology, err := valkey.ClusterTopology(test.nodes)
+			if err != nil {
+				t.Fatalf("unexpected topology error: %v", err)
+			}
+			if got := decideScaleDown(clusterTopology, test.env); got != test.want {
+				t.Errorf("decideScaleDown() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScaleDownNodes(t *testing.T) {
+	// pod 3 is missing after an interrupted run and node5 took over from node1
+	nodes := []valkey.ClusterNode{
+		planNode(0, "", []valkey.SlotRange{{StartSlot: 0, EndSlot: 8191}}),
+		planNode(1, "node5", nil),
+		planNode(2, "node0", nil),
+		planNode(4, "node0", nil),
+		planNode(5, "", []valkey.SlotRange{{StartSlot: 8192, EndSlot: 16383}}),
+	}
+	clusterTopology, err := valkey.ClusterTopology(nodes)
+	if err != nil {
+		t.Fatalf("unexpected topology error: %v", err)
+	}
+
+	shardIDs := func(shards []valkey.Shard) []string {
+		var ids []string
+		for _, shard := range shards {
+			ids = append(ids, shard.MasterId)
+		}
+		return ids
+	}
+
+	if got, want := nodeIDs(nodesInTheWayOfMasters(clusterTopology, testEnv(3, 0))), []string{"node2"}; !slices.Equal(got, want) {
+		t.Errorf("nodesInTheWayOfMasters() = %v, want %v", got, want)
+	}
+	if got, want := shardIDs(mastersInDangerZone(clusterTopology, testEnv(2, 1))), []string{"node5"}; !slices.Equal(got, want) {
+		t.Errorf("mastersInDangerZone() = %v, want %v", got, want)
+	}
+	if got, want := nodeIDs(dangerZoneNodes(clusterTopology, testEnv(2, 1))), []string{"node4", "node5"}; !slices.Equal(got, want) {
+		t.Errorf("dangerZoneNodes() = %v, want %v", got, want)
+	}
+
+	excess, err := excessReplicas(clusterTopology, testEnv(2, 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(excess) != 1 || excess[0].master.ID != "node0" || !slices.Equal(nodeIDs(excess[0].replicas), []string{"node4"}) {
+		t.Errorf("excessReplicas() = %+v, want node4 of node0", excess)
+	}
+}
+
+func TestAssignReplicas(t *testing.T) {
+	clusterTopology, err := valkey.ClusterTopology(planNodes(2, 0))
+	if err != nil {
+		t.Fatalf("unexpected topology error: %v", err)
+	}
+	env := testEnv(2, 1)
+	freeHostnames := []string{utils.GetPodHeadlessServiceFQDN(env, 2), utils.GetPodHeadlessServiceFQDN(env, 3)}
+
+	// pod 2 shares node0's zone so node0 gets pod 3
+	assignments, err := assignReplicas(clusterTopology, env, freeHostnames, zonedPlacements(4))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []replicaAssignment{
+		{hostname: freeHostnames[1], masterID: "node0"},
+		{hostname: freeHostnames[0], masterID: "node1"},
+	}
+	if !slices.Equal(assignments, want) {
+		t.Errorf("assignReplicas() = %+v, want %+v", assignments, want)
+	}
+	if len(freeHostnames) != 2 {
+		t.Errorf("assignReplicas() changed the free hostnames to %v", freeHostnames)
+	}
+
+	if _, err := assignReplicas(clusterTopology, testEnv(2, 2), freeHostnames, nil); err == nil {
+		t.Errorf("expected an error without enough free nodes")
+	}
+}
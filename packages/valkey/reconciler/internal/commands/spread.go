@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"context"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// podPlacements is best effort: without placements (ie. the reconciler isn't allowed to read nodes)
+// replicas are handed out by pod index and never moved
+func podPlacements(ctx context.Context, env utils.Env) map[int]utils.Placement {
+	clientset, err := utils.NewKubernetesClient()
+	if err == nil {
+		var placements map[int]utils.Placement
+		if placements, err = discoverPlacements(ctx, clientset, env); err == nil {
+			return placements
+		}
+	}
+	logging.FromContext(ctx).Warn("Pod placement unknown. Replicas are placed by pod index", "error", err)
+	return nil
+}
+
+// dns discovery can't tell which node a pod runs on so placements are always read from the pod list
+func discoverPlacements(ctx context.Context, clientset kubernetes.Interface, env utils.Env) (map[int]utils.Placement, error) {
+	if _, ok := env.Discovery.(utils.KubernetesDiscovery); !ok {
+		env.Discovery = utils.KubernetesDiscovery{Clientset: clientset}
+	}
+	pods, err := utils.DiscoverPods(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	return utils.GetPodPlacements(ctx, clientset, pods)
+}
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"valkey/reconciler/internal/api/v1alpha1"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/metrics"
+	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func NewOperation(name string, startTime time.Time, err error) *v1alpha1.Operation {
+	operation := &v1alpha1.Operation{
+		Name:           name,
+		Result:         v1alpha1.OperationSucceeded,
+		StartTime:      metav1.NewTime(startTime),
+		CompletionTime: metav1.Now(),
+	}
+	if err != nil {
+		operation.Result = v1alpha1.OperationFailed
+		operation.Message = err.Error()
+	}
+	return operation
+}
+
+// NewEventRecorder records events on the cluster's StatefulSet and ValkeyCluster resource. events are
+// best effort so a recorder that can't be set up only warns and returns nil (which drops events).
+func NewEventRecorder(ctx context.Context, clientset kubernetes.Interface, env utils.Env) *events.Recorder {
+	logger := logging.FromContext(ctx)
+	dynamicClient, err := utils.NewDynamicClient()
+	if err != nil {
+		logger.Warn("Events will not be recorded on the ValkeyCluster resource", "error", err)
+	}
+	recorder, err := events.NewRecorder(ctx, clientset, dynamicClient, env)
+	if err != nil {
+		logger.Warn("Events disabled", "error", err)
+		return nil
+	}
+	return recorder
+}
+
+// records the operation's metrics and logs how it ended. step is what was running when it failed
+func observeOperation(ctx context.Context, operation, step string, startTime time.Time, err error) {
+	metrics.ObserveOperation(operation, step, startTime, err)
+
+	logger := logging.FromContext(ctx)
+	if err != nil {
+		logger.Error("Operation failed", "step", step, "duration", time.Since(startTime), "error", err)
+		events.Warning(ctx, events.ReasonOperationFailed, "%s failed during %s: %v", operation, step, err)
+		return
+	}
+	logger.Info("Operation complete", "duration", time.Since(startTime))
+}
+
+// RecordStatus writes what the cluster currently looks like into the status of the ValkeyCluster
+// resource. a nil operation keeps the last recorded operation. clusters without a ValkeyCluster
+// resource are skipped so the reconciler still works when the crd isn't installed.
+func RecordStatus(ctx context.Context, env utils.Env, operation *v1alpha1.Operation) error {
+	client, err := utils.NewDynamicClient()
+	if err != nil {
+		return err
+	}
+
+	cluster, err := utils.GetValkeyCluster(ctx, client, env.Namespace, env.ClusterName)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	status := observeClusterStatus(ctx, env)
+	status.ObservedGeneration = cluster.Generation
+	status.LastOperation = cluster.Status.LastOperation
+	if operation != nil {
+		status.LastOperation = operation
+	}
+
+	// the controller watches the resource so only write when something changed or it will wake itself up
+	if equality.Semantic.DeepEqual(cluster.Status, status) {
+		return nil
+	}
+
+	cluster.Status = status
+	return utils.UpdateValkeyClusterStatus(ctx, client, cluster)
+}
+
+func observeClusterStatus(ctx context.Context, env utils.Env) v1alpha1.ValkeyClusterStatus {
+	clusterClientHostnames, err := valkey.GetClusterConnectionInfo(ctx, env)
+	if err != nil {
+		return v1alpha1.ValkeyClusterStatus{HealthMessage: fmt.Sprintf("failed to find cluster nodes: %v", err)}
+	}
+	if len(clusterClientHostnames) == 0 {
+		return v1alpha1.ValkeyClusterStatus{HealthMessage: "cluster is not initialized"}
+	}
+
+	client, err := valkey.NewClient(valkey.ReconcilerAuth(env), clusterClientHostnames...)
+	if err != nil {
+		return v1alpha1.ValkeyClusterStatus{HealthMessage: fmt.Sprintf("failed to connect to cluster: %v", err)}
+	}
+	defer client.Close()
+
+	clusterTopology, err := valkey.GetClusterTopology(client)
+	if err != nil {
+		return v1alpha1.ValkeyClusterStatus{HealthMessage: fmt.Sprintf("failed to get cluster topology: %v", err)}
+	}
+
+	return topologyStatus(clusterTopology)
+}
+
+func topologyStatus(clusterTopology valkey.Topology) v1alpha1.ValkeyClusterStatus {
+	status := v1alpha1.ValkeyClusterStatus{
+		Masters:       len(clusterTopology.Masters),
+		Replicas:      len(clusterTopology.Slaves),
+		Nodes:         len(clusterTopology.OrderedNodes),
+		SlotsAssigned: clusterTopology.AssignedSlots(),
+		Healthy:       true,
+	}
+
+	if healthy, err := clusterTopology.IsHealthy(); !healthy {
+		status.Healthy = false
+		status.HealthMessage = err.Error()
+	} else if status.SlotsAssigned != valkey.TotalSlots {
+		status.Healthy = false
+		status.HealthMessage = fmt.Sprintf("only %d/%d slots are assigned", status.SlotsAssigned, valkey.TotalSlots)
+	}
+
+	return status
+}
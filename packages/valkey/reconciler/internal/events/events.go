@@ -0,0 +1,165 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"valkey/reconciler/internal/api/v1alpha1"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const component = "valkey-reconciler"
+
+const (
+	ReasonClusterCreated     = "ClusterCreated"
+	ReasonNodeAdded          = "NodeAdded"
+	ReasonNodeRemoved        = "NodeRemoved"
+	ReasonReplicaAttached    = "ReplicaAttached"
+	ReasonFailover           = "FailoverPerformed"
+	ReasonShardRemoved       = "ShardRemoved"
+	ReasonRebalanceStarted   = "RebalanceStarted"
+	ReasonRebalanceFinished  = "RebalanceFinished"
+	ReasonOperationFailed    = "OperationFailed"
+	ReasonCredentialsRotated = "CredentialsRotated"
+)
+
+// Recorder records events on the cluster's StatefulSet and its ValkeyCluster resource (when there is
+// one) so they show up in kubectl describe. a nil Recorder drops every event.
+type Recorder struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	objects     []*corev1.ObjectReference
+	sink        *countingSink
+	recorded    atomic.Int64
+}
+
+// NewRecorder looks up the objects to record events on. dynamicClient can be nil to skip the
+// ValkeyCluster resource. Shutdown has to be called to flush the events before the process exits.
+func NewRecorder(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, env utils.Env) (*Recorder, error) {
+	namespace, clusterName := env.Namespace, env.ClusterName
+	statefulSetName := utils.GetStatefulsetName(env)
+	statefulSet, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, statefulSetName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get statefulset %s for events: %w", statefulSetName, err)
+	}
+	objects := []*corev1.ObjectReference{{
+		Kind:       "StatefulSet",
+		APIVersion: "apps/v1",
+		Namespace:  namespace,
+		Name:       statefulSet.Name,
+		UID:        statefulSet.UID,
+	}}
+
+	if dynamicClient != nil {
+		cluster, err := utils.GetValkeyCluster(ctx, dynamicClient, namespace, clusterName)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get valkeycluster %s for events: %w", clusterName, err)
+		}
+		if cluster != nil {
+			objects = append(objects, &corev1.ObjectReference{
+				Kind:       v1alpha1.Kind,
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Namespace:  namespace,
+				Name:       cluster.Name,
+				UID:        cluster.UID,
+			})
+		}
+	}
+
+	sink := &countingSink{EventSink: &typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events(namespace)}}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(sink)
+	return &Recorder{
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component}),
+		objects:     objects,
+		sink:        sink,
+	}, nil
+}
+
+func (r *Recorder) Normal(reason, messageFmt string, args ...any) {
+	r.event(corev1.EventTypeNormal, reason, messageFmt, args...)
+}
+
+func (r *Recorder) Warning(reason, messageFmt string, args ...any) {
+	r.event(corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+func (r *Recorder) event(eventType, reason, messageFmt string, args ...any) {
+	if r == nil {
+		return
+	}
+	for _, object := range r.objects {
+		r.recorded.Add(1)
+		r.recorder.Eventf(object, eventType, reason, messageFmt, args...)
+	}
+}
+
+// Shutdown waits (up to timeout) for the recorded events to be written and stops the recorder. events
+// are written in the background so a one-shot command would otherwise exit before they are sent.
+func (r *Recorder) Shutdown(timeout time.Duration) {
+	if r == nil {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	for r.sink.written.Load() < r.recorded.Load() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	r.broadcaster.Shutdown()
+}
+
+// counts the events that made it to the api server so Shutdown knows when everything is flushed
+type countingSink struct {
+	record.EventSink
+	written atomic.Int64
+}
+
+func (s *countingSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	created, err := s.EventSink.Create(event)
+	if err == nil {
+		s.written.Add(1)
+	}
+	return created, err
+}
+
+func (s *countingSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	patched, err := s.EventSink.Patch(event, data)
+	if err == nil {
+		s.written.Add(1)
+	}
+	return patched, err
+}
+
+type contextKey struct{}
+
+func WithRecorder(ctx context.Context, recorder *Recorder) context.Context {
+	return context.WithValue(ctx, contextKey{}, recorder)
+}
+
+// FromContext returns the recorder carried by ctx or nil (which drops events) when there is none
+func FromContext(ctx context.Context) *Recorder {
+	recorder, _ := ctx.Value(contextKey{}).(*Recorder)
+	return recorder
+}
+
+// Normal records an event with the recorder carried by ctx. the message is logged at debug level too
+func Normal(ctx context.Context, reason, messageFmt string, args ...any) {
+	logging.FromContext(ctx).Debug("Recording event", "reason", reason, "message", fmt.Sprintf(messageFmt, args...))
+	FromContext(ctx).Normal(reason, messageFmt, args...)
+}
+
+func Warning(ctx context.Context, reason, messageFmt string, args ...any) {
+	logging.FromContext(ctx).Debug("Recording event", "reason", reason, "message", fmt.Sprintf(messageFmt, args...))
+	FromContext(ctx).Warning(reason, messageFmt, args...)
+}
@@ -0,0 +1,70 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+	"valkey/reconciler/internal/utils"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+	env := utils.Env{ClusterName: "test", Namespace: "default", NamePrefix: "valkey"}
+
+	t.Run("records on the statefulset", func(t *testing.T) {
+		clientset := fake.NewClientset(&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "valkey-test", Namespace: "default", UID: "sts-uid"},
+		})
+
+		recorder, err := NewRecorder(ctx, clientset, nil, env)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ctx := WithRecorder(ctx, recorder)
+		Normal(ctx, ReasonNodeAdded, "Added node %s", "valkey-test-3")
+		Warning(ctx, ReasonOperationFailed, "scale-up failed during %s", "rebalance")
+		recorder.Shutdown(5 * time.Second)
+
+		eventList, err := clientset.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(eventList.Items) != 2 {
+			t.Fatalf("expected 2 events, got %d", len(eventList.Items))
+		}
+
+		got := map[string]corev1.Event{}
+		for _, event := range eventList.Items {
+			got[event.Reason] = event
+		}
+		added, exists := got[ReasonNodeAdded]
+		if !exists {
+			t.Fatalf("expected a %s event, got %v", ReasonNodeAdded, got)
+		}
+		if added.Type != corev1.EventTypeNormal || added.Message != "Added node valkey-test-3" {
+			t.Errorf("unexpected event %s %q", added.Type, added.Message)
+		}
+		if added.InvolvedObject.Kind != "StatefulSet" || added.InvolvedObject.UID != "sts-uid" {
+			t.Errorf("expected the event on the statefulset, got %+v", added.InvolvedObject)
+		}
+		if got[ReasonOperationFailed].Type != corev1.EventTypeWarning {
+			t.Errorf("expected a warning for %s", ReasonOperationFailed)
+		}
+	})
+
+	t.Run("missing statefulset", func(t *testing.T) {
+		if _, err := NewRecorder(ctx, fake.NewClientset(), nil, env); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("no recorder drops events", func(t *testing.T) {
+		Normal(ctx, ReasonClusterCreated, "Created cluster")
+		FromContext(ctx).Shutdown(time.Second)
+	})
+}
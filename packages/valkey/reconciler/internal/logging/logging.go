@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+const redacted = "REDACTED"
+
+// New builds a logger from LOG_FORMAT/LOG_LEVEL style values. empty values default to text and info.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	if level != "" {
+		if err := slogLevel.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("log level must be debug, info, warn or error: %w", err)
+		}
+	}
+
+	options := &slog.HandlerOptions{Level: slogLevel, ReplaceAttr: redactAttr}
+	switch Format(format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("log format must be %q or %q", FormatText, FormatJSON)
+	}
+}
+
+type contextKey struct{}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx or the default logger when there is none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With adds attributes to the logger carried by ctx
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+// RedactArgs hides the values of valkey-cli flags that carry secrets so a command line can be logged
+func RedactArgs(args []string) []string {
+	redactedArgs := make([]string, len(args))
+	copy(redactedArgs, args)
+	for i := 0; i < len(redactedArgs)-1; i++ {
+		switch redactedArgs[i] {
+		case "-a", "--pass":
+			redactedArgs[i+1] = redacted
+			i++
+		}
+	}
+	return redactedArgs
+}
+
+// anything that looks like a secret is never written out, even if it is logged by mistake
+func redactAttr(_ []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	if strings.Contains(key, "password") || strings.Contains(key, "secret") || strings.Contains(key, "token") {
+		return slog.String(attr.Key, redacted)
+	}
+	return attr
+}
@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		level     string
+		wantDebug bool
+		wantJSON  bool
+		wantErr   bool
+	}{
+		{name: "defaults", wantDebug: false},
+		{name: "json debug", format: "json", level: "debug", wantDebug: true, wantJSON: true},
+		{name: "text warn", format: "text", level: "WARN"},
+		{name: "unknown format", format: "yaml", wantErr: true},
+		{name: "unknown level", level: "loud", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, test.format, test.level)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			logger.Debug("debug message")
+			if got := strings.Contains(buf.String(), "debug message"); got != test.wantDebug {
+				t.Errorf("debug logged = %v, want %v", got, test.wantDebug)
+			}
+
+			buf.Reset()
+			logger.Error("error message")
+			if got := json.Valid(buf.Bytes()); got != test.wantJSON {
+				t.Errorf("json output = %v, want %v: %s", got, test.wantJSON, buf.String())
+			}
+		})
+	}
+}
+
+func TestNew_RedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", "info")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logger.Info("connecting", "hostname", "valkey-test-0", "adminPassword", "hunter2")
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("password was logged: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "valkey-test-0") {
+		t.Errorf("expected the other attributes to be logged: %s", buf.String())
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "no password",
+			args: []string{"--cluster", "del-node", "host:6379", "abc"},
+			want: []string{"--cluster", "del-node", "host:6379", "abc"},
+		},
+		{
+			name: "short flag",
+			args: []string{"--cluster", "add-node", "a:6379", "b:6379", "--user", "admin", "-a", "hunter2"},
+			want: []string{"--cluster", "add-node", "a:6379", "b:6379", "--user", "admin", "-a", "REDACTED"},
+		},
+		{
+			name: "long flag",
+			args: []string{"--pass", "hunter2", "ping"},
+			want: []string{"--pass", "REDACTED", "ping"},
+		},
+		{
+			name: "trailing flag without a value",
+			args: []string{"ping", "-a"},
+			want: []string{"ping", "-a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := slices.Clone(test.args)
+			got := RedactArgs(test.args)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("RedactArgs() = %v, want %v", got, test.want)
+			}
+			if !slices.Equal(test.args, original) {
+				t.Errorf("RedactArgs modified its input: %v", test.args)
+			}
+		})
+	}
+}
+
+func TestWith(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", "info")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := With(WithLogger(context.Background(), logger), "cluster", "test", "step", "rebalance")
+	FromContext(ctx).Info("moving slots")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if record["cluster"] != "test" || record["step"] != "rebalance" {
+		t.Errorf("expected context attributes on the record, got %v", record)
+	}
+}
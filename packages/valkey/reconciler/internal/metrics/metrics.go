@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const (
+	namespace = "valkey_reconciler"
+	pushJob   = "valkey-reconciler"
+)
+
+// own registry instead of the global one so the pushgateway only gets reconciler metrics and not the
+// go runtime metrics of a process that is about to exit
+var Registry *prometheus.Registry
+
+var (
+	operations        *prometheus.CounterVec
+	operationDuration *prometheus.HistogramVec
+	failures          *prometheus.CounterVec
+	nodesAdded        prometheus.Counter
+	nodesRemoved      prometheus.Counter
+	slotsMigrated     prometheus.Counter
+	waitDuration      *prometheus.HistogramVec
+)
+
+func init() {
+	reset()
+}
+
+// reset registers every metric from zero in a new registry. tests call it so they don't see each
+// other's counts
+func reset() {
+	Registry = prometheus.NewRegistry()
+
+	operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Reconciler operations by subcommand and result.",
+	}, []string{"operation", "result"})
+
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "How long reconciler operations took by subcommand.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"operation"})
+
+	failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failures_total",
+		Help:      "Failed reconciler operations by subcommand and the step that failed.",
+	}, []string{"operation", "step"})
+
+	nodesAdded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nodes_added_total",
+		Help:      "Nodes added to the cluster.",
+	})
+
+	nodesRemoved = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nodes_removed_total",
+		Help:      "Nodes removed from the cluster.",
+	})
+
+	slotsMigrated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slots_migrated_total",
+		Help:      "Hash slots migrated between masters.",
+	})
+
+	waitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "wait_duration_seconds",
+		Help:      "Time spent waiting for the cluster to converge by wait kind and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 12), // 0.25s to ~8.5m
+	}, []string{"wait", "result"})
+
+	Registry.MustRegister(operations, operationDuration, failures, nodesAdded, nodesRemoved, slotsMigrated, waitDuration)
+}
+
+// ObserveOperation records the result and duration of a subcommand. step is what was running when it
+// failed and is ignored on success.
+func ObserveOperation(operation, step string, startTime time.Time, err error) {
+	result := "succeeded"
+	if err != nil {
+		result = "failed"
+		failures.WithLabelValues(operation, step).Inc()
+	}
+	operations.WithLabelValues(operation, result).Inc()
+	operationDuration.WithLabelValues(operation).Observe(time.Since(startTime).Seconds())
+}
+
+func NodesAdded(count int) {
+	nodesAdded.Add(float64(count))
+}
+
+func NodesRemoved(count int) {
+	nodesRemoved.Add(float64(count))
+}
+
+func SlotMigrated() {
+	slotsMigrated.Inc()
+}
+
+// ObserveWait records how long a wait for the cluster to converge took. meant to be deferred with a
+// pointer to the named error result.
+func ObserveWait(wait string, startTime time.Time, err *error) {
+	result := "converged"
+	if err != nil && *err != nil {
+		result = "failed"
+	}
+	waitDuration.WithLabelValues(wait, result).Observe(time.Since(startTime).Seconds())
+}
+
+// Serve exposes /metrics until ctx is cancelled
+func Serve(ctx context.Context, address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("metrics server: %w", err)
+	}
+	return nil
+}
+
+// Push sends everything recorded by this process to a pushgateway. one-shot commands exit before
+// prometheus could scrape them. every subcommand of a cluster gets its own group so a scale-up doesn't
+// replace the metrics of the scale-down that ran before it.
+func Push(ctx context.Context, url, operation, clusterName, clusterNamespace string) error {
+	err := push.New(url, pushJob).
+		Gatherer(Registry).
+		Grouping("namespace", clusterNamespace).
+		Grouping("cluster", clusterName).
+		Grouping("subcommand", operation).
+		PushContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", url, err)
+	}
+	return nil
+}
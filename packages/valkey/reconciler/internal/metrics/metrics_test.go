@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveOperation(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantSucceeded float64
+		wantFailed    float64
+		wantFailures  float64
+	}{
+		{name: "succeeded", wantSucceeded: 1},
+		{name: "failed", err: errors.New("boom"), wantFailed: 1, wantFailures: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reset()
+			operation := "test-" + test.name
+			ObserveOperation(operation, "add-masters", time.Now(), test.err)
+
+			if got := testutil.ToFloat64(operations.WithLabelValues(operation, "succeeded")); got != test.wantSucceeded {
+				t.Errorf("succeeded = %v, want %v", got, test.wantSucceeded)
+			}
+			if got := testutil.ToFloat64(operations.WithLabelValues(operation, "failed")); got != test.wantFailed {
+				t.Errorf("failed = %v, want %v", got, test.wantFailed)
+			}
+			if got := testutil.ToFloat64(failures.WithLabelValues(operation, "add-masters")); got != test.wantFailures {
+				t.Errorf("failures = %v, want %v", got, test.wantFailures)
+			}
+		})
+	}
+}
+
+func TestPush(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		body   string
+	}
+	requests := make(chan request, 1)
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{method: r.Method, path: r.URL.Path, body: string(body)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer pushgateway.Close()
+
+	reset()
+	NodesAdded(2)
+	ObserveOperation("scale-up", "rebalance", time.Now(), nil)
+
+	if err := Push(context.Background(), pushgateway.URL, "scale-up", "example", "default"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := <-requests
+	if got.method != http.MethodPut {
+		t.Errorf("method = %s, want %s", got.method, http.MethodPut)
+	}
+	// the grouping labels come out of a map so their order in the path isn't fixed
+	grouping, found := strings.CutPrefix(got.path, "/metrics/job/valkey-reconciler/")
+	if !found {
+		t.Fatalf("path = %s, want it under the valkey-reconciler job", got.path)
+	}
+	pairs := strings.Split(grouping, "/")
+	labels := map[string]string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels[pairs[i]] = pairs[i+1]
+	}
+	if want := map[string]string{"namespace": "default", "cluster": "example", "subcommand": "scale-up"}; len(pairs)%2 != 0 || !maps.Equal(labels, want) {
+		t.Errorf("grouping = %s, want the labels %v", grouping, want)
+	}
+	for _, name := range []string{"valkey_reconciler_operations_total", "valkey_reconciler_nodes_added_total"} {
+		if !strings.Contains(got.body, name) {
+			t.Errorf("pushed metrics are missing %s", name)
+		}
+	}
+}
+
+func TestPush_Error(t *testing.T) {
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer pushgateway.Close()
+
+	if err := Push(context.Background(), pushgateway.URL, "scale-down", "example", "default"); err == nil {
+		t.Fatal("expected an error when the pushgateway rejects the push")
+	}
+}
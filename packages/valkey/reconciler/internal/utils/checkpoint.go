@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const checkpointKey = "checkpoint"
+
+// Checkpoint is the last step a scale operation started. it is removed once the operation completes so
+// finding one means the previous run was interrupted and the cluster is part way through a change.
+type Checkpoint struct {
+	Operation         string    `json:"operation"`
+	Phase             string    `json:"phase"`
+	Step              string    `json:"step,omitempty"` // what the phase was working on (ie. the shard being removed)
+	Masters           int       `json:"masters"`
+	ReplicasPerMaster int       `json:"replicasPerMaster"`
+	StartTime         time.Time `json:"startTime"`
+	UpdateTime        time.Time `json:"updateTime"`
+
+	// reconcile keeps its plan so a resumed run carries on with the step it was interrupted in
+	Plan      json.RawMessage `json:"plan,omitempty"`
+	Completed int             `json:"completed,omitempty"` // plan steps that finished
+}
+
+func GetCheckpointConfigMapName(env Env) string {
+	return fmt.Sprintf("%s-%s-reconciler-state", env.NamePrefix, env.ClusterName)
+}
+
+// returns nil when there is no operation in progress
+func LoadCheckpoint(ctx context.Context, clientset kubernetes.Interface, env Env) (*Checkpoint, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps(env.Namespace).Get(ctx, GetCheckpointConfigMapName(env), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint configmap: %w", err)
+	}
+
+	data, exists := configMap.Data[checkpointKey]
+	if !exists || data == "" {
+		return nil, nil
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal([]byte(data), &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+	return &checkpoint, nil
+}
+
+func SaveCheckpoint(ctx context.Context, clientset kubernetes.Interface, env Env, checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	configMaps := clientset.CoreV1().ConfigMaps(env.Namespace)
+	configMapName := GetCheckpointConfigMapName(env)
+	configMap, err := configMaps.Get(ctx, configMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configMapName,
+				Namespace: env.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "valkey-reconciler"},
+			},
+			Data: map[string]string{checkpointKey: string(data)},
+		}
+		if _, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create checkpoint configmap: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get checkpoint configmap: %w", err)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[checkpointKey] = string(data)
+	if _, err := configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update checkpoint configmap: %w", err)
+	}
+	return nil
+}
+
+func ClearCheckpoint(ctx context.Context, clientset kubernetes.Interface, env Env) error {
+	err := clientset.CoreV1().ConfigMaps(env.Namespace).Delete(ctx, GetCheckpointConfigMapName(env), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete checkpoint configmap: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Credentials is the kubernetes secret the nodes' acl passwords come from. rotate-credentials writes the
+// new passwords to it and the controller re-reads its own password from it, everything else gets its
+// password through the environment
+type Credentials struct {
+	Secret string            // name of the secret. rotate-credentials refuses to run when empty
+	Keys   map[string]string // acl user -> data key of its password in the secret
+}
+
+func loadCredentials() Credentials {
+	return Credentials{
+		Secret: os.Getenv("CREDENTIALS_SECRET"),
+		Keys: map[string]string{
+			"admin":      envOrDefault("ADMIN_PASSWORD_KEY", "ADMIN_PASSWORD"),
+			"client":     envOrDefault("CLIENT_PASSWORD_KEY", "CLIENT_PASSWORD"),
+			"reconciler": envOrDefault("RECONCILER_PASSWORD_KEY", "RECONCILER_PASSWORD"),
+		},
+	}
+}
+
+func envOrDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// CurrentPassword reads the password of the acl user the reconciler authenticates as from the secret so
+// a long running process picks up a rotated password. empty when there is no secret or key to read
+func CurrentPassword(ctx context.Context, clientset kubernetes.Interface, env Env) (string, error) {
+	key, exists := env.Credentials.Keys[env.Username]
+	if env.Credentials.Secret == "" || !exists {
+		return "", nil
+	}
+	data, err := GetSecretData(ctx, clientset, env.Namespace, env.Credentials.Secret)
+	if err != nil {
+		return "", err
+	}
+	return string(data[key]), nil
+}
+
+// GetSecretData returns the data of the secret
+func GetSecretData(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (map[string][]byte, error) {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+	return secret.Data, nil
+}
+
+// UpdateSecretData sets the given keys of the secret and leaves the rest alone
+func UpdateSecretData(ctx context.Context, clientset kubernetes.Interface, namespace, name string, data map[string]string) error {
+	secrets := clientset.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	for key, value := range data {
+		secret.Data[key] = []byte(value)
+	}
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCurrentPassword(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "valkey-test-creds", Namespace: "default"},
+		Data:       map[string][]byte{"ADMIN_PASSWORD": []byte("admin"), "RECONCILER_PASSWORD": []byte("rotated")},
+	})
+	credentials := Credentials{
+		Secret: "valkey-test-creds",
+		Keys:   map[string]string{"admin": "ADMIN_PASSWORD", "reconciler": "RECONCILER_PASSWORD"},
+	}
+
+	tests := []struct {
+		name string
+		env  Env
+		want string
+	}{
+		{name: "reconciler user", env: Env{Namespace: "default", Username: "reconciler", Credentials: credentials}, want: "rotated"},
+		{name: "running as admin", env: Env{Namespace: "default", Username: "admin", Credentials: credentials}, want: "admin"},
+		{name: "no secret", env: Env{Namespace: "default", Username: "reconciler"}},
+		{name: "user without a key", env: Env{Namespace: "default", Username: "ops", Credentials: credentials}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := CurrentPassword(ctx, clientset, test.env)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("CurrentPassword() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type DiscoveryMode string
+
+const (
+	DiscoveryDNS        DiscoveryMode = "dns"        // SRV records of the headless service
+	DiscoveryKubernetes DiscoveryMode = "kubernetes" // pod list of the statefulset
+)
+
+// Pod is a pod of the statefulset as discovery found it
+type Pod struct {
+	Index    int
+	Name     string
+	Address  string // client address (headless service hostname:client port) the node announces
+	IP       string
+	NodeName string // kubernetes node. empty with dns discovery
+	Ready    bool   // always true with dns discovery, which can't tell
+}
+
+// Discovery finds the pods of the statefulset that have an address
+type Discovery interface {
+	Pods(ctx context.Context, env Env) ([]Pod, error)
+}
+
+// DiscoverPods finds the pods with env.Discovery (dns when unset), in pod index order
+func DiscoverPods(ctx context.Context, env Env) ([]Pod, error) {
+	discovery := env.Discovery
+	if discovery == nil {
+		discovery = DNSDiscovery{}
+	}
+	pods, err := discovery.Pods(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Index < pods[j].Index })
+	return pods, nil
+}
+
+// DNSDiscovery reads the SRV records of the headless service. the service publishes not ready pods too
+// and has a record for the bus port next to the client port so only the client port records are kept.
+// records can lag behind a rollout by the dns cache ttl
+type DNSDiscovery struct{}
+
+func (DNSDiscovery) Pods(ctx context.Context, env Env) ([]Pod, error) {
+	var resolver net.Resolver
+	serviceFQDN := GetHeadlessServiceFQDN(env)
+	_, records, err := resolver.LookupSRV(ctx, "", "", serviceFQDN)
+	if err != nil {
+		return nil, fmt.Errorf("look up pods of %s: %w", serviceFQDN, err)
+	}
+
+	pods := make([]Pod, 0, len(records))
+	for _, record := range records {
+		if int(record.Port) != env.ClientPort {
+			continue
+		}
+		hostname := strings.TrimSuffix(record.Target, ".")
+		podName, _, _ := strings.Cut(hostname, ".")
+		index, ok := podIndex(env, podName)
+		if !ok {
+			continue
+		}
+
+		pod := Pod{Index: index, Name: podName, Address: GetPodAddress(env, index), Ready: true}
+		if ips, err := resolver.LookupHost(ctx, hostname); err == nil && len(ips) > 0 {
+			pod.IP = ips[0]
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// KubernetesDiscovery lists the pods of the statefulset from the api server, which is current during
+// rollouts and knows whether a pod is ready and which node it runs on. needs pods list
+type KubernetesDiscovery struct {
+	Clientset kubernetes.Interface
+}
+
+func (d KubernetesDiscovery) Pods(ctx context.Context, env Env) ([]Pod, error) {
+	items, err := listStatefulSetPods(ctx, d.Clientset, env)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]Pod, 0, len(items))
+	for _, item := range items {
+		index, ok := podIndex(env, item.Name)
+		// without an ip the pod has no dns record to be reached at yet
+		if !ok || item.Status.PodIP == "" {
+			continue
+		}
+		pods = append(pods, Pod{
+			Index:    index,
+			Name:     item.Name,
+			Address:  GetPodAddress(env, index),
+			IP:       item.Status.PodIP,
+			NodeName: item.Spec.NodeName,
+			Ready:    podReady(item),
+		})
+	}
+	return pods, nil
+}
+
+func listStatefulSetPods(ctx context.Context, clientset kubernetes.Interface, env Env) ([]corev1.Pod, error) {
+	pods, err := clientset.CoreV1().Pods(env.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + GetStatefulsetName(env)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	return pods.Items, nil
+}
+
+// the index of a pod of the statefulset from its name. false for anything else
+func podIndex(env Env, podName string) (int, bool) {
+	suffix, found := strings.CutPrefix(podName, GetStatefulsetName(env)+"-")
+	if !found {
+		return 0, false
+	}
+	index, err := strconv.Atoi(suffix)
+	return index, err == nil && index >= 0
+}
+
+func podReady(pod corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func loadDiscovery() (Discovery, error) {
+	switch mode := DiscoveryMode(os.Getenv("DISCOVERY")); mode {
+	case "", DiscoveryDNS:
+		return DNSDiscovery{}, nil
+	case DiscoveryKubernetes:
+		clientset, err := NewKubernetesClient()
+		if err != nil {
+			return nil, err
+		}
+		return KubernetesDiscovery{Clientset: clientset}, nil
+	default:
+		return nil, fmt.Errorf("DISCOVERY environment variable must be %q or %q", DiscoveryDNS, DiscoveryKubernetes)
+	}
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func discoveryPod(name, ip, nodeName string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "valkey-test"}},
+		Spec:       corev1.PodSpec{NodeName: nodeName},
+		Status: corev1.PodStatus{
+			PodIP:      ip,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestKubernetesDiscovery(t *testing.T) {
+	env := Env{ClusterName: "test", Namespace: "default", ClientPort: 6379, NamePrefix: "valkey", ClusterDomain: "cluster.local"}
+	other := discoveryPod("valkey-other-0", "10.0.0.9", "n1", true)
+	other.Labels["app"] = "valkey-other"
+	clientset := fake.NewClientset(
+		discoveryPod("valkey-test-10", "10.0.0.10", "n2", true),
+		discoveryPod("valkey-test-2", "10.0.0.2", "n1", false),
+		discoveryPod("valkey-test-0", "10.0.0.1", "n1", true),
+		discoveryPod("valkey-test-3", "", "", false), // pending
+		other,
+	)
+	env.Discovery = KubernetesDiscovery{Clientset: clientset}
+
+	pods, err := DiscoverPods(context.Background(), env)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Pod{
+		{Index: 0, Name: "valkey-test-0", Address: "valkey-test-0.valkey-test-headless.default.svc.cluster.local:6379", IP: "10.0.0.1", NodeName: "n1", Ready: true},
+		{Index: 2, Name: "valkey-test-2", Address: "valkey-test-2.valkey-test-headless.default.svc.cluster.local:6379", IP: "10.0.0.2", NodeName: "n1"},
+		{Index: 10, Name: "valkey-test-10", Address: "valkey-test-10.valkey-test-headless.default.svc.cluster.local:6379", IP: "10.0.0.10", NodeName: "n2", Ready: true},
+	}
+	if !reflect.DeepEqual(pods, want) {
+		t.Errorf("DiscoverPods() = %+v, want %+v", pods, want)
+	}
+}
+
+func TestPodIndex(t *testing.T) {
+	env := Env{ClusterName: "test", NamePrefix: "valkey"}
+	tests := []struct {
+		podName string
+		want    int
+		wantOK  bool
+	}{
+		{podName: "valkey-test-0", want: 0, wantOK: true},
+		{podName: "valkey-test-12", want: 12, wantOK: true},
+		{podName: "valkey-test-reconciler-abc12", wantOK: false},
+		{podName: "valkey-testing-1", wantOK: false},
+		{podName: "valkey-test--1", wantOK: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.podName, func(t *testing.T) {
+			got, ok := podIndex(env, test.podName)
+			if ok != test.wantOK || (ok && got != test.want) {
+				t.Errorf("podIndex(%s) = %d, %v, want %d, %v", test.podName, got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadDiscovery(t *testing.T) {
+	t.Setenv("DISCOVERY", "")
+	if discovery, err := loadDiscovery(); err != nil || discovery != (DNSDiscovery{}) {
+		t.Errorf("loadDiscovery() = %v, %v, want dns", discovery, err)
+	}
+	t.Setenv("DISCOVERY", "consul")
+	if _, err := loadDiscovery(); err == nil {
+		t.Errorf("expected an error for an unknown discovery")
+	}
+}
@@ -4,6 +4,27 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultResyncInterval = 30 * time.Second
+	defaultMetricsAddress = ":8080"
+	defaultClientPort     = 6379
+	defaultNamePrefix     = "valkey"
+	defaultClusterDomain  = "cluster.local"
+	defaultUsername       = "reconciler"
+
+	// the cluster bus listens on the client port + 10000 unless cluster-port is set
+	busPortOffset = 10000
+)
+
+type SpecSource string
+
+const (
+	SpecFromEnv      SpecSource = "env"      // MASTERS & REPLICAS_PER_MASTER environment variables
+	SpecFromResource SpecSource = "resource" // spec of the ValkeyCluster resource named CLUSTER_NAME
 )
 
 type Env struct {
@@ -11,7 +32,21 @@ type Env struct {
 	Namespace         string
 	Masters           int
 	ReplicasPerMaster int
-	AdminPassword     string
+	Username          string // acl user the reconciler authenticates as
+	Password          string
+	ResyncInterval    time.Duration // how often the controller re-checks the cluster without a watch event
+	SpecSource        SpecSource
+	MetricsAddress    string // where the controller serves /metrics
+	PushgatewayURL    string // one-shot commands push their metrics here when set
+
+	ClientPort    int    // port the nodes serve clients on
+	BusPort       int    // cluster bus port. client port + 10000 by default
+	NamePrefix    string // kubernetes objects are named <prefix>-<cluster name>
+	ClusterDomain string // kubernetes cluster dns domain the service fqdns end in
+	TLS           *TLS   // nil when the nodes are reached without tls
+
+	Credentials Credentials
+	Discovery   Discovery // how the pods are found. nil is DNSDiscovery
 }
 
 func Load() (Env, error) {
@@ -25,19 +60,88 @@ func Load() (Env, error) {
 		return Env{}, fmt.Errorf("NAMESPACE environment variable is not set")
 	}
 
-	masters, err := strconv.Atoi(os.Getenv("MASTERS"))
+	specSource := SpecSource(os.Getenv("SPEC_SOURCE"))
+	switch specSource {
+	case "":
+		specSource = SpecFromEnv
+	case SpecFromEnv, SpecFromResource:
+	default:
+		return Env{}, fmt.Errorf("SPEC_SOURCE environment variable must be %q or %q", SpecFromEnv, SpecFromResource)
+	}
+
+	// NOTE: when the spec comes from the ValkeyCluster resource these are filled in by
+	// ApplyValkeyClusterSpec once a kubernetes client is available
+	var masters, replicasPerMaster int
+	var err error
+	if specSource == SpecFromEnv {
+		masters, err = strconv.Atoi(os.Getenv("MASTERS"))
+		if err != nil {
+			return Env{}, fmt.Errorf("MASTERS environment variable is not set")
+		}
+
+		replicasPerMaster, err = strconv.Atoi(os.Getenv("REPLICAS_PER_MASTER"))
+		if err != nil {
+			return Env{}, fmt.Errorf("REPLICAS_PER_MASTER environment variable is not set")
+		}
+	}
+
+	username := os.Getenv("RECONCILER_USERNAME")
+	if username == "" {
+		username = defaultUsername
+	}
+
+	password := os.Getenv("RECONCILER_PASSWORD")
+	if password == "" {
+		return Env{}, fmt.Errorf("RECONCILER_PASSWORD environment variable is not set")
+	}
+
+	resyncInterval := defaultResyncInterval
+	if value := os.Getenv("RESYNC_INTERVAL"); value != "" {
+		resyncInterval, err = time.ParseDuration(value)
+		if err != nil || resyncInterval <= 0 {
+			return Env{}, fmt.Errorf("RESYNC_INTERVAL environment variable must be a positive duration")
+		}
+	}
+
+	metricsAddress := os.Getenv("METRICS_ADDRESS")
+	if metricsAddress == "" {
+		metricsAddress = defaultMetricsAddress
+	}
+
+	clientPort, err := loadPort("CLIENT_PORT", defaultClientPort)
 	if err != nil {
-		return Env{}, fmt.Errorf("MASTERS environment variable is not set")
+		return Env{}, err
+	}
+	busPort, err := loadPort("BUS_PORT", clientPort+busPortOffset)
+	if err != nil {
+		return Env{}, err
+	}
+	if busPort > 65535 {
+		return Env{}, fmt.Errorf("BUS_PORT environment variable must be set when CLIENT_PORT is above %d", 65535-busPortOffset)
+	}
+	if busPort == clientPort {
+		return Env{}, fmt.Errorf("BUS_PORT environment variable must differ from CLIENT_PORT")
 	}
 
-	replicasPerMaster, err := strconv.Atoi(os.Getenv("REPLICAS_PER_MASTER"))
+	namePrefix := os.Getenv("NAME_PREFIX")
+	if namePrefix == "" {
+		namePrefix = defaultNamePrefix
+	}
+
+	// a trailing dot would make the fqdns absolute which the nodes don't announce
+	clusterDomain := strings.Trim(os.Getenv("CLUSTER_DOMAIN"), ".")
+	if clusterDomain == "" {
+		clusterDomain = defaultClusterDomain
+	}
+
+	tlsFiles, err := loadTLS()
 	if err != nil {
-		return Env{}, fmt.Errorf("REPLICAS_PER_MASTER environment variable is not set")
+		return Env{}, err
 	}
 
-	adminPassword := os.Getenv("ADMIN_PASSWORD")
-	if adminPassword == "" {
-		return Env{}, fmt.Errorf("ADMIN_PASSWORD environment variable is not set")
+	discovery, err := loadDiscovery()
+	if err != nil {
+		return Env{}, err
 	}
 
 	return Env{
@@ -45,6 +149,30 @@ func Load() (Env, error) {
 		Namespace:         namespace,
 		Masters:           masters,
 		ReplicasPerMaster: replicasPerMaster,
-		AdminPassword:     adminPassword,
+		Username:          username,
+		Password:          password,
+		ResyncInterval:    resyncInterval,
+		SpecSource:        specSource,
+		MetricsAddress:    metricsAddress,
+		PushgatewayURL:    os.Getenv("PUSHGATEWAY_URL"),
+		ClientPort:        clientPort,
+		BusPort:           busPort,
+		NamePrefix:        namePrefix,
+		ClusterDomain:     clusterDomain,
+		TLS:               tlsFiles,
+		Credentials:       loadCredentials(),
+		Discovery:         discovery,
 	}, nil
 }
+
+func loadPort(name string, defaultPort int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultPort, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("%s environment variable must be a port between 1 and 65535", name)
+	}
+	return port, nil
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestLoadNaming(t *testing.T) {
+	tests := []struct {
+		name        string
+		vars        map[string]string
+		wantErr     bool
+		wantClient  int
+		wantBus     int
+		wantAddress string
+	}{
+		{
+			name:        "defaults",
+			wantClient:  6379,
+			wantBus:     16379,
+			wantAddress: "valkey-test-2.valkey-test-headless.default.svc.cluster.local:6379",
+		},
+		{
+			name:        "bus port follows the client port",
+			vars:        map[string]string{"CLIENT_PORT": "7000", "NAME_PREFIX": "cache", "CLUSTER_DOMAIN": "k8s.example.com."},
+			wantClient:  7000,
+			wantBus:     17000,
+			wantAddress: "cache-test-2.cache-test-headless.default.svc.k8s.example.com:7000",
+		},
+		{
+			name:        "explicit bus port",
+			vars:        map[string]string{"CLIENT_PORT": "7000", "BUS_PORT": "7001"},
+			wantClient:  7000,
+			wantBus:     7001,
+			wantAddress: "valkey-test-2.valkey-test-headless.default.svc.cluster.local:7000",
+		},
+		{
+			name:    "invalid port",
+			vars:    map[string]string{"CLIENT_PORT": "70000"},
+			wantErr: true,
+		},
+		{
+			name:    "default bus port out of range",
+			vars:    map[string]string{"CLIENT_PORT": "60000"},
+			wantErr: true,
+		},
+		{
+			name:    "bus port same as the client port",
+			vars:    map[string]string{"BUS_PORT": "6379"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("CLUSTER_NAME", "test")
+			t.Setenv("NAMESPACE", "default")
+			t.Setenv("MASTERS", "1")
+			t.Setenv("REPLICAS_PER_MASTER", "0")
+			t.Setenv("RECONCILER_PASSWORD", "secret")
+			for _, name := range []string{"CLIENT_PORT", "BUS_PORT", "NAME_PREFIX", "CLUSTER_DOMAIN"} {
+				t.Setenv(name, test.vars[name])
+			}
+
+			env, err := Load()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", env)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if env.ClientPort != test.wantClient || env.BusPort != test.wantBus {
+				t.Errorf("ports = %d/%d, want %d/%d", env.ClientPort, env.BusPort, test.wantClient, test.wantBus)
+			}
+			if address := GetPodAddress(env, 2); address != test.wantAddress {
+				t.Errorf("pod address = %q, want %q", address, test.wantAddress)
+			}
+		})
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		wantTLS bool
+		wantErr bool
+	}{
+		{
+			name:    "off by default",
+			wantTLS: false,
+		},
+		{
+			name:    "system pool",
+			vars:    map[string]string{"TLS_ENABLED": "true"},
+			wantTLS: true,
+		},
+		{
+			name:    "invalid switch",
+			vars:    map[string]string{"TLS_ENABLED": "yes"},
+			wantErr: true,
+		},
+		{
+			name:    "certificate without a key",
+			vars:    map[string]string{"TLS_ENABLED": "true", "TLS_CERT_FILE": "/tls/tls.crt"},
+			wantErr: true,
+		},
+		{
+			name:    "missing ca file",
+			vars:    map[string]string{"TLS_ENABLED": "true", "TLS_CA_CERT_FILE": "/does/not/exist"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"TLS_ENABLED", "TLS_CA_CERT_FILE", "TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_SERVER_NAME"} {
+				t.Setenv(name, test.vars[name])
+			}
+
+			tlsFiles, err := loadTLS()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", tlsFiles)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (tlsFiles != nil) != test.wantTLS {
+				t.Errorf("tls = %+v, want enabled %v", tlsFiles, test.wantTLS)
+			}
+		})
+	}
+}
@@ -5,69 +5,151 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"strconv"
 	"time"
+	"valkey/reconciler/internal/logging"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
-func GetClusterServiceFQDN(name, namespace string) string {
-	return fmt.Sprintf("valkey-%s-cluster.%s.svc.cluster.local", name, namespace)
+func GetClusterServiceFQDN(env Env) string {
+	return fmt.Sprintf("%s-cluster.%s.svc.%s", GetStatefulsetName(env), env.Namespace, env.ClusterDomain)
 }
 
-func GetPodHeadlessServiceFQDN(name, namespace string, index int) string {
-	return fmt.Sprintf("%s.%s", GetStatefulsetPodName(name, index), GetHeadlessServiceFQDN(name, namespace))
+func GetPodHeadlessServiceFQDN(env Env, index int) string {
+	return fmt.Sprintf("%s.%s", GetStatefulsetPodName(env, index), GetHeadlessServiceFQDN(env))
 }
 
-func GetHeadlessServiceFQDN(name, namespace string) string {
-	return fmt.Sprintf("valkey-%s-headless.%s.svc.cluster.local", name, namespace)
+// client address (hostname:port) of the pod
+func GetPodAddress(env Env, index int) string {
+	return net.JoinHostPort(GetPodHeadlessServiceFQDN(env, index), strconv.Itoa(env.ClientPort))
 }
 
-func GetStatefulsetName(name string) string {
-	return fmt.Sprintf("valkey-%s", name)
+func GetHeadlessServiceFQDN(env Env) string {
+	return fmt.Sprintf("%s-headless.%s.svc.%s", GetStatefulsetName(env), env.Namespace, env.ClusterDomain)
 }
 
-func GetStatefulsetPodName(name string, index int) string {
-	return fmt.Sprintf("valkey-%s-%d", name, index)
+func GetStatefulsetName(env Env) string {
+	return fmt.Sprintf("%s-%s", env.NamePrefix, env.ClusterName)
 }
 
-// hostnames & ips include port
-func GetAllServicePods(serviceFQDN string) (ips []string, hostnames []string, err error) {
-	ips, err = net.LookupHost(serviceFQDN)
+func GetStatefulsetPodName(env Env, index int) string {
+	return fmt.Sprintf("%s-%d", GetStatefulsetName(env), index)
+}
+
+func NewKubernetesClient() (*kubernetes.Clientset, error) {
+	config, err := rest.InClusterConfig()
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
 	}
 
-	_, addrs, err := net.LookupSRV("", "", serviceFQDN)
+	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
-	hostnames = make([]string, 0, len(addrs))
-	for _, addr := range addrs {
-		hostnames = append(hostnames, fmt.Sprintf("%s:%d", addr.Target, int(addr.Port)))
+	return clientset, nil
+}
+
+// used for custom resources (ValkeyCluster) which don't have a typed clientset
+func NewDynamicClient() (dynamic.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes dynamic client: %w", err)
 	}
 
-	return ips, hostnames, nil
+	return client, nil
+}
+
+func GetStatefulSetReplicas(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (int, error) {
+	sts, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get statefulset: %w", err)
+	}
+	if sts.Spec.Replicas == nil {
+		return 1, nil // kubernetes defaults to 1 replica when unset
+	}
+	return int(*sts.Spec.Replicas), nil
+}
+
+func ScaleStatefulSet(ctx context.Context, clientset kubernetes.Interface, namespace, name string, replicas int) error {
+	if replicas < 0 || replicas > math.MaxInt32 {
+		return fmt.Errorf("replicas %d out of int32 range", replicas)
+	}
+
+	scale, err := clientset.AppsV1().StatefulSets(namespace).GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get statefulset scale: %w", err)
+	}
+	if scale.Spec.Replicas == int32(replicas) {
+		return nil
+	}
+
+	logging.FromContext(ctx).Info("Scaling StatefulSet", "statefulset", name, "from", scale.Spec.Replicas, "to", replicas)
+	scale.Spec.Replicas = int32(replicas)
+	if _, err := clientset.AppsV1().StatefulSets(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to scale statefulset: %w", err)
+	}
+
+	return nil
+}
+
+// sends a notification on changes whenever the statefulset is modified (including its status). the
+// watch is re-established if the api server closes it. notifications are coalesced so a slow consumer
+// only ever sees one pending notification.
+func WatchStatefulSet(ctx context.Context, clientset kubernetes.Interface, namespace, name string, changes chan<- struct{}) {
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	watchUntilDone(ctx, "statefulset", changes, func(ctx context.Context) (watch.Interface, error) {
+		return clientset.AppsV1().StatefulSets(namespace).Watch(ctx, metav1.ListOptions{FieldSelector: fieldSelector})
+	})
+}
+
+func watchUntilDone(ctx context.Context, kind string, changes chan<- struct{}, startWatch func(context.Context) (watch.Interface, error)) {
+	for {
+		watcher, err := startWatch(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Watch failed, retrying", "kind", kind, "error", err)
+		} else {
+			for range watcher.ResultChan() {
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+			watcher.Stop()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
 }
 
 func WaitForStatefulSetReady(ctx context.Context, namespace, name string, expectedReplicas int) error {
-	fmt.Println("Waiting for StatefulSet to be fully ready...")
+	logger := logging.FromContext(ctx).With("statefulset", name)
+	logger.Info("Waiting for StatefulSet to be fully ready", "replicas", expectedReplicas)
+	startTime := time.Now()
 
 	if expectedReplicas < 0 || expectedReplicas > math.MaxInt32 {
 		return fmt.Errorf("expectedReplicas %d out of int32 range", expectedReplicas)
 	}
 	expected := int32(expectedReplicas)
 
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return fmt.Errorf("failed to get in-cluster config: %w", err)
-	}
-
-	clientset, err := kubernetes.NewForConfig(config)
+	clientset, err := NewKubernetesClient()
 	if err != nil {
-		return fmt.Errorf("failed to create kubernetes client: %w", err)
+		return err
 	}
 
 	for {
@@ -87,14 +169,16 @@ func WaitForStatefulSetReady(ctx context.Context, namespace, name string, expect
 		rolloutComplete := sts.Status.CurrentRevision == sts.Status.UpdateRevision
 
 		if ready && updated && rolloutComplete {
-			fmt.Println("✓ StatefulSet is fully ready and updated")
+			logger.Info("StatefulSet is fully ready and updated", "duration", time.Since(startTime))
 			return nil
 		}
 
-		fmt.Printf("Waiting for StatefulSet... (ready: %d/%d, updated: %d/%d, rollout complete: %v)\n",
-			sts.Status.ReadyReplicas, expectedReplicas,
-			sts.Status.UpdatedReplicas, expectedReplicas,
-			rolloutComplete)
+		logger.Debug("Waiting for StatefulSet",
+			"ready", sts.Status.ReadyReplicas,
+			"updated", sts.Status.UpdatedReplicas,
+			"replicas", expectedReplicas,
+			"rollout_complete", rolloutComplete,
+		)
 
 		time.Sleep(2 * time.Second)
 	}
@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"valkey/reconciler/internal/logging"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	lockLeaseDuration = 30 * time.Second
+	lockRenewInterval = lockLeaseDuration / 3
+)
+
+var ErrLockLost = errors.New("lost the reconciler lock")
+
+// LockHeldError is returned when another reconciler is already working on the cluster
+type LockHeldError struct {
+	Namespace   string
+	ClusterName string
+	Lease       string
+	Holder      string
+	RenewTime   time.Time
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf(
+		"cluster %s/%s is locked by %s (last renewed %s ago). wait for it to finish or delete the %s lease if it is stuck",
+		e.Namespace,
+		e.ClusterName,
+		e.Holder,
+		time.Since(e.RenewTime).Round(time.Second),
+		e.Lease,
+	)
+}
+
+func GetLockLeaseName(env Env) string {
+	return fmt.Sprintf("%s-%s-reconciler-lock", env.NamePrefix, env.ClusterName)
+}
+
+// Lock is a coordination.k8s.io lease held by this process. it is renewed in the background until
+// Release is called. the context returned by Context is cancelled if the lease is lost so a long
+// operation stops instead of racing whoever took over.
+type Lock struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+	identity  string
+
+	ctx         context.Context
+	cancel      context.CancelCauseFunc
+	stopRenew   chan struct{}
+	renewDone   chan struct{}
+	releaseOnce sync.Once
+}
+
+// AcquireLock takes the lock for the cluster or returns a *LockHeldError naming the current holder.
+// expired leases (holder crashed) are taken over.
+func AcquireLock(ctx context.Context, clientset kubernetes.Interface, env Env) (*Lock, error) {
+	identity, err := lockIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := env.Namespace
+	leases := clientset.CoordinationV1().Leases(namespace)
+	leaseName := GetLockLeaseName(env)
+	now := metav1.NewMicroTime(time.Now())
+	leaseDurationSeconds := int32(lockLeaseDuration.Seconds())
+
+	lease, err := leases.Get(ctx, leaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      leaseName,
+				Namespace: namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "valkey-reconciler"},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: &leaseDurationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if _, err := leases.Create(ctx, lease, metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+			return nil, lockHeld(ctx, clientset, env)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to create lock lease: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get lock lease: %w", err)
+	} else {
+		if holder := leaseHolder(lease); holder != "" && !leaseExpired(lease) {
+			return nil, &LockHeldError{Namespace: namespace, ClusterName: env.ClusterName, Lease: leaseName, Holder: holder, RenewTime: lease.Spec.RenewTime.Time}
+		}
+
+		lease.Spec.HolderIdentity = &identity
+		lease.Spec.LeaseDurationSeconds = &leaseDurationSeconds
+		lease.Spec.AcquireTime = &now
+		lease.Spec.RenewTime = &now
+		// the resource version makes this fail if someone else took the lease since the get
+		if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); apierrors.IsConflict(err) {
+			return nil, lockHeld(ctx, clientset, env)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to take lock lease: %w", err)
+		}
+	}
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	lock := &Lock{
+		clientset: clientset,
+		namespace: namespace,
+		name:      leaseName,
+		identity:  identity,
+		ctx:       lockCtx,
+		cancel:    cancel,
+		stopRenew: make(chan struct{}),
+		renewDone: make(chan struct{}),
+	}
+	go lock.renew()
+
+	logging.FromContext(ctx).Info("Acquired lock", "lease", leaseName, "identity", identity)
+	return lock, nil
+}
+
+func (l *Lock) Context() context.Context {
+	return l.ctx
+}
+
+// Release stops renewing and clears the holder so the next reconciler doesn't have to wait for the lease
+// to expire. safe to call more than once.
+func (l *Lock) Release(ctx context.Context) {
+	l.releaseOnce.Do(func() {
+		close(l.stopRenew)
+		<-l.renewDone
+		defer l.cancel(nil)
+
+		leases := l.clientset.CoordinationV1().Leases(l.namespace)
+		lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+		if err != nil {
+			logging.FromContext(ctx).Warn("Failed to release lock", "lease", l.name, "error", err)
+			return
+		}
+		if leaseHolder(lease) != l.identity {
+			return
+		}
+
+		lease.Spec.HolderIdentity = nil
+		lease.Spec.AcquireTime = nil
+		lease.Spec.RenewTime = nil
+		if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+			logging.FromContext(ctx).Warn("Failed to release lock", "lease", l.name, "error", err)
+			return
+		}
+		logging.FromContext(ctx).Info("Released lock", "lease", l.name)
+	})
+}
+
+func (l *Lock) renew() {
+	defer close(l.renewDone)
+
+	lastRenew := time.Now()
+	ticker := time.NewTicker(lockRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stopRenew:
+			return
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := l.renewOnce()
+		if err == nil {
+			lastRenew = time.Now()
+			continue
+		}
+		if errors.Is(err, ErrLockLost) || time.Since(lastRenew) > lockLeaseDuration {
+			logging.FromContext(l.ctx).Error("Lost lock", "lease", l.name, "error", err)
+			l.cancel(ErrLockLost)
+			return
+		}
+		logging.FromContext(l.ctx).Warn("Failed to renew lock, retrying", "lease", l.name, "error", err)
+	}
+}
+
+func (l *Lock) renewOnce() error {
+	leases := l.clientset.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(l.ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if holder := leaseHolder(lease); holder != l.identity {
+		return fmt.Errorf("%w: lease is now held by %q", ErrLockLost, holder)
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(l.ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+func lockHeld(ctx context.Context, clientset kubernetes.Interface, env Env) error {
+	lease, err := clientset.CoordinationV1().Leases(env.Namespace).Get(ctx, GetLockLeaseName(env), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("lock was taken by someone else while acquiring it: %w", err)
+	}
+	heldErr := &LockHeldError{Namespace: env.Namespace, ClusterName: env.ClusterName, Lease: lease.Name, Holder: leaseHolder(lease)}
+	if lease.Spec.RenewTime != nil {
+		heldErr.RenewTime = lease.Spec.RenewTime.Time
+	}
+	return heldErr
+}
+
+func leaseHolder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func leaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
+
+// pod name plus a random suffix so two processes in the same pod (ie. kubectl exec into the controller)
+// don't think they hold each other's lock
+func lockIdentity() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get hostname for lock identity: %w", err)
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate lock identity: %w", err)
+	}
+	return fmt.Sprintf("%s_%s", hostname, hex.EncodeToString(suffix)), nil
+}
+
+// WithLock runs fn while holding the cluster lock. fn gets a context that is cancelled if the lock is
+// lost and the lock is released afterwards even if ctx was cancelled (ie. SIGTERM).
+func WithLock(ctx context.Context, clientset kubernetes.Interface, env Env, fn func(ctx context.Context) error) error {
+	lock, err := AcquireLock(ctx, clientset, env)
+	if err != nil {
+		return err
+	}
+
+	err = fn(lock.Context())
+	if cause := context.Cause(lock.Context()); err != nil && errors.Is(cause, ErrLockLost) {
+		err = fmt.Errorf("%w: %w", cause, err)
+	}
+
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	lock.Release(releaseCtx)
+	return err
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAcquireLock(t *testing.T) {
+	ctx := context.Background()
+	env := Env{ClusterName: "test", Namespace: "default", NamePrefix: "valkey"}
+
+	t.Run("second acquire names the holder", func(t *testing.T) {
+		clientset := fake.NewClientset()
+
+		lock, err := AcquireLock(ctx, clientset, env)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer lock.Release(ctx)
+
+		_, err = AcquireLock(ctx, clientset, env)
+		var heldErr *LockHeldError
+		if !errors.As(err, &heldErr) {
+			t.Fatalf("expected *LockHeldError, got %v", err)
+		}
+		if heldErr.Holder != lock.identity {
+			t.Errorf("expected holder %s, got %s", lock.identity, heldErr.Holder)
+		}
+		if !strings.Contains(err.Error(), lock.identity) {
+			t.Errorf("expected error to name the holder, got %s", err.Error())
+		}
+	})
+
+	t.Run("release lets the next reconciler in", func(t *testing.T) {
+		clientset := fake.NewClientset()
+
+		lock, err := AcquireLock(ctx, clientset, env)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lock.Release(ctx)
+		if lock.Context().Err() == nil {
+			t.Errorf("expected the lock context to be cancelled after release")
+		}
+
+		next, err := AcquireLock(ctx, clientset, env)
+		if err != nil {
+			t.Fatalf("expected the released lock to be free, got %v", err)
+		}
+		next.Release(ctx)
+	})
+
+	t.Run("expired lease is taken over", func(t *testing.T) {
+		holder := "crashed-pod_00000000"
+		duration := int32(lockLeaseDuration.Seconds())
+		renewTime := metav1.NewMicroTime(time.Now().Add(-2 * lockLeaseDuration))
+		clientset := fake.NewClientset(&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: GetLockLeaseName(env), Namespace: "default"},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &duration,
+				RenewTime:            &renewTime,
+			},
+		})
+
+		lock, err := AcquireLock(ctx, clientset, env)
+		if err != nil {
+			t.Fatalf("expected the expired lease to be taken over, got %v", err)
+		}
+		lock.Release(ctx)
+	})
+
+	t.Run("lease follows the name prefix", func(t *testing.T) {
+		clientset := fake.NewClientset()
+
+		prefixed := Env{ClusterName: "test", Namespace: "default", NamePrefix: "cache"}
+		lock, err := AcquireLock(ctx, clientset, prefixed)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer lock.Release(ctx)
+
+		if _, err := clientset.CoordinationV1().Leases("default").Get(ctx, "cache-test-reconciler-lock", metav1.GetOptions{}); err != nil {
+			t.Errorf("expected the lease to be named after the prefix: %v", err)
+		}
+		// another prefix is another cluster
+		other, err := AcquireLock(ctx, clientset, env)
+		if err != nil {
+			t.Fatalf("expected the other prefix to have its own lock, got %v", err)
+		}
+		other.Release(ctx)
+	})
+
+	t.Run("locks are per cluster", func(t *testing.T) {
+		clientset := fake.NewClientset()
+
+		first, err := AcquireLock(ctx, clientset, Env{ClusterName: "first", Namespace: "default", NamePrefix: "valkey"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer first.Release(ctx)
+
+		second, err := AcquireLock(ctx, clientset, Env{ClusterName: "second", Namespace: "default", NamePrefix: "valkey"})
+		if err != nil {
+			t.Fatalf("expected a different cluster to have its own lock, got %v", err)
+		}
+		second.Release(ctx)
+	})
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const ZoneLabel = "topology.kubernetes.io/zone"
+
+// Placement is the failure domains a pod runs in. empty fields are unknown (ie. the pod isn't scheduled
+// yet or its node has no zone label)
+type Placement struct {
+	Node string
+	Zone string
+}
+
+// GetPodPlacements reads the zone of the kubernetes node every discovered pod runs on keyed by pod index.
+// pods discovery doesn't know the node of (ie. dns discovery) are left out
+func GetPodPlacements(ctx context.Context, clientset kubernetes.Interface, pods []Pod) (map[int]Placement, error) {
+	zones := map[string]string{} // node name -> zone
+	placements := make(map[int]Placement, len(pods))
+	for _, pod := range pods {
+		nodeName := pod.NodeName
+		if nodeName == "" {
+			continue
+		}
+
+		zone, known := zones[nodeName]
+		if !known {
+			node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+			}
+			zone = node.Labels[ZoneLabel]
+			zones[nodeName] = zone
+		}
+		placements[pod.Index] = Placement{Node: nodeName, Zone: zone}
+	}
+	return placements, nil
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetPodPlacements(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n1", Labels: map[string]string{ZoneLabel: "a"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n2"}},
+	)
+	pods := []Pod{
+		{Index: 0, NodeName: "n1"},
+		{Index: 1, NodeName: "n2"},
+		{Index: 2, NodeName: "n1"},
+		{Index: 3}, // dns discovery doesn't know the node
+	}
+
+	placements, err := GetPodPlacements(context.Background(), clientset, pods)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[int]Placement{0: {Node: "n1", Zone: "a"}, 1: {Node: "n2"}, 2: {Node: "n1", Zone: "a"}}
+	if !reflect.DeepEqual(placements, want) {
+		t.Errorf("GetPodPlacements() = %v, want %v", placements, want)
+	}
+
+	if _, err := GetPodPlacements(context.Background(), clientset, []Pod{{Index: 0, NodeName: "missing"}}); err == nil {
+		t.Errorf("expected an error for a node that can't be read")
+	}
+}
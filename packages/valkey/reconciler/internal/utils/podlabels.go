@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	RoleLabel        = "valkey.io/role"  // master or replica
+	ShardLabel       = "valkey.io/shard" // position of the shard ordered by its lowest pod index
+	NodeIDAnnotation = "valkey.io/node-id"
+
+	RoleMaster  = "master"
+	RoleReplica = "replica"
+)
+
+// PodRole is what a pod is in the cluster, written to its labels and annotations
+type PodRole struct {
+	Role   string // RoleMaster or RoleReplica
+	Shard  int
+	NodeID string
+}
+
+// SyncPodRoles labels the pods of the statefulset with their role and shard and annotates them with
+// their node id. roles is keyed by pod index. pods that aren't in roles (ie. not part of the cluster
+// yet) have the labels removed so they drop out of role selectors. returns how many pods were patched
+func SyncPodRoles(ctx context.Context, clientset kubernetes.Interface, env Env, roles map[int]PodRole) (patched int, err error) {
+	pods, err := listStatefulSetPods(ctx, clientset, env)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, pod := range pods {
+		index, ok := podIndex(env, pod.Name)
+		if !ok {
+			continue
+		}
+		role, inCluster := roles[index]
+		patch, changed := podRolePatch(pod, role, inCluster)
+		if !changed {
+			continue
+		}
+
+		data, err := json.Marshal(patch)
+		if err != nil {
+			return patched, err
+		}
+		_, err = clientset.CoreV1().Pods(env.Namespace).Patch(ctx, pod.Name, types.MergePatchType, data, metav1.PatchOptions{})
+		if err != nil {
+			return patched, fmt.Errorf("failed to label pod %s: %w", pod.Name, err)
+		}
+		patched++
+	}
+	return patched, nil
+}
+
+// a merge patch that only touches the role labels and annotation. nil values remove them
+func podRolePatch(pod corev1.Pod, role PodRole, inCluster bool) (map[string]any, bool) {
+	labels := map[string]*string{RoleLabel: nil, ShardLabel: nil}
+	annotations := map[string]*string{NodeIDAnnotation: nil}
+	if inCluster {
+		shard := strconv.Itoa(role.Shard)
+		labels[RoleLabel], labels[ShardLabel] = &role.Role, &shard
+		annotations[NodeIDAnnotation] = &role.NodeID
+	}
+
+	changed := false
+	for key, want := range labels {
+		changed = changed || !metadataMatches(pod.Labels, key, want)
+	}
+	for key, want := range annotations {
+		changed = changed || !metadataMatches(pod.Annotations, key, want)
+	}
+	return map[string]any{"metadata": map[string]any{"labels": labels, "annotations": annotations}}, changed
+}
+
+func metadataMatches(metadata map[string]string, key string, want *string) bool {
+	value, exists := metadata[key]
+	if want == nil {
+		return !exists
+	}
+	return exists && value == *want
+}
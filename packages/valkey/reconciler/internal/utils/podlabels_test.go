@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSyncPodRoles(t *testing.T) {
+	ctx := context.Background()
+	env := Env{ClusterName: "test", Namespace: "default", NamePrefix: "valkey"}
+
+	master := discoveryPod("valkey-test-0", "10.0.0.1", "n1", true)
+	replica := discoveryPod("valkey-test-1", "10.0.0.2", "n2", true)
+	// left over from when it was part of the cluster
+	spare := discoveryPod("valkey-test-2", "10.0.0.3", "n3", true)
+	spare.Labels[RoleLabel], spare.Labels[ShardLabel] = RoleReplica, "0"
+	spare.Annotations = map[string]string{NodeIDAnnotation: "node2", "keep": "me"}
+	clientset := fake.NewClientset(master, replica, spare)
+
+	roles := map[int]PodRole{
+		0: {Role: RoleMaster, Shard: 0, NodeID: "node0"},
+		1: {Role: RoleReplica, Shard: 0, NodeID: "node1"},
+	}
+	patched, err := SyncPodRoles(ctx, clientset, env, roles)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if patched != 3 {
+		t.Errorf("patched %d pods, want 3", patched)
+	}
+
+	tests := []struct {
+		pod       string
+		wantRole  string
+		wantShard string
+		wantNode  string
+	}{
+		{pod: "valkey-test-0", wantRole: RoleMaster, wantShard: "0", wantNode: "node0"},
+		{pod: "valkey-test-1", wantRole: RoleReplica, wantShard: "0", wantNode: "node1"},
+		{pod: "valkey-test-2"},
+	}
+	for _, test := range tests {
+		pod, err := clientset.CoreV1().Pods("default").Get(ctx, test.pod, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pod.Labels[RoleLabel] != test.wantRole || pod.Labels[ShardLabel] != test.wantShard || pod.Annotations[NodeIDAnnotation] != test.wantNode {
+			t.Errorf("%s has labels %v and annotations %v", test.pod, pod.Labels, pod.Annotations)
+		}
+		if pod.Labels["app"] != "valkey-test" {
+			t.Errorf("%s lost its app label", test.pod)
+		}
+	}
+	if pod, _ := clientset.CoreV1().Pods("default").Get(ctx, "valkey-test-2", metav1.GetOptions{}); pod.Annotations["keep"] != "me" {
+		t.Errorf("unrelated annotations were touched: %v", pod.Annotations)
+	}
+
+	patched, err = SyncPodRoles(ctx, clientset, env, roles)
+	if err != nil || patched != 0 {
+		t.Errorf("second sync patched %d pods (%v), want 0", patched, err)
+	}
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLS points at the mounted certificates (ie. a cert-manager secret) the nodes are reached with. the
+// files are read again for every connection so certificates renewed in place are picked up without a
+// restart
+type TLS struct {
+	CACertFile string // verifies the nodes' certificates. the system pool when empty
+	CertFile   string // client certificate for nodes with tls-auth-clients. optional
+	KeyFile    string
+	ServerName string // name checked against the nodes' certificates instead of the address. optional
+}
+
+// Config builds the client tls config from the files
+func (t *TLS) Config() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: t.ServerName}
+
+	if t.CACertFile != "" {
+		caCert, err := os.ReadFile(t.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CACertFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func loadTLS() (*TLS, error) {
+	enabled := os.Getenv("TLS_ENABLED")
+	if enabled == "" || enabled == "false" {
+		return nil, nil
+	}
+	if enabled != "true" {
+		return nil, fmt.Errorf("TLS_ENABLED environment variable must be true or false")
+	}
+
+	t := &TLS{
+		CACertFile: os.Getenv("TLS_CA_CERT_FILE"),
+		CertFile:   os.Getenv("TLS_CERT_FILE"),
+		KeyFile:    os.Getenv("TLS_KEY_FILE"),
+		ServerName: os.Getenv("TLS_SERVER_NAME"),
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE environment variables must be set together")
+	}
+	// fail on startup instead of on the first connection
+	if _, err := t.Config(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"valkey/reconciler/internal/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// the ValkeyCluster resource has the same name as the cluster (CLUSTER_NAME)
+func GetValkeyCluster(ctx context.Context, client dynamic.Interface, namespace, name string) (*v1alpha1.ValkeyCluster, error) {
+	object, err := client.Resource(v1alpha1.GroupVersionResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var cluster v1alpha1.ValkeyCluster
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.UnstructuredContent(), &cluster); err != nil {
+		return nil, fmt.Errorf("failed to decode valkeycluster %s: %w", name, err)
+	}
+	return &cluster, nil
+}
+
+// only the status subresource is written. the spec is owned by whoever applied the resource (helm)
+func UpdateValkeyClusterStatus(ctx context.Context, client dynamic.Interface, cluster *v1alpha1.ValkeyCluster) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cluster)
+	if err != nil {
+		return fmt.Errorf("failed to encode valkeycluster %s: %w", cluster.Name, err)
+	}
+
+	object := &unstructured.Unstructured{Object: content}
+	object.SetAPIVersion(v1alpha1.SchemeGroupVersion.String())
+	object.SetKind(v1alpha1.Kind)
+
+	_, err = client.Resource(v1alpha1.GroupVersionResource).Namespace(cluster.Namespace).UpdateStatus(ctx, object, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update valkeycluster %s status: %w", cluster.Name, err)
+	}
+	return nil
+}
+
+// overrides the desired masters/replicas in env with the spec of the ValkeyCluster resource
+func ApplyValkeyClusterSpec(ctx context.Context, client dynamic.Interface, env Env) (Env, error) {
+	cluster, err := GetValkeyCluster(ctx, client, env.Namespace, env.ClusterName)
+	if err != nil {
+		return Env{}, fmt.Errorf("failed to get valkeycluster %s: %w", env.ClusterName, err)
+	}
+	if cluster.Spec.Masters < 1 {
+		return Env{}, fmt.Errorf("valkeycluster %s must have at least 1 master", env.ClusterName)
+	}
+	if cluster.Spec.ReplicasPerMaster < 0 {
+		return Env{}, fmt.Errorf("valkeycluster %s replicasPerMaster must be greater than or equal to 0", env.ClusterName)
+	}
+
+	env.Masters = cluster.Spec.Masters
+	env.ReplicasPerMaster = cluster.Spec.ReplicasPerMaster
+	return env, nil
+}
+
+// same as WatchStatefulSet but for the ValkeyCluster resource so spec edits are picked up immediately
+func WatchValkeyCluster(ctx context.Context, client dynamic.Interface, namespace, name string, changes chan<- struct{}) {
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	watchUntilDone(ctx, "valkeycluster", changes, func(ctx context.Context) (watch.Interface, error) {
+		return client.Resource(v1alpha1.GroupVersionResource).Namespace(namespace).Watch(ctx, metav1.ListOptions{FieldSelector: fieldSelector})
+	})
+}
@@ -0,0 +1,101 @@
+package valkey
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	valkeygo "github.com/valkey-io/valkey-go"
+)
+
+// RequiredCommands is every command the reconciler (and the valkey-cli calls it makes) runs against the
+// nodes, with placeholder arguments so ACL DRYRUN checks subcommand and key permissions too
+var RequiredCommands = [][]string{
+	{"CLUSTER", "INFO"},
+	{"CLUSTER", "NODES"},
+	{"CLUSTER", "SHARDS"},
+	{"CLUSTER", "MYID"},
+	{"CLUSTER", "MEET", "127.0.0.1", "6379"},
+	{"CLUSTER", "ADDSLOTSRANGE", "0", "0"},
+	{"CLUSTER", "SETSLOT", "0", "STABLE"},
+	{"CLUSTER", "REPLICATE", "0000000000000000000000000000000000000000"},
+	{"CLUSTER", "FAILOVER"},
+	{"CLUSTER", "FORGET", "0000000000000000000000000000000000000000"},
+	{"CLUSTER", "BUMPEPOCH"},
+	{"CLUSTER", "SET-CONFIG-EPOCH", "1"},
+	{"CLUSTER", "GETKEYSINSLOT", "0", "1"},
+	{"CLUSTER", "RESET", "SOFT"},
+	{"INFO"},
+	{"PING"},
+	{"CONFIG", "GET", "cluster-node-timeout"},
+	{"MIGRATE", "127.0.0.1", "6379", "", "0", "1000", "KEYS", "key"},
+	// MIGRATE runs these on the target node as the same user
+	{"SELECT", "0"},
+	{"RESTORE-ASKING", "key", "0", "payload"},
+}
+
+// PermissionError lists what the reconciler's acl user is not allowed to do
+type PermissionError struct {
+	Username string
+	Missing  []string // the reasons ACL DRYRUN gave
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("acl user %s is missing permissions: %s", e.Username, strings.Join(e.Missing, "; "))
+}
+
+// CheckPermissions asks the node with ACL DRYRUN whether username can run every one of RequiredCommands.
+// a *PermissionError lists the ones it can't
+func CheckPermissions(ctx context.Context, client valkeygo.Client, username string) error {
+	return checkPermissions(username, RequiredCommands, func(command []string) (string, error) {
+		cmd := client.B().AclDryrun().Username(username).Command(command[0]).Arg(command[1:]...).Build()
+		return client.Do(ctx, cmd).ToString()
+	})
+}
+
+func checkPermissions(username string, commands [][]string, dryRun func(command []string) (string, error)) error {
+	var missing []string
+	for _, command := range commands {
+		reply, err := dryRun(command)
+		if err != nil {
+			if strings.Contains(err.Error(), "NOPERM") {
+				return fmt.Errorf("acl user %s can't check its own permissions. it needs +acl|dryrun: %w", username, err)
+			}
+			return fmt.Errorf("acl dryrun %s: %w", strings.Join(command, " "), err)
+		}
+		if reply != "OK" {
+			missing = append(missing, reply)
+		}
+	}
+	if len(missing) > 0 {
+		return &PermissionError{Username: username, Missing: missing}
+	}
+	return nil
+}
+
+// AddPassword lets username also authenticate with password. its other passwords keep working
+func AddPassword(ctx context.Context, client valkeygo.Client, username, password string) error {
+	cmd := client.B().AclSetuser().Username(username).Rule(">" + password).Build()
+	if err := client.Do(ctx, cmd).Error(); err != nil {
+		return fmt.Errorf("add password to acl user %s: %w", username, err)
+	}
+	return nil
+}
+
+// SetPassword makes password the only one username can authenticate with. connections that already
+// authenticated with another password stay open
+func SetPassword(ctx context.Context, client valkeygo.Client, username, password string) error {
+	cmd := client.B().AclSetuser().Username(username).Rule("resetpass", ">"+password).Build()
+	if err := client.Do(ctx, cmd).Error(); err != nil {
+		return fmt.Errorf("set password of acl user %s: %w", username, err)
+	}
+	return nil
+}
+
+// SaveACL writes the node's users to its aclfile so they survive a restart of the server
+func SaveACL(ctx context.Context, client valkeygo.Client) error {
+	if err := client.Do(ctx, client.B().AclSave().Build()).Error(); err != nil {
+		return fmt.Errorf("acl save: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package valkey
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	commands := [][]string{{"CLUSTER", "NODES"}, {"CLUSTER", "FORGET", "id"}, {"MIGRATE", "127.0.0.1", "6379", "", "0", "1000", "KEYS", "key"}}
+
+	tests := []struct {
+		name        string
+		replies     map[string]string
+		err         error
+		wantMissing []string
+		wantErr     string
+	}{
+		{
+			name: "every command allowed",
+		},
+		{
+			name: "missing subcommand and key permissions",
+			replies: map[string]string{
+				"CLUSTER FORGET": "User reconciler has no permissions to run the 'cluster|forget' command",
+				"MIGRATE":        "User reconciler has no permissions to access the 'key' key",
+			},
+			wantMissing: []string{
+				"User reconciler has no permissions to run the 'cluster|forget' command",
+				"User reconciler has no permissions to access the 'key' key",
+			},
+		},
+		{
+			name:    "can't run acl dryrun",
+			err:     errors.New("NOPERM User reconciler has no permissions to run the 'acl|dryrun' command"),
+			wantErr: "+acl|dryrun",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkPermissions("reconciler", commands, func(command []string) (string, error) {
+				if test.err != nil {
+					return "", test.err
+				}
+				for prefix, reply := range test.replies {
+					if strings.HasPrefix(strings.Join(command, " "), prefix) {
+						return reply, nil
+					}
+				}
+				return "OK", nil
+			})
+
+			var permissionErr *PermissionError
+			switch {
+			case test.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error mentioning %q, got %v", test.wantErr, err)
+				}
+			case test.wantMissing != nil:
+				if !errors.As(err, &permissionErr) {
+					t.Fatalf("expected a *PermissionError, got %v", err)
+				}
+				if !slices.Equal(permissionErr.Missing, test.wantMissing) {
+					t.Errorf("missing = %v, want %v", permissionErr.Missing, test.wantMissing)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package valkey
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"valkey/reconciler/internal/utils"
+)
+
+type ProblemType string
+
+const (
+	ProblemUnreachable    ProblemType = "unreachable"
+	ProblemUncoveredSlots ProblemType = "uncovered-slots"
+	ProblemSlotOwnedTwice ProblemType = "slot-owned-twice"
+	ProblemOpenSlot       ProblemType = "open-slot"
+	ProblemNodeTable      ProblemType = "node-table-mismatch"
+	ProblemDuplicateEpoch ProblemType = "duplicate-config-epoch"
+	ProblemStaleIP        ProblemType = "stale-ip"
+)
+
+type Problem struct {
+	Type    ProblemType `json:"type"`
+	Node    string      `json:"node,omitempty"`  // address of the pod the problem was found on
+	Slots   []string    `json:"slots,omitempty"` // ranges like 0-5460
+	Message string      `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Node == "" {
+		return fmt.Sprintf("%s: %s", p.Type, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Type, p.Node, p.Message)
+}
+
+// GetClusterNodeViews asks every address for its own CLUSTER NODES. addresses that couldn't be reached
+// are returned as problems instead of failing the whole lookup
+func GetClusterNodeViews(addresses []string, env utils.Env) (map[string][]ClusterNode, []Problem) {
+	views := make(map[string][]ClusterNode, len(addresses))
+	var problems []Problem
+	for _, address := range addresses {
+		nodes, err := clusterNodesOf(address, env)
+		if err != nil {
+			problems = append(problems, Problem{Type: ProblemUnreachable, Node: address, Message: err.Error()})
+			continue
+		}
+		views[address] = nodes
+	}
+	return views, problems
+}
+
+// CheckPodIPs compares the ip every view has for a pod's node with the ip discovery found the pod at. the
+// cluster bus connects by ip so a node that still has the old ip of a restarted pod can't reach it.
+// nodes already marked failed and pods without a known ip are skipped
+func CheckPodIPs(views map[string][]ClusterNode, pods []utils.Pod) []Problem {
+	podIPs := make(map[string]string, len(pods)) // hostname -> ip
+	for _, pod := range pods {
+		if hostname, _, err := net.SplitHostPort(pod.Address); err == nil && pod.IP != "" {
+			podIPs[hostname] = pod.IP
+		}
+	}
+
+	var problems []Problem
+	for _, address := range slices.Sorted(maps.Keys(views)) {
+		for _, node := range views[address] {
+			podIP, known := podIPs[node.Hostname]
+			if !known || node.IP == "" || node.IP == podIP || isStale(node) {
+				continue
+			}
+			problems = append(problems, Problem{
+				Type:    ProblemStaleIP,
+				Node:    address,
+				Message: fmt.Sprintf("has %s (%s) at %s but the pod is at %s", node.Hostname, node.ID, node.IP, podIP),
+			})
+		}
+	}
+	return problems
+}
+
+func clusterNodesOf(address string, env utils.Env) ([]ClusterNode, error) {
+	client, err := NewNodeClient(ReconcilerAuth(env), address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return ClusterNodes(client)
+}
+
+// CheckCluster is the equivalent of valkey-cli --cluster check across every node's own view of the
+// cluster (keyed by the address it was read from). slot ownership, open slots and config epochs come
+// from each node's myself entry; the rest of every view has to agree with the first one
+func CheckCluster(views map[string][]ClusterNode) []Problem {
+	var problems []Problem
+	addresses := slices.Sorted(maps.Keys(views))
+
+	owners := make([][]string, TotalSlots)
+	epochs := map[uint64][]string{}
+	for _, address := range addresses {
+		myself, exists := findMyself(views[address])
+		if !exists {
+			problems = append(problems, Problem{Type: ProblemNodeTable, Node: address, Message: "node table has no myself entry"})
+			continue
+		}
+
+		for _, importing := range myself.Importing {
+			problems = append(problems, Problem{
+				Type:    ProblemOpenSlot,
+				Node:    address,
+				Slots:   []string{SlotRange{StartSlot: importing.Slot, EndSlot: importing.Slot}.String()},
+				Message: fmt.Sprintf("slot %d is importing from %s", importing.Slot, importing.ImportingNodeID),
+			})
+		}
+		for _, migrating := range myself.Migrating {
+			problems = append(problems, Problem{
+				Type:    ProblemOpenSlot,
+				Node:    address,
+				Slots:   []string{SlotRange{StartSlot: migrating.Slot, EndSlot: migrating.Slot}.String()},
+				Message: fmt.Sprintf("slot %d is migrating to %s", migrating.Slot, migrating.MigratingNodeID),
+			})
+		}
+
+		if myself.Master != "" {
+			continue
+		}
+		epochs[myself.ConfigEp] = append(epochs[myself.ConfigEp], myself.ID)
+		for _, slotRange := range myself.Slots {
+			for slot := int(slotRange.StartSlot); slot <= int(slotRange.EndSlot); slot++ {
+				if !slices.Contains(owners[slot], myself.ID) {
+					owners[slot] = append(owners[slot], myself.ID)
+				}
+			}
+		}
+	}
+
+	// views can only be compared for coverage once at least one node answered
+	if len(views) > 0 {
+		var uncovered []uint16
+		overlaps := map[string][]uint16{} // owners joined by comma -> slots
+		for slot, slotOwners := range owners {
+			switch {
+			case len(slotOwners) == 0:
+				uncovered = append(uncovered, uint16(slot))
+			case len(slotOwners) > 1:
+				key := strings.Join(slices.Sorted(slices.Values(slotOwners)), ",")
+				overlaps[key] = append(overlaps[key], uint16(slot))
+			}
+		}
+		if len(uncovered) > 0 {
+			problems = append(problems, Problem{
+				Type:    ProblemUncoveredSlots,
+				Slots:   formatSlotRanges(uncovered),
+				Message: fmt.Sprintf("%d of %d slots are not owned by any master", len(uncovered), TotalSlots),
+			})
+		}
+		for _, key := range slices.Sorted(maps.Keys(overlaps)) {
+			problems = append(problems, Problem{
+				Type:    ProblemSlotOwnedTwice,
+				Slots:   formatSlotRanges(overlaps[key]),
+				Message: fmt.Sprintf("%d slots are owned by more than one master: %s", len(overlaps[key]), key),
+			})
+		}
+	}
+
+	for _, epoch := range slices.Sorted(maps.Keys(epochs)) {
+		if ids := epochs[epoch]; len(ids) > 1 {
+			problems = append(problems, Problem{
+				Type:    ProblemDuplicateEpoch,
+				Message: fmt.Sprintf("masters %s share config epoch %d", strings.Join(ids, ", "), epoch),
+			})
+		}
+	}
+
+	if len(addresses) > 1 {
+		reference := nodeTable(views[addresses[0]])
+		for _, address := range addresses[1:] {
+			if differences := diffNodeTables(reference, nodeTable(views[address])); len(differences) > 0 {
+				problems = append(problems, Problem{
+					Type:    ProblemNodeTable,
+					Node:    address,
+					Message: fmt.Sprintf("disagrees with %s about %s", addresses[0], strings.Join(differences, "; ")),
+				})
+			}
+		}
+	}
+
+	return problems
+}
+
+func findMyself(nodes []ClusterNode) (ClusterNode, bool) {
+	for _, node := range nodes {
+		if slices.Contains(node.Flags, Myself) {
+			return node, true
+		}
+	}
+	return ClusterNode{}, false
+}
+
+// node id -> what every node has to agree on: who it replicates and which slots it owns. flags and
+// link state are left out because they are each node's own opinion of the others
+func nodeTable(nodes []ClusterNode) map[string]string {
+	table := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		master := node.Master
+		if master == "" {
+			master = "-"
+		}
+		slotRanges := make([]string, 0, len(node.Slots))
+		for _, slotRange := range node.Slots {
+			slotRanges = append(slotRanges, slotRange.String())
+		}
+		table[node.ID] = fmt.Sprintf("master %s slots [%s]", master, strings.Join(slotRanges, " "))
+	}
+	return table
+}
+
+func diffNodeTables(reference, other map[string]string) []string {
+	var differences []string
+	for _, id := range slices.Sorted(maps.Keys(reference)) {
+		entry, exists := other[id]
+		switch {
+		case !exists:
+			differences = append(differences, fmt.Sprintf("%s is missing", id))
+		case entry != reference[id]:
+			differences = append(differences, fmt.Sprintf("%s is %s instead of %s", id, entry, reference[id]))
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(other)) {
+		if _, exists := reference[id]; !exists {
+			differences = append(differences, fmt.Sprintf("%s is unknown", id))
+		}
+	}
+	return differences
+}
+
+// slots have to be sorted
+func formatSlotRanges(slots []uint16) []string {
+	var ranges []string
+	for i := 0; i < len(slots); {
+		j := i
+		for j+1 < len(slots) && slots[j+1] == slots[j]+1 {
+			j++
+		}
+		ranges = append(ranges, SlotRange{StartSlot: slots[i], EndSlot: slots[j]}.String())
+		i = j + 1
+	}
+	return ranges
+}
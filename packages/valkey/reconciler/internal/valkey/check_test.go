@@ -0,0 +1,155 @@
+package valkey
+
+import (
+	"slices"
+	"testing"
+	"valkey/reconciler/internal/utils"
+)
+
+// three masters splitting the slots evenly plus a replica of the first one
+func checkNodes() []ClusterNode {
+	return []ClusterNode{
+		{ID: "m0", Flags: []Flag{Master}, ConfigEp: 1, Slots: []SlotRange{{StartSlot: 0, EndSlot: 5460}}},
+		{ID: "m1", Flags: []Flag{Master}, ConfigEp: 2, Slots: []SlotRange{{StartSlot: 5461, EndSlot: 10922}}},
+		{ID: "m2", Flags: []Flag{Master}, ConfigEp: 3, Slots: []SlotRange{{StartSlot: 10923, EndSlot: 16383}}},
+		{ID: "r0", Flags: []Flag{Slave}, ConfigEp: 1, Master: "m0"},
+	}
+}
+
+// every node's view of checkNodes with its own entry flagged myself. change is applied to each view
+func checkViews(change func(address string, nodes []ClusterNode)) map[string][]ClusterNode {
+	views := map[string][]ClusterNode{}
+	for i, address := range []string{"a0", "a1", "a2", "a3"} {
+		nodes := checkNodes()
+		nodes[i].Flags = append([]Flag{Myself}, nodes[i].Flags...)
+		if change != nil {
+			change(address, nodes)
+		}
+		views[address] = nodes
+	}
+	return views
+}
+
+func TestCheckCluster(t *testing.T) {
+	tests := []struct {
+		name      string
+		views     map[string][]ClusterNode
+		wantTypes []ProblemType
+		wantSlots []string // slots of the first problem
+	}{
+		{
+			name:  "consistent cluster",
+			views: checkViews(nil),
+		},
+		{
+			name: "uncovered slots",
+			views: checkViews(func(_ string, nodes []ClusterNode) {
+				nodes[2].Slots = []SlotRange{{StartSlot: 10923, EndSlot: 16382}}
+			}),
+			wantTypes: []ProblemType{ProblemUncoveredSlots},
+			wantSlots: []string{"16383"},
+		},
+		{
+			name: "slot owned twice",
+			views: checkViews(func(address string, nodes []ClusterNode) {
+				if address == "a1" {
+					nodes[1].Slots = []SlotRange{{StartSlot: 5000, EndSlot: 10922}}
+				}
+			}),
+			wantTypes: []ProblemType{ProblemSlotOwnedTwice, ProblemNodeTable},
+			wantSlots: []string{"5000-5460"},
+		},
+		{
+			name: "open slots",
+			views: checkViews(func(address string, nodes []ClusterNode) {
+				switch address {
+				case "a0":
+					nodes[0].Migrating = []MigratingSlot{{Slot: 42, MigratingNodeID: "m1"}}
+				case "a1":
+					nodes[1].Importing = []ImportingSlot{{Slot: 42, ImportingNodeID: "m0"}}
+				}
+			}),
+			wantTypes: []ProblemType{ProblemOpenSlot, ProblemOpenSlot},
+			wantSlots: []string{"42"},
+		},
+		{
+			name: "duplicate config epoch",
+			views: checkViews(func(_ string, nodes []ClusterNode) {
+				nodes[2].ConfigEp = 2
+			}),
+			wantTypes: []ProblemType{ProblemDuplicateEpoch},
+		},
+		{
+			name: "node missing from one view",
+			views: checkViews(func(address string, nodes []ClusterNode) {
+				if address == "a2" {
+					nodes[3].ID = "r9"
+				}
+			}),
+			wantTypes: []ProblemType{ProblemNodeTable},
+		},
+		{
+			name: "replica attached to a different master",
+			views: checkViews(func(address string, nodes []ClusterNode) {
+				if address == "a1" {
+					nodes[3].Master = "m1"
+				}
+			}),
+			wantTypes: []ProblemType{ProblemNodeTable},
+		},
+		{
+			name: "no myself entry",
+			views: map[string][]ClusterNode{
+				"a0": checkNodes(),
+			},
+			wantTypes: []ProblemType{ProblemNodeTable, ProblemUncoveredSlots},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := CheckCluster(test.views)
+
+			types := make([]ProblemType, 0, len(problems))
+			for _, problem := range problems {
+				types = append(types, problem.Type)
+			}
+			if !slices.Equal(types, test.wantTypes) {
+				t.Fatalf("problems = %v, want %v", problems, test.wantTypes)
+			}
+			if test.wantSlots != nil && !slices.Equal(problems[0].Slots, test.wantSlots) {
+				t.Errorf("slots = %v, want %v", problems[0].Slots, test.wantSlots)
+			}
+		})
+	}
+}
+
+func TestCheckPodIPs(t *testing.T) {
+	pods := []utils.Pod{
+		{Index: 0, Address: "pod-0.svc:6379", IP: "10.0.0.1"},
+		{Index: 1, Address: "pod-1.svc:6379", IP: "10.0.0.7"}, // restarted
+		{Index: 2, Address: "pod-2.svc:6379"},                 // dns discovery couldn't resolve it
+	}
+	nodes := []ClusterNode{
+		{ID: "m0", Hostname: "pod-0.svc", IP: "10.0.0.1"},
+		{ID: "m1", Hostname: "pod-1.svc", IP: "10.0.0.2"},
+		{ID: "m2", Hostname: "pod-2.svc", IP: "10.0.0.3"},
+		{ID: "gone", Hostname: "pod-1.svc", IP: "10.0.0.5", Flags: []Flag{Fail}},
+	}
+
+	problems := CheckPodIPs(map[string][]ClusterNode{"pod-0.svc:6379": nodes}, pods)
+	if len(problems) != 1 || problems[0].Type != ProblemStaleIP || problems[0].Node != "pod-0.svc:6379" {
+		t.Fatalf("CheckPodIPs() = %v, want one stale-ip problem for m1", problems)
+	}
+	if want := "has pod-1.svc (m1) at 10.0.0.2 but the pod is at 10.0.0.7"; problems[0].Message != want {
+		t.Errorf("message = %q, want %q", problems[0].Message, want)
+	}
+}
+
+func TestFormatSlotRanges(t *testing.T) {
+	got := formatSlotRanges([]uint16{0, 1, 2, 5, 7, 8, 16383})
+	want := []string{"0-2", "5", "7-8", "16383"}
+	if !slices.Equal(got, want) {
+		t.Errorf("formatSlotRanges() = %v, want %v", got, want)
+	}
+}
@@ -3,14 +3,14 @@ package valkey
 import (
 	"context"
 	"fmt"
-	"os"
+	"log/slog"
 	"os/exec"
-	"strconv"
 	"strings"
 	"time"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/metrics"
 	"valkey/reconciler/internal/utils"
-
-	valkeygo "github.com/valkey-io/valkey-go"
 )
 
 func doesCommandExist(cmd string) bool {
@@ -21,6 +21,31 @@ func doesCommandExist(cmd string) bool {
 type Auth struct {
 	Username string
 	Password string
+	TLS      *utils.TLS // nil for plain connections
+}
+
+// the valkey-cli flags that authenticate the same way clients do
+func (a Auth) cliArgs() []string {
+	var args []string
+	if a.Username != "" {
+		args = append(args, "--user", a.Username)
+	}
+	if a.Password != "" {
+		args = append(args, "-a", a.Password)
+	}
+	if a.TLS != nil {
+		args = append(args, "--tls")
+		if a.TLS.CACertFile != "" {
+			args = append(args, "--cacert", a.TLS.CACertFile)
+		}
+		if a.TLS.CertFile != "" {
+			args = append(args, "--cert", a.TLS.CertFile, "--key", a.TLS.KeyFile)
+		}
+		if a.TLS.ServerName != "" {
+			args = append(args, "--sni", a.TLS.ServerName)
+		}
+	}
+	return args
 }
 
 type Connection struct {
@@ -54,84 +79,6 @@ func (o CliBaseOptions) Address() string {
 	return fmt.Sprintf("%s:%d", o.Hostname, o.Port)
 }
 
-type RebalanceOptions struct {
-	CliBaseOptions
-
-	// Rebalance behavior
-	Threshold       *float64           // Percent deviation from ideal number of slots; default: 2.0% WARNING: never use 0 or else it will skip the rebalance
-	UseEmptyMasters bool               // Allow empty masters to take on slots; default: false
-	Weights         map[string]float64 // nodeID -> weight; Ratio of slots to assign to each node (0 drains all slots from master); default 1 per node
-
-	// Execution behavior
-	TimeoutMS *int // default 60000 (1 minute)
-	Pipeline  *int // Keys per MIGRATE call; default 10
-	Replace   bool // Overwrite keys on collision; default false
-}
-
-func Rebalance(options RebalanceOptions) error {
-	if !doesCommandExist("valkey-cli") {
-		return fmt.Errorf("valkey-cli is not installed")
-	}
-	if err := options.ValidateConnection(); err != nil {
-		return err
-	}
-	if err := options.ValidateAuth(); err != nil {
-		return err
-	}
-
-	args := []string{"--cluster", "rebalance", options.Address(), "--cluster-yes"}
-
-	if options.Username != "" {
-		args = append(args, "--user", options.Username)
-	}
-
-	if options.Threshold != nil {
-		if *options.Threshold < 0 {
-			return fmt.Errorf("threshold must be >= 0")
-		}
-		args = append(args, "--cluster-threshold", strconv.FormatFloat(*options.Threshold, 'f', -1, 64))
-	}
-	if options.UseEmptyMasters {
-		args = append(args, "--cluster-use-empty-masters")
-	}
-	if len(options.Weights) > 0 {
-		weights := make([]string, len(options.Weights))
-		i := 0
-		for nodeID, weight := range options.Weights {
-			weights[i] = fmt.Sprintf("%s=%s", nodeID, strconv.FormatFloat(weight, 'f', -1, 64))
-			i++
-		}
-		args = append(args, "--cluster-weight")
-		args = append(args, weights...)
-	}
-
-	if options.TimeoutMS != nil {
-		if *options.TimeoutMS <= 0 {
-			return fmt.Errorf("timeout must be > 0")
-		}
-		args = append(args, "--cluster-timeout", strconv.Itoa(*options.TimeoutMS))
-	}
-	if options.Pipeline != nil {
-		if *options.Pipeline <= 0 {
-			return fmt.Errorf("pipeline must be > 0")
-		}
-		args = append(args, "--cluster-pipeline", strconv.Itoa(*options.Pipeline))
-	}
-	if options.Replace {
-		args = append(args, "--cluster-replace")
-	}
-
-	fmt.Printf("Command: valkey-cli %s\n", strings.Join(args, " "))
-	if options.Password != "" {
-		args = append(args, "-a", options.Password)
-	}
-
-	cmd := exec.Command("valkey-cli", args...) // #nosec G204 (cmd injection) -- args from validated structs, not user input
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
 // NOTE: doesn't support replicas because there is a race condition in the cli
 type AddNodeOptions struct {
 	CliBaseOptions
@@ -140,7 +87,7 @@ type AddNodeOptions struct {
 	NewPort     uint16
 }
 
-func AddNode(options AddNodeOptions) error {
+func AddNode(ctx context.Context, options AddNodeOptions) error {
 	if !doesCommandExist("valkey-cli") {
 		return fmt.Errorf("valkey-cli is not installed")
 	}
@@ -164,20 +111,16 @@ func AddNode(options AddNodeOptions) error {
 		fmt.Sprintf("%s:%d", options.Hostname, options.Port),
 		"--cluster-yes",
 	}
+	args = append(args, options.cliArgs()...)
 
-	if options.Username != "" {
-		args = append(args, "--user", options.Username)
-	}
-
-	fmt.Printf("Command: valkey-cli %s\n", strings.Join(args, " "))
-	if options.Password != "" {
-		args = append(args, "-a", options.Password)
+	logger := logging.FromContext(ctx).With("hostname", options.NewHostname)
+	if err := runValkeyCli(ctx, logger, args); err != nil {
+		return err
 	}
-
-	cmd := exec.Command("valkey-cli", args...) // #nosec G204 (cmd injection) -- args from validated structs, not user input
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	logger.Info("Added node")
+	events.Normal(ctx, events.ReasonNodeAdded, "Added node %s", options.NewHostname)
+	metrics.NodesAdded(1)
+	return nil
 }
 
 type DelNodeOptions struct {
@@ -186,7 +129,7 @@ type DelNodeOptions struct {
 	NodeID string
 }
 
-func DelNode(options DelNodeOptions) error {
+func DelNode(ctx context.Context, options DelNodeOptions) error {
 	if !doesCommandExist("valkey-cli") {
 		return fmt.Errorf("valkey-cli is not installed")
 	}
@@ -198,19 +141,52 @@ func DelNode(options DelNodeOptions) error {
 	}
 
 	args := []string{"--cluster", "del-node", options.Address(), options.NodeID, "--cluster-yes"}
+	args = append(args, options.cliArgs()...)
+
+	logger := logging.FromContext(ctx).With("node_id", options.NodeID)
+	if err := runValkeyCli(ctx, logger, args); err != nil {
+		return err
+	}
+	logger.Info("Removed node")
+	events.Normal(ctx, events.ReasonNodeRemoved, "Removed node %s", options.NodeID)
+	metrics.NodesRemoved(1)
+	return nil
+}
+
+// the output is logged line by line at debug level and included in the error when the command fails.
+// the command line is logged with the password redacted.
+func runValkeyCli(ctx context.Context, logger *slog.Logger, args []string) error {
+	logger.Info("Running valkey-cli", "args", strings.Join(logging.RedactArgs(args), " "))
 
-	if options.Username != "" {
-		args = append(args, "--user", options.Username)
+	cmd := exec.CommandContext(ctx, "valkey-cli", args...) // #nosec G204 (cmd injection) -- args from validated structs, not user input
+	output, err := cmd.CombinedOutput()
+	for line := range strings.Lines(string(output)) {
+		if line = strings.TrimSpace(line); line != "" {
+			logger.Debug("valkey-cli", "output", line)
+		}
 	}
-	fmt.Printf("Command: valkey-cli %s\n", strings.Join(args, " "))
-	if options.Password != "" {
-		args = append(args, "-a", options.Password)
+	if err != nil {
+		return fmt.Errorf("valkey-cli %s: %w: %s", args[1], err, strings.TrimSpace(lastLine(string(output))))
 	}
+	return nil
+}
+
+func lastLine(output string) string {
+	output = strings.TrimSpace(output)
+	if i := strings.LastIndex(output, "\n"); i != -1 {
+		return output[i+1:]
+	}
+	return output
+}
 
-	cmd := exec.Command("valkey-cli", args...) // #nosec G204 (cmd injection) -- args from validated structs, not user input
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+// DrainWeights are the rebalance weights that move every slot of the master onto the other masters
+func DrainWeights(topology Topology, masterID string) map[string]float64 {
+	weights := make(map[string]float64, len(topology.Masters))
+	for id := range topology.Masters {
+		weights[id] = 1.0
+	}
+	weights[masterID] = 0.0
+	return weights
 }
 
 type DelShardOptions struct {
@@ -219,7 +195,9 @@ type DelShardOptions struct {
 	Env      utils.Env
 }
 
-func DelShard(options DelShardOptions) (newClusterTopology Topology, err error) {
+// DelShard removes the shard's replicas, drains its slots and removes the master. it only works off the
+// given topology so running it again after an interruption picks up whatever is left of the shard.
+func DelShard(ctx context.Context, options DelShardOptions) (newClusterTopology Topology, err error) {
 	topology := options.Topology
 	shardMasterNode, exists := topology.Masters[options.Shard.MasterId]
 	if !exists {
@@ -227,7 +205,7 @@ func DelShard(options DelShardOptions) (newClusterTopology Topology, err error)
 	}
 
 	env := options.Env
-	clusterClientHostnames, err := GetClusterConnectionInfo(utils.GetHeadlessServiceFQDN(env.ClusterName, env.Namespace), env)
+	clusterClientHostnames, err := GetClusterConnectionInfo(ctx, env)
 	if err != nil {
 		return Topology{}, err
 	}
@@ -237,12 +215,9 @@ func DelShard(options DelShardOptions) (newClusterTopology Topology, err error)
 	cliBaseOptions := CliBaseOptions{
 		Connection: Connection{
 			Hostname: hostname,
-			Port:     uint16(6379),
-		},
-		Auth: Auth{
-			Username: AdminUser,
-			Password: env.AdminPassword,
+			Port:     uint16(env.ClientPort),
 		},
+		Auth: ReconcilerAuth(env),
 	}
 
 	removedNodes := make(map[string]struct{}, len(shardMasterNode.SlaveIds)+1) // +1 for the master
@@ -251,38 +226,28 @@ func DelShard(options DelShardOptions) (newClusterTopology Topology, err error)
 		if !exists {
 			return Topology{}, fmt.Errorf("slave %s not found in topology", slaveId)
 		}
-		if err := DelNode(DelNodeOptions{CliBaseOptions: cliBaseOptions, NodeID: slaveNode.ID}); err != nil {
+		if err := DelNode(ctx, DelNodeOptions{CliBaseOptions: cliBaseOptions, NodeID: slaveNode.ID}); err != nil {
 			return Topology{}, err
 		}
 		removedNodes[slaveNode.ID] = struct{}{}
 	}
 
-	weights := make(map[string]float64)
-	for _, masterNode := range topology.Masters {
-		if masterNode.Node.ID == shardMasterNode.Node.ID {
-			weights[masterNode.Node.ID] = 0.0
-			continue
-		}
-
-		weights[masterNode.Node.ID] = 1.0
-	}
-	if _, included := weights[shardMasterNode.Node.ID]; !included {
-		return Topology{}, fmt.Errorf("master %s not found in topology", shardMasterNode.Node.ID)
-	}
 	rebalanceOptions := RebalanceOptions{
 		CliBaseOptions:  cliBaseOptions,
 		UseEmptyMasters: true,
-		Weights:         weights,
+		Weights:         DrainWeights(topology, shardMasterNode.Node.ID),
 		Replace:         true,
 	}
-	if err := Rebalance(rebalanceOptions); err != nil {
+	if err := Rebalance(ctx, rebalanceOptions); err != nil {
 		return Topology{}, err
 	}
 
-	if err := DelNode(DelNodeOptions{CliBaseOptions: cliBaseOptions, NodeID: shardMasterNode.Node.ID}); err != nil {
+	if err := DelNode(ctx, DelNodeOptions{CliBaseOptions: cliBaseOptions, NodeID: shardMasterNode.Node.ID}); err != nil {
 		return Topology{}, err
 	}
 	removedNodes[shardMasterNode.Node.ID] = struct{}{}
+	events.Normal(ctx, events.ReasonShardRemoved, "Removed shard of master %s (%s) and its %d replicas",
+		shardMasterNode.Node.ID, shardMasterNode.Node.Hostname, len(shardMasterNode.SlaveIds))
 
 	leftOverNodeCount := len(topology.OrderedNodes) - len(removedNodes)
 	leftOverNodeHostnames := make([]string, 0, leftOverNodeCount)
@@ -291,21 +256,17 @@ func DelShard(options DelShardOptions) (newClusterTopology Topology, err error)
 			leftOverNodeHostnames = append(leftOverNodeHostnames, fmt.Sprintf("%s:%d", node.Hostname, node.Port))
 		}
 	}
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
-	if err := WaitForAllNodesClusterInfoState(
-		timeoutCtx,
-		env,
-		leftOverNodeHostnames,
-		fmt.Sprintf("cluster_known_nodes:%d", leftOverNodeCount)); err != nil {
+	if err := WaitForAllNodesClusterInfo(timeoutCtx, env, leftOverNodeHostnames, KnownNodesAre(leftOverNodeCount), DefaultWaitOptions); err != nil {
 		return Topology{}, err
 	}
 
-	client, err := valkeygo.NewClient(valkeygo.ClientOption{
-		InitAddress: leftOverNodeHostnames,
-		Username:    AdminUser,
-		Password:    env.AdminPassword,
-	})
+	client, err := NewClient(ReconcilerAuth(env), leftOverNodeHostnames...)
+	if err != nil {
+		return Topology{}, err
+	}
+	defer client.Close()
 	newClusterTopology, err = GetClusterTopology(client)
 	if err != nil {
 		return Topology{}, err
@@ -313,44 +274,3 @@ func DelShard(options DelShardOptions) (newClusterTopology Topology, err error)
 
 	return newClusterTopology, nil
 }
-
-// NOTE: you don't need to specify connection info
-type CreateClusterOptions struct {
-	CliBaseOptions
-
-	Nodes             []string
-	ReplicasPerMaster int
-}
-
-func CreateCluster(options CreateClusterOptions) error {
-	if !doesCommandExist("valkey-cli") {
-		return fmt.Errorf("valkey-cli is not installed")
-	}
-	if err := options.ValidateAuth(); err != nil {
-		return err
-	}
-
-	if len(options.Nodes) == 0 {
-		return fmt.Errorf("no nodes provided")
-	}
-	if options.ReplicasPerMaster < 0 {
-		return fmt.Errorf("replicas per master must be greater than or equal to 0")
-	}
-
-	args := []string{"--cluster", "create"}
-	args = append(args, options.Nodes...)
-	args = append(args, "--cluster-replicas", strconv.Itoa(options.ReplicasPerMaster), "--cluster-yes")
-
-	if options.Username != "" {
-		args = append(args, "--user", options.Username)
-	}
-	fmt.Printf("Command: valkey-cli %s\n", strings.Join(args, " "))
-	if options.Password != "" {
-		args = append(args, "-a", options.Password)
-	}
-
-	cmd := exec.Command("valkey-cli", args...) // #nosec G204 (cmd injection) -- args from validated structs, not user input
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
@@ -0,0 +1,48 @@
+package valkey
+
+import (
+	"slices"
+	"testing"
+	"valkey/reconciler/internal/utils"
+)
+
+func TestAuthCliArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		auth Auth
+		want []string
+	}{
+		{
+			name: "no auth",
+			auth: Auth{},
+			want: nil,
+		},
+		{
+			name: "password only",
+			auth: Auth{Username: "admin", Password: "secret"},
+			want: []string{"--user", "admin", "-a", "secret"},
+		},
+		{
+			name: "tls with a client certificate",
+			auth: Auth{Username: "admin", Password: "secret", TLS: &utils.TLS{
+				CACertFile: "/tls/ca.crt",
+				CertFile:   "/tls/tls.crt",
+				KeyFile:    "/tls/tls.key",
+			}},
+			want: []string{"--user", "admin", "-a", "secret", "--tls", "--cacert", "/tls/ca.crt", "--cert", "/tls/tls.crt", "--key", "/tls/tls.key"},
+		},
+		{
+			name: "tls against the system pool",
+			auth: Auth{TLS: &utils.TLS{ServerName: "valkey.example.com"}},
+			want: []string{"--tls", "--sni", "valkey.example.com"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.auth.cliArgs(); !slices.Equal(got, test.want) {
+				t.Errorf("cliArgs() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -1,15 +1,41 @@
 package valkey
 
-import valkeygo "github.com/valkey-io/valkey-go"
+import (
+	"valkey/reconciler/internal/utils"
 
-const AdminUser = "admin"
+	valkeygo "github.com/valkey-io/valkey-go"
+)
+
+// ReconcilerAuth is how the reconciler authenticates to the nodes
+func ReconcilerAuth(env utils.Env) Auth {
+	return Auth{Username: env.Username, Password: env.Password, TLS: env.TLS}
+}
 
 type ValkeyClient struct {
 	valkeygo.Client
 	options valkeygo.ClientOption
 }
 
-func NewClient(options valkeygo.ClientOption) (*ValkeyClient, error) {
+// NewClient connects to the cluster through any of addresses
+func NewClient(auth Auth, addresses ...string) (*ValkeyClient, error) {
+	options, err := auth.clientOption(addresses)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(options)
+}
+
+// NewNodeClient connects to the single node at address. commands aren't redirected to other nodes
+func NewNodeClient(auth Auth, address string) (*ValkeyClient, error) {
+	options, err := auth.clientOption([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	options.ForceSingleClient = true
+	return newClient(options)
+}
+
+func newClient(options valkeygo.ClientOption) (*ValkeyClient, error) {
 	client, err := valkeygo.NewClient(options)
 	if err != nil {
 		return nil, err
@@ -17,6 +43,23 @@ func NewClient(options valkeygo.ClientOption) (*ValkeyClient, error) {
 	return &ValkeyClient{Client: client, options: options}, nil
 }
 
+// every connection the reconciler makes is built here so they all get the same credentials and tls
+func (a Auth) clientOption(addresses []string) (valkeygo.ClientOption, error) {
+	options := valkeygo.ClientOption{
+		InitAddress: addresses,
+		Username:    a.Username,
+		Password:    a.Password,
+	}
+	if a.TLS != nil {
+		tlsConfig, err := a.TLS.Config()
+		if err != nil {
+			return valkeygo.ClientOption{}, err
+		}
+		options.TLSConfig = tlsConfig
+	}
+	return options, nil
+}
+
 func (v *ValkeyClient) Close() {
 	v.Client.Close()
 }
@@ -0,0 +1,248 @@
+package valkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/metrics"
+)
+
+var (
+	ErrNoNodes          = errors.New("no nodes provided")
+	ErrNotEnoughNodes   = errors.New("not enough nodes for the requested replicas per master")
+	ErrNodeNotEmpty     = errors.New("node already knows other nodes or has slots assigned")
+	ErrInvalidReplicas  = errors.New("replicas per master must be greater than or equal to 0")
+	ErrInvalidNodeCount = errors.New("node count must be a multiple of 1 + replicas per master")
+)
+
+type CreateStep string
+
+const (
+	CreateStepConnect     CreateStep = "connect"
+	CreateStepCheckEmpty  CreateStep = "check empty"
+	CreateStepConfigEpoch CreateStep = "set config epoch"
+	CreateStepAssignSlots CreateStep = "assign slots"
+	CreateStepMeet        CreateStep = "meet"
+	CreateStepReplicate   CreateStep = "replicate"
+	CreateStepWait        CreateStep = "wait"
+	CreateStepTopology    CreateStep = "topology"
+)
+
+// CreateError is returned by CreateCluster when a step fails against a specific node
+type CreateError struct {
+	Step    CreateStep
+	Address string
+	Err     error
+}
+
+func (e *CreateError) Error() string {
+	if e.Address == "" {
+		return fmt.Sprintf("create cluster: %s: %v", e.Step, e.Err)
+	}
+	return fmt.Sprintf("create cluster: %s %s: %v", e.Step, e.Address, e.Err)
+}
+
+func (e *CreateError) Unwrap() error {
+	return e.Err
+}
+
+type PlannedShard struct {
+	Master   string // address (hostname:port)
+	Slots    SlotRange
+	Replicas []string // addresses
+}
+
+// CreatePlan is which node becomes a master, which slots it owns and which nodes replicate it
+type CreatePlan struct {
+	Shards []PlannedShard
+}
+
+// PlanCreate assigns the first nodes as masters and splits the slots evenly between them. the rest of
+// the nodes are handed out round robin as replicas so that the last "layer" of nodes are the highest
+// statefulset indices. this keeps the shard index equal to the master's pod index and lets scale down
+// remove a replica from every master by removing the last pods.
+//
+// NOTE: nodes need to be ordered by statefulset index
+func PlanCreate(nodes []string, replicasPerMaster int) (CreatePlan, error) {
+	if len(nodes) == 0 {
+		return CreatePlan{}, ErrNoNodes
+	}
+	if replicasPerMaster < 0 {
+		return CreatePlan{}, ErrInvalidReplicas
+	}
+	if len(nodes) < 1+replicasPerMaster {
+		return CreatePlan{}, ErrNotEnoughNodes
+	}
+	if len(nodes)%(1+replicasPerMaster) != 0 {
+		return CreatePlan{}, ErrInvalidNodeCount
+	}
+
+	masterCount := len(nodes) / (1 + replicasPerMaster)
+	shards := make([]PlannedShard, masterCount)
+	for i := range masterCount {
+		shards[i] = PlannedShard{
+			Master: nodes[i],
+			Slots: SlotRange{
+				StartSlot: uint16(i * TotalSlots / masterCount),
+				EndSlot:   uint16((i+1)*TotalSlots/masterCount - 1),
+			},
+			Replicas: make([]string, 0, replicasPerMaster),
+		}
+	}
+	for i, replica := range nodes[masterCount:] {
+		shard := &shards[i%masterCount]
+		shard.Replicas = append(shard.Replicas, replica)
+	}
+
+	return CreatePlan{Shards: shards}, nil
+}
+
+type CreateClusterOptions struct {
+	Auth
+
+	Nodes             []string // hostname:port ordered by statefulset index
+	ReplicasPerMaster int
+	BusPort           int // cluster bus port of every node (env.BusPort)
+}
+
+// CreateCluster builds a new cluster out of empty nodes without valkey-cli. every master gets a unique
+// config epoch and its slots, then all nodes are introduced to the first node with CLUSTER MEET and
+// finally the replicas are attached to their masters following PlanCreate.
+func CreateCluster(ctx context.Context, options CreateClusterOptions) (Topology, error) {
+	if err := (CliBaseOptions{Auth: options.Auth}).ValidateAuth(); err != nil {
+		return Topology{}, &CreateError{Step: CreateStepConnect, Err: err}
+	}
+	if options.BusPort == 0 {
+		return Topology{}, fmt.Errorf("bus port is required")
+	}
+
+	plan, err := PlanCreate(options.Nodes, options.ReplicasPerMaster)
+	if err != nil {
+		return Topology{}, err
+	}
+
+	nodeClients := make(map[string]*ValkeyClient, len(options.Nodes))
+	defer func() {
+		for _, nodeClient := range nodeClients {
+			nodeClient.Close()
+		}
+	}()
+	for _, address := range options.Nodes {
+		nodeClient, err := NewNodeClient(options.Auth, address)
+		if err != nil {
+			return Topology{}, &CreateError{Step: CreateStepConnect, Address: address, Err: err}
+		}
+		nodeClients[address] = nodeClient
+
+		clusterInfo, err := GetClusterInfo(nodeClient)
+		if err != nil {
+			return Topology{}, &CreateError{Step: CreateStepCheckEmpty, Address: address, Err: err}
+		}
+		if clusterInfo.KnownNodes != 1 || clusterInfo.SlotsAssigned != 0 {
+			return Topology{}, &CreateError{Step: CreateStepCheckEmpty, Address: address, Err: ErrNodeNotEmpty}
+		}
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Info("Assigning slots to masters", "masters", len(plan.Shards))
+	for i, shard := range plan.Shards {
+		masterClient := nodeClients[shard.Master]
+
+		// unique epochs avoid a round of epoch collision resolution once the masters meet
+		epochCmd := masterClient.B().ClusterSetConfigEpoch().ConfigEpoch(int64(i + 1)).Build()
+		if err := masterClient.Do(ctx, epochCmd).Error(); err != nil {
+			return Topology{}, &CreateError{Step: CreateStepConfigEpoch, Address: shard.Master, Err: err}
+		}
+
+		addSlotsCmd := masterClient.B().ClusterAddslotsrange().StartSlotEndSlot().
+			StartSlotEndSlot(int64(shard.Slots.StartSlot), int64(shard.Slots.EndSlot)).Build()
+		if err := masterClient.Do(ctx, addSlotsCmd).Error(); err != nil {
+			return Topology{}, &CreateError{Step: CreateStepAssignSlots, Address: shard.Master, Err: err}
+		}
+		logger.Debug("Assigned slots", "address", shard.Master, "start_slot", shard.Slots.StartSlot, "end_slot", shard.Slots.EndSlot)
+	}
+	logger.Info("Slots assigned")
+
+	logger.Info("Joining nodes", "nodes", len(options.Nodes))
+	firstAddress := options.Nodes[0]
+	firstClient := nodeClients[firstAddress]
+	for _, address := range options.Nodes[1:] {
+		ip, port, err := resolveAddress(ctx, address)
+		if err != nil {
+			return Topology{}, &CreateError{Step: CreateStepMeet, Address: address, Err: err}
+		}
+
+		meetCmd := firstClient.B().ClusterMeet().Ip(ip).Port(int64(port)).ClusterBusPort(int64(options.BusPort)).Build()
+		if err := firstClient.Do(ctx, meetCmd).Error(); err != nil {
+			return Topology{}, &CreateError{Step: CreateStepMeet, Address: address, Err: err}
+		}
+	}
+
+	for _, address := range options.Nodes {
+		if err := WaitForClusterInfo(ctx, nodeClients[address], KnownNodesAre(len(options.Nodes)), DefaultWaitOptions); err != nil {
+			return Topology{}, &CreateError{Step: CreateStepWait, Address: address, Err: err}
+		}
+	}
+	logger.Info("Nodes joined")
+
+	logger.Info("Attaching replicas", "replicas_per_master", options.ReplicasPerMaster)
+	for _, shard := range plan.Shards {
+		if len(shard.Replicas) == 0 {
+			continue
+		}
+
+		masterClient := nodeClients[shard.Master]
+		masterID, err := masterClient.Do(ctx, masterClient.B().ClusterMyid().Build()).ToString()
+		if err != nil {
+			return Topology{}, &CreateError{Step: CreateStepReplicate, Address: shard.Master, Err: err}
+		}
+
+		for _, replica := range shard.Replicas {
+			if err := Replicate(nodeClients[replica], masterID); err != nil {
+				return Topology{}, &CreateError{Step: CreateStepReplicate, Address: replica, Err: err}
+			}
+			logger.Debug("Attached replica", "address", replica, "master", shard.Master, "master_id", masterID)
+			events.Normal(ctx, events.ReasonReplicaAttached, "Attached replica %s to master %s", replica, shard.Master)
+		}
+	}
+	logger.Info("Replicas attached")
+
+	for _, address := range options.Nodes {
+		if err := WaitForClusterInfo(ctx, nodeClients[address], ClusterStateIsOK, DefaultWaitOptions); err != nil {
+			return Topology{}, &CreateError{Step: CreateStepWait, Address: address, Err: err}
+		}
+	}
+
+	metrics.NodesAdded(len(options.Nodes))
+
+	clusterTopology, err := GetClusterTopology(firstClient)
+	if err != nil {
+		return Topology{}, &CreateError{Step: CreateStepTopology, Address: firstAddress, Err: err}
+	}
+	return clusterTopology, nil
+}
+
+// CLUSTER MEET only accepts ips
+func resolveAddress(ctx context.Context, address string) (ip string, port uint16, err error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+	parsedPort, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("port should be a number: %s", portString)
+	}
+
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(ips) == 0 {
+		return "", 0, fmt.Errorf("no ips found for %s", host)
+	}
+	return ips[0], uint16(parsedPort), nil
+}
@@ -0,0 +1,151 @@
+package valkey
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPlanCreate(t *testing.T) {
+	nodes := func(count int) []string {
+		addresses := make([]string, count)
+		for i := range count {
+			addresses[i] = fmt.Sprintf("valkey-%d.valkey.default.svc.cluster.local:6379", i)
+		}
+		return addresses
+	}
+
+	tests := []struct {
+		name              string
+		nodes             []string
+		replicasPerMaster int
+		wantErr           error
+		check             func(t *testing.T, plan CreatePlan)
+	}{
+		{
+			name:              "no nodes",
+			nodes:             nil,
+			replicasPerMaster: 0,
+			wantErr:           ErrNoNodes,
+		},
+		{
+			name:              "negative replicas",
+			nodes:             nodes(3),
+			replicasPerMaster: -1,
+			wantErr:           ErrInvalidReplicas,
+		},
+		{
+			name:              "not enough nodes for replicas",
+			nodes:             nodes(2),
+			replicasPerMaster: 2,
+			wantErr:           ErrNotEnoughNodes,
+		},
+		{
+			name:              "uneven node count",
+			nodes:             nodes(5),
+			replicasPerMaster: 1,
+			wantErr:           ErrInvalidNodeCount,
+		},
+		{
+			name:              "single master owns every slot",
+			nodes:             nodes(1),
+			replicasPerMaster: 0,
+			check: func(t *testing.T, plan CreatePlan) {
+				if len(plan.Shards) != 1 {
+					t.Fatalf("expected 1 shard, got %d", len(plan.Shards))
+				}
+				if plan.Shards[0].Slots != (SlotRange{StartSlot: 0, EndSlot: 16383}) {
+					t.Errorf("expected slots 0-16383, got %v", plan.Shards[0].Slots)
+				}
+				if len(plan.Shards[0].Replicas) != 0 {
+					t.Errorf("expected no replicas, got %v", plan.Shards[0].Replicas)
+				}
+			},
+		},
+		{
+			name:              "three masters cover every slot without overlap",
+			nodes:             nodes(3),
+			replicasPerMaster: 0,
+			check: func(t *testing.T, plan CreatePlan) {
+				want := []SlotRange{
+					{StartSlot: 0, EndSlot: 5460},
+					{StartSlot: 5461, EndSlot: 10921},
+					{StartSlot: 10922, EndSlot: 16383},
+				}
+				if len(plan.Shards) != len(want) {
+					t.Fatalf("expected %d shards, got %d", len(want), len(plan.Shards))
+				}
+				for i, shard := range plan.Shards {
+					if shard.Slots != want[i] {
+						t.Errorf("shard %d slots = %v, want %v", i, shard.Slots, want[i])
+					}
+				}
+			},
+		},
+		{
+			name:              "replicas are handed out round robin",
+			nodes:             nodes(6),
+			replicasPerMaster: 2,
+			check: func(t *testing.T, plan CreatePlan) {
+				if len(plan.Shards) != 2 {
+					t.Fatalf("expected 2 shards, got %d", len(plan.Shards))
+				}
+				wantMasters := []string{"valkey-0", "valkey-1"}
+				wantReplicas := [][]string{{"valkey-2", "valkey-4"}, {"valkey-3", "valkey-5"}}
+				for i, shard := range plan.Shards {
+					if !strings.HasPrefix(shard.Master, wantMasters[i]+".") {
+						t.Errorf("shard %d master = %s, want %s", i, shard.Master, wantMasters[i])
+					}
+					if len(shard.Replicas) != len(wantReplicas[i]) {
+						t.Fatalf("shard %d has %d replicas, want %d", i, len(shard.Replicas), len(wantReplicas[i]))
+					}
+					for j, replica := range shard.Replicas {
+						if !strings.HasPrefix(replica, wantReplicas[i][j]+".") {
+							t.Errorf("shard %d replica %d = %s, want %s", i, j, replica, wantReplicas[i][j])
+						}
+					}
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan, err := PlanCreate(test.nodes, test.replicasPerMaster)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("expected error %v, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			test.check(t, plan)
+		})
+	}
+}
+
+func TestCreateError(t *testing.T) {
+	err := error(&CreateError{
+		Step:    CreateStepCheckEmpty,
+		Address: "valkey-0.valkey.default.svc.cluster.local:6379",
+		Err:     ErrNodeNotEmpty,
+	})
+
+	if !errors.Is(err, ErrNodeNotEmpty) {
+		t.Errorf("expected errors.Is to match ErrNodeNotEmpty")
+	}
+
+	var createErr *CreateError
+	if !errors.As(err, &createErr) {
+		t.Fatalf("expected errors.As to match *CreateError")
+	}
+	if createErr.Step != CreateStepCheckEmpty {
+		t.Errorf("expected step %s, got %s", CreateStepCheckEmpty, createErr.Step)
+	}
+	if !strings.Contains(err.Error(), "valkey-0.valkey.default.svc.cluster.local:6379") {
+		t.Errorf("expected error to contain the node address, got %s", err.Error())
+	}
+}
@@ -0,0 +1,279 @@
+package valkey
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+
+	valkeygo "github.com/valkey-io/valkey-go"
+)
+
+type FailoverMode string
+
+const (
+	// the master stops taking writes until the replica has caught up so nothing is lost. needs the master
+	FailoverDefault FailoverMode = "default"
+	// the replica doesn't wait for the master (ie. it is down) but the other masters still vote
+	FailoverForce FailoverMode = "force"
+	// no vote either. for when the majority of masters is gone
+	FailoverTakeover FailoverMode = "takeover"
+)
+
+func ParseFailoverMode(mode string) (FailoverMode, error) {
+	switch FailoverMode(mode) {
+	case FailoverDefault, FailoverForce, FailoverTakeover:
+		return FailoverMode(mode), nil
+	default:
+		return "", fmt.Errorf("unknown failover mode %q. expected %s, %s or %s", mode, FailoverDefault, FailoverForce, FailoverTakeover)
+	}
+}
+
+// DefaultMaxFailoverLag is how many bytes of the replication stream a replica may be behind its master
+// and still take over. the master pauses writes until the replica catches up so this bounds the pause
+const DefaultMaxFailoverLag = 1 << 20
+
+type FailoverOptions struct {
+	Auth      Auth
+	Topology  Topology
+	MasterID  string       // shard to fail over
+	ReplicaID string       // replica that takes over. empty picks the one furthest along
+	Mode      FailoverMode // empty is FailoverDefault
+	MaxLag    int64        // bytes. 0 is DefaultMaxFailoverLag
+	Unsafe    bool         // fail over even when the checks say data would be lost
+}
+
+// FailoverCheck is what Failover found out before failing over
+type FailoverCheck struct {
+	Master        ClusterNode
+	Replica       ClusterNode
+	Mode          FailoverMode
+	MasterOffset  int64 // -1 when the master couldn't be reached
+	ReplicaOffset int64
+	Lag           int64    // bytes the replica is behind the master. -1 when the master couldn't be reached
+	Problems      []string // why failing over would lose data. empty when it is safe
+}
+
+// UnsafeFailoverError is returned instead of failing over when the checks found problems
+type UnsafeFailoverError struct {
+	Check FailoverCheck
+}
+
+func (e *UnsafeFailoverError) Error() string {
+	return fmt.Sprintf("refusing to fail over %s to %s: %s", e.Check.Master.ID, e.Check.Replica.ID, strings.Join(e.Check.Problems, "; "))
+}
+
+// node id -> what the node reported. nodes that couldn't be reached are missing
+type replicationStates map[string]ReplicationInfo
+
+// checkFailover picks the replica and works out whether failing over to it would lose writes
+func checkFailover(options FailoverOptions, states replicationStates) (FailoverCheck, error) {
+	master, exists := options.Topology.Masters[options.MasterID]
+	if !exists {
+		return FailoverCheck{}, fmt.Errorf("master %s not found in topology", options.MasterID)
+	}
+	if len(master.SlaveIds) == 0 {
+		return FailoverCheck{}, fmt.Errorf("master %s has no replicas to fail over to", options.MasterID)
+	}
+	maxLag := options.MaxLag
+	if maxLag == 0 {
+		maxLag = DefaultMaxFailoverLag
+	}
+
+	var replica ClusterNode
+	if options.ReplicaID != "" {
+		if !slices.Contains(master.SlaveIds, options.ReplicaID) {
+			return FailoverCheck{}, fmt.Errorf("%s is not a replica of master %s", options.ReplicaID, options.MasterID)
+		}
+		replica = options.Topology.Slaves[options.ReplicaID]
+	} else {
+		found := false
+		for _, slaveID := range master.SlaveIds {
+			candidate := options.Topology.Slaves[slaveID]
+			state, reachable := states[slaveID]
+			if !reachable {
+				continue
+			}
+			best := states[replica.ID]
+			if !found || state.Offset() > best.Offset() || (state.Offset() == best.Offset() && candidate.Index() < replica.Index()) {
+				replica, found = candidate, true
+			}
+		}
+		if !found {
+			return FailoverCheck{}, fmt.Errorf("no replica of master %s can be reached", options.MasterID)
+		}
+	}
+	replicaState, reachable := states[replica.ID]
+	if !reachable {
+		return FailoverCheck{}, fmt.Errorf("replica %s can't be reached", replica.ID)
+	}
+
+	check := FailoverCheck{
+		Master:        master.Node,
+		Replica:       replica,
+		Mode:          options.Mode,
+		MasterOffset:  -1,
+		ReplicaOffset: replicaState.Offset(),
+		Lag:           -1,
+	}
+	if check.Mode == "" {
+		check.Mode = FailoverDefault
+	}
+
+	masterState, masterReachable := states[master.Node.ID]
+	if masterReachable && masterState.Role == RoleMaster {
+		check.MasterOffset = masterState.Offset()
+		check.Lag = max(masterState.Offset()-replicaState.Offset(), 0)
+	}
+
+	switch {
+	case check.Mode == FailoverDefault && check.Lag == -1:
+		check.Problems = append(check.Problems, "master can't be reached. use force or takeover")
+	case check.Mode == FailoverTakeover && check.Lag != -1:
+		check.Problems = append(check.Problems, "master is still up. takeover skips the vote, use default or force")
+	}
+	if check.Lag > maxLag {
+		check.Problems = append(check.Problems, fmt.Sprintf("replica is %d bytes behind the master (at most %d)", check.Lag, maxLag))
+	}
+	if check.Mode == FailoverDefault && !replicaState.MasterLinkUp {
+		check.Problems = append(check.Problems, "replica's link to the master is down")
+	}
+	// without the master to compare with the best this shard can do is the replica that got the furthest
+	for _, slaveID := range master.SlaveIds {
+		if state, reachable := states[slaveID]; check.Lag == -1 && reachable && slaveID != replica.ID && state.Offset() > replicaState.Offset() {
+			check.Problems = append(check.Problems, fmt.Sprintf("replica %s is %d bytes further along", slaveID, state.Offset()-replicaState.Offset()))
+		}
+	}
+	return check, nil
+}
+
+// CheckFailover asks every node of the shard for its replication offset and works out which replica
+// would take over and whether that would lose writes without failing over
+func CheckFailover(ctx context.Context, options FailoverOptions) (FailoverCheck, error) {
+	clients, states, err := shardReplicationStates(ctx, options)
+	for _, client := range clients {
+		client.Close()
+	}
+	if err != nil {
+		return FailoverCheck{}, err
+	}
+	return checkFailover(options, states)
+}
+
+// the clients are for the nodes that could be reached and have to be closed by the caller
+func shardReplicationStates(ctx context.Context, options FailoverOptions) (map[string]*ValkeyClient, replicationStates, error) {
+	logger := logging.FromContext(ctx)
+	master, exists := options.Topology.Masters[options.MasterID]
+	if !exists {
+		return nil, nil, fmt.Errorf("master %s not found in topology", options.MasterID)
+	}
+
+	clients := map[string]*ValkeyClient{}
+	states := replicationStates{}
+	shardNodes := []ClusterNode{master.Node}
+	for _, slaveID := range master.SlaveIds {
+		shardNodes = append(shardNodes, options.Topology.Slaves[slaveID])
+	}
+	for _, node := range shardNodes {
+		client, err := NewNodeClient(options.Auth, node.Address())
+		if err != nil {
+			logger.Debug("Node can't be reached for the failover check", "node_id", node.ID, "error", err)
+			continue
+		}
+		clients[node.ID] = client
+		state, err := GetReplicationInfo(ctx, client)
+		if err != nil {
+			logger.Debug("Node didn't report its replication offset", "node_id", node.ID, "error", err)
+			continue
+		}
+		states[node.ID] = state
+	}
+	return clients, states, nil
+}
+
+// Failover promotes a replica of the shard to master after comparing its replication offset with the
+// master's (and the other replicas'). unsafe failovers are refused with an *UnsafeFailoverError unless
+// options.Unsafe is set. the check is returned either way
+func Failover(ctx context.Context, options FailoverOptions) (FailoverCheck, error) {
+	logger := logging.FromContext(ctx)
+	clients, states, err := shardReplicationStates(ctx, options)
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+	if err != nil {
+		return FailoverCheck{}, err
+	}
+
+	check, err := checkFailover(options, states)
+	if err != nil {
+		return FailoverCheck{}, err
+	}
+	if len(check.Problems) > 0 {
+		if !options.Unsafe {
+			return check, &UnsafeFailoverError{Check: check}
+		}
+		logger.Warn("Failing over even though it isn't safe", "problems", check.Problems)
+	}
+
+	replicaClient := clients[check.Replica.ID]
+	failoverCmd := replicaClient.B().ClusterFailover()
+	var cmd valkeygo.Completed
+	switch check.Mode {
+	case FailoverForce:
+		cmd = failoverCmd.Force().Build()
+	case FailoverTakeover:
+		cmd = failoverCmd.Takeover().Build()
+	default:
+		cmd = failoverCmd.Build()
+	}
+	logger.Info("Failing over", "master_id", check.Master.ID, "replica_id", check.Replica.ID, "mode", check.Mode, "lag", check.Lag)
+	if err := replicaClient.Do(ctx, cmd).Error(); err != nil {
+		return check, fmt.Errorf("failover to %s: %w", check.Replica.ID, err)
+	}
+
+	// the old master only follows the new one once it can be reached again
+	masterClient := clients[check.Master.ID]
+	if check.Lag == -1 {
+		masterClient = nil
+	}
+	if err := waitForFailover(ctx, replicaClient, masterClient, check.Replica.Hostname); err != nil {
+		return check, err
+	}
+
+	events.Normal(ctx, events.ReasonFailover, "Failed over master %s (%s) to %s (%s) with %s failover, %s behind",
+		check.Master.ID, check.Master.Hostname, check.Replica.ID, check.Replica.Hostname, check.Mode, describeLag(check.Lag))
+	return check, nil
+}
+
+func describeLag(lag int64) string {
+	if lag == -1 {
+		return "unknown bytes"
+	}
+	return fmt.Sprintf("%d bytes", lag)
+}
+
+// waits until the replica reports itself as master and (when there is one) the old master follows it
+func waitForFailover(ctx context.Context, replicaClient, masterClient valkeygo.Client, replicaHostname string) error {
+	err := poll(ctx, DefaultWaitOptions, func(ctx context.Context) (bool, error) {
+		replicaState, err := GetReplicationInfo(ctx, replicaClient)
+		if err != nil || replicaState.Role != RoleMaster {
+			return false, err
+		}
+		if masterClient == nil {
+			return true, nil
+		}
+		masterState, err := GetReplicationInfo(ctx, masterClient)
+		if err != nil {
+			return false, err
+		}
+		return masterState.Role == RoleReplica && masterState.MasterHost == replicaHostname, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for failover to %s: %w", replicaHostname, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package valkey
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCheckFailover(t *testing.T) {
+	// node0 is the master of node1 and node2
+	topology, err := ClusterTopology([]ClusterNode{spreadNode(0, ""), spreadNode(1, "node0"), spreadNode(2, "node0")})
+	if err != nil {
+		t.Fatalf("unexpected topology error: %v", err)
+	}
+	master := ReplicationInfo{Role: RoleMaster, MasterReplOffset: 1000}
+	caughtUp := ReplicationInfo{Role: RoleReplica, MasterLinkUp: true, ReplicaOffset: 1000}
+	behind := ReplicationInfo{Role: RoleReplica, MasterLinkUp: true, ReplicaOffset: 400}
+	linkDown := ReplicationInfo{Role: RoleReplica, ReplicaOffset: 900}
+
+	tests := []struct {
+		name         string
+		options      FailoverOptions
+		states       replicationStates
+		wantReplica  string
+		wantLag      int64
+		wantProblems int
+		wantErr      bool
+	}{
+		{
+			name:        "picks the replica furthest along",
+			options:     FailoverOptions{MasterID: "node0"},
+			states:      replicationStates{"node0": master, "node1": behind, "node2": caughtUp},
+			wantReplica: "node2",
+			wantLag:     0,
+		},
+		{
+			name:        "ties go to the lowest pod index",
+			options:     FailoverOptions{MasterID: "node0"},
+			states:      replicationStates{"node0": master, "node1": caughtUp, "node2": caughtUp},
+			wantReplica: "node1",
+			wantLag:     0,
+		},
+		{
+			name:         "replica too far behind",
+			options:      FailoverOptions{MasterID: "node0", ReplicaID: "node1", MaxLag: 100},
+			states:       replicationStates{"node0": master, "node1": behind, "node2": caughtUp},
+			wantReplica:  "node1",
+			wantLag:      600,
+			wantProblems: 1,
+		},
+		{
+			name:         "link to the master down",
+			options:      FailoverOptions{MasterID: "node0", ReplicaID: "node1"},
+			states:       replicationStates{"node0": master, "node1": linkDown},
+			wantReplica:  "node1",
+			wantLag:      100,
+			wantProblems: 1,
+		},
+		{
+			name:         "default without the master",
+			options:      FailoverOptions{MasterID: "node0"},
+			states:       replicationStates{"node1": caughtUp, "node2": behind},
+			wantReplica:  "node1",
+			wantLag:      -1,
+			wantProblems: 1,
+		},
+		{
+			name:        "force without the master",
+			options:     FailoverOptions{MasterID: "node0", Mode: FailoverForce},
+			states:      replicationStates{"node1": linkDown, "node2": behind},
+			wantReplica: "node1",
+			wantLag:     -1,
+		},
+		{
+			name:         "takeover to a replica that isn't the furthest along",
+			options:      FailoverOptions{MasterID: "node0", ReplicaID: "node2", Mode: FailoverTakeover},
+			states:       replicationStates{"node1": linkDown, "node2": behind},
+			wantReplica:  "node2",
+			wantLag:      -1,
+			wantProblems: 1,
+		},
+		{
+			name:         "takeover while the master is up",
+			options:      FailoverOptions{MasterID: "node0", Mode: FailoverTakeover},
+			states:       replicationStates{"node0": master, "node1": caughtUp},
+			wantReplica:  "node1",
+			wantLag:      0,
+			wantProblems: 1,
+		},
+		{
+			name:    "not a replica of the shard",
+			options: FailoverOptions{MasterID: "node0", ReplicaID: "node0"},
+			states:  replicationStates{"node0": master},
+			wantErr: true,
+		},
+		{
+			name:    "no replica reachable",
+			options: FailoverOptions{MasterID: "node0"},
+			states:  replicationStates{"node0": master},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.options.Topology = topology
+			check, err := checkFailover(test.options, test.states)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", check)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if check.Replica.ID != test.wantReplica {
+				t.Errorf("replica = %s, want %s", check.Replica.ID, test.wantReplica)
+			}
+			if check.Lag != test.wantLag {
+				t.Errorf("lag = %d, want %d", check.Lag, test.wantLag)
+			}
+			if len(check.Problems) != test.wantProblems {
+				t.Errorf("problems = %v, want %d", check.Problems, test.wantProblems)
+			}
+		})
+	}
+}
+
+func TestUnsafeFailoverError(t *testing.T) {
+	var err error = &UnsafeFailoverError{Check: FailoverCheck{
+		Master:   ClusterNode{ID: "node0"},
+		Replica:  ClusterNode{ID: "node1"},
+		Problems: []string{"a", "b"},
+	}}
+	var unsafeErr *UnsafeFailoverError
+	if !errors.As(err, &unsafeErr) || !slices.Equal(unsafeErr.Check.Problems, []string{"a", "b"}) {
+		t.Fatalf("errors.As() = %v", err)
+	}
+	if want := "refusing to fail over node0 to node1: a; b"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
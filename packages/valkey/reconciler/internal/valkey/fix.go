@@ -0,0 +1,267 @@
+package valkey
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/metrics"
+)
+
+type FixActionType string
+
+const (
+	FixFinishMigration   FixActionType = "finish-migration"
+	FixRollbackMigration FixActionType = "rollback-migration"
+	FixAssignSlots       FixActionType = "assign-slots"
+	FixResolveOwner      FixActionType = "resolve-owner"
+)
+
+type FixAction struct {
+	Type  FixActionType `json:"type"`
+	Slots []SlotRange   `json:"slots"`
+	// finish/rollback-migration: the migration's source and target. assign-slots: only TargetID, the
+	// new owner. resolve-owner: SourceID gives up the slots to TargetID
+	SourceID string `json:"sourceId,omitempty"`
+	TargetID string `json:"targetId"`
+}
+
+func (a FixAction) String() string {
+	slotRanges := make([]string, 0, len(a.Slots))
+	for _, slotRange := range a.Slots {
+		slotRanges = append(slotRanges, slotRange.String())
+	}
+	slots := strings.Join(slotRanges, " ")
+
+	switch a.Type {
+	case FixFinishMigration:
+		return fmt.Sprintf("finish migrating slot %s from %s to %s", slots, a.SourceID, a.TargetID)
+	case FixRollbackMigration:
+		return fmt.Sprintf("roll back migrating slot %s from %s to %s", slots, a.SourceID, a.TargetID)
+	case FixAssignSlots:
+		return fmt.Sprintf("assign uncovered slots %s to %s", slots, a.TargetID)
+	case FixResolveOwner:
+		return fmt.Sprintf("move slots %s claimed by both %s and %s to %s", slots, a.SourceID, a.TargetID, a.TargetID)
+	}
+	return fmt.Sprintf("%s %s", a.Type, slots)
+}
+
+// PlanFix works out how to repair what CheckCluster reports about slots, the same way
+// `valkey-cli --cluster fix` would. myselfNodes needs every master's view of itself.
+//   - half-migrated slots are finished when both masters are still around and rolled back (made
+//     stable again) when one of them is gone
+//   - slots claimed by more than one master go to the one with the highest config epoch, which is
+//     also the claim the cluster bus would settle on. ties go to the lowest node id
+//   - uncovered slots go to the least loaded masters in contiguous ranges
+func PlanFix(myselfNodes []ClusterNode) ([]FixAction, error) {
+	masters := make(map[string]ClusterNode, len(myselfNodes))
+	for _, node := range myselfNodes {
+		masters[node.ID] = node
+	}
+	masterIDs := slices.Sorted(maps.Keys(masters))
+
+	var actions []FixAction
+	for _, move := range OpenSlotMoves(myselfNodes) {
+		action := FixAction{
+			Type:     FixFinishMigration,
+			Slots:    []SlotRange{{StartSlot: move.Slot, EndSlot: move.Slot}},
+			SourceID: move.SourceID,
+			TargetID: move.TargetID,
+		}
+		_, sourceExists := masters[move.SourceID]
+		_, targetExists := masters[move.TargetID]
+		if !sourceExists || !targetExists {
+			action.Type = FixRollbackMigration
+		}
+		actions = append(actions, action)
+	}
+
+	owners := make([][]string, TotalSlots)
+	for _, id := range masterIDs {
+		for _, slot := range expandSlotRanges(masters[id].Slots) {
+			owners[slot] = append(owners[slot], id)
+		}
+	}
+
+	loads := make(map[string]int, len(masters))
+	lost := map[[2]string][]uint16{} // [loser, winner] -> slots
+	var uncovered []uint16
+	for slot, slotOwners := range owners {
+		if len(slotOwners) == 0 {
+			uncovered = append(uncovered, uint16(slot))
+			continue
+		}
+		winner := slices.MaxFunc(slotOwners, func(a, b string) int {
+			return cmp.Or(cmp.Compare(masters[a].ConfigEp, masters[b].ConfigEp), strings.Compare(b, a))
+		})
+		loads[winner]++
+		for _, owner := range slotOwners {
+			if owner != winner {
+				lost[[2]string{owner, winner}] = append(lost[[2]string{owner, winner}], uint16(slot))
+			}
+		}
+	}
+	for _, key := range slices.SortedFunc(maps.Keys(lost), func(a, b [2]string) int {
+		return cmp.Or(strings.Compare(a[0], b[0]), strings.Compare(a[1], b[1]))
+	}) {
+		actions = append(actions, FixAction{
+			Type:     FixResolveOwner,
+			Slots:    compressSlots(lost[key]),
+			SourceID: key[0],
+			TargetID: key[1],
+		})
+	}
+
+	if len(uncovered) > 0 {
+		if len(masters) == 0 {
+			return nil, fmt.Errorf("%d slots are uncovered and there are no masters to assign them to", len(uncovered))
+		}
+		assigned := assignUncoveredSlots(uncovered, loads, masterIDs)
+		for _, id := range masterIDs {
+			if slots, exists := assigned[id]; exists {
+				actions = append(actions, FixAction{Type: FixAssignSlots, Slots: compressSlots(slots), TargetID: id})
+			}
+		}
+	}
+
+	return actions, nil
+}
+
+// fills the least loaded masters up to the average load in turn so every master gets a contiguous
+// range instead of every other slot
+func assignUncoveredSlots(uncovered []uint16, loads map[string]int, masterIDs []string) map[string][]uint16 {
+	total := len(uncovered)
+	for _, id := range masterIDs {
+		total += loads[id]
+	}
+	ideal := (total + len(masterIDs) - 1) / len(masterIDs)
+
+	byLoad := slices.Clone(masterIDs)
+	slices.SortStableFunc(byLoad, func(a, b string) int {
+		return cmp.Compare(loads[a], loads[b])
+	})
+
+	assigned := make(map[string][]uint16)
+	next := 0
+	for _, id := range byLoad {
+		take := min(ideal-loads[id], len(uncovered)-next)
+		if take <= 0 {
+			continue
+		}
+		assigned[id] = uncovered[next : next+take]
+		next += take
+	}
+	return assigned
+}
+
+type FixOptions struct {
+	RebalanceOptions // connection, auth and how keys are migrated
+
+	DryRun   bool
+	Progress func(FixAction) // called before every action; default logs the action
+}
+
+// Fix connects to every master, plans the repairs with PlanFix and applies them in order. with DryRun
+// nothing is changed. the planned actions are returned either way
+func Fix(ctx context.Context, options FixOptions) ([]FixAction, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	masterClients, masters, err := connectToMasters(options.RebalanceOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, masterClient := range masterClients {
+			masterClient.Close()
+		}
+	}()
+
+	actions, err := PlanFix(masters)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := logging.FromContext(ctx)
+	progress := options.Progress
+	if progress == nil {
+		progress = func(action FixAction) {
+			logger.Info("Fixing cluster", "action", action.Type, "detail", action.String())
+		}
+	}
+
+	for _, action := range actions {
+		progress(action)
+		if options.DryRun {
+			continue
+		}
+		if err := applyFixAction(ctx, masterClients, action, options.RebalanceOptions); err != nil {
+			return actions, fmt.Errorf("%s: %w", action, err)
+		}
+	}
+	return actions, nil
+}
+
+func applyFixAction(ctx context.Context, masterClients map[string]*ValkeyClient, action FixAction, options RebalanceOptions) error {
+	switch action.Type {
+	case FixFinishMigration:
+		move := SlotMove{Slot: action.Slots[0].StartSlot, SourceID: action.SourceID, TargetID: action.TargetID}
+		if _, err := MigrateSlot(ctx, masterClients, move, options); err != nil {
+			return err
+		}
+		metrics.SlotMigrated()
+
+	case FixRollbackMigration:
+		for _, nodeID := range []string{action.TargetID, action.SourceID} {
+			masterClient, exists := masterClients[nodeID]
+			if !exists {
+				continue
+			}
+			stableCmd := masterClient.B().ClusterSetslot().Slot(int64(action.Slots[0].StartSlot)).Stable().Build()
+			if err := masterClient.Do(ctx, stableCmd).Error(); err != nil {
+				return fmt.Errorf("set slot stable on %s: %w", nodeID, err)
+			}
+		}
+
+	case FixAssignSlots:
+		masterClient, exists := masterClients[action.TargetID]
+		if !exists {
+			return fmt.Errorf("master %s not found", action.TargetID)
+		}
+		addSlotsCmd := masterClient.B().ClusterAddslotsrange().StartSlotEndSlot()
+		for _, slotRange := range action.Slots {
+			addSlotsCmd = addSlotsCmd.StartSlotEndSlot(int64(slotRange.StartSlot), int64(slotRange.EndSlot))
+		}
+		if err := masterClient.Do(ctx, addSlotsCmd.Build()).Error(); err != nil {
+			return fmt.Errorf("add slots to %s: %w", action.TargetID, err)
+		}
+
+	case FixResolveOwner:
+		sourceClient, exists := masterClients[action.SourceID]
+		if !exists {
+			return fmt.Errorf("master %s not found", action.SourceID)
+		}
+		targetClient, exists := masterClients[action.TargetID]
+		if !exists {
+			return fmt.Errorf("master %s not found", action.TargetID)
+		}
+		// keys written to the losing master would be orphaned once it lets go of the slot
+		for _, slot := range expandSlotRanges(action.Slots) {
+			if _, err := migrateKeys(ctx, sourceClient, targetClient, slot, options); err != nil {
+				return err
+			}
+			nodeCmd := sourceClient.B().ClusterSetslot().Slot(int64(slot)).Node().NodeId(action.TargetID).Build()
+			if err := sourceClient.Do(ctx, nodeCmd).Error(); err != nil {
+				return fmt.Errorf("set slot owner on %s: %w", action.SourceID, err)
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown fix action %s", action.Type)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package valkey
+
+import (
+	"testing"
+)
+
+func TestPlanFix(t *testing.T) {
+	tests := []struct {
+		name    string
+		masters func() []ClusterNode
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "nothing to fix",
+			masters: func() []ClusterNode { return checkNodes()[:3] },
+			want:    nil,
+		},
+		{
+			name: "finish a half-migrated slot",
+			masters: func() []ClusterNode {
+				masters := checkNodes()[:3]
+				masters[0].Migrating = []MigratingSlot{{Slot: 42, MigratingNodeID: "m1"}}
+				masters[1].Importing = []ImportingSlot{{Slot: 42, ImportingNodeID: "m0"}}
+				return masters
+			},
+			want: []string{"finish migrating slot 42 from m0 to m1"},
+		},
+		{
+			name: "roll back a migration to a master that is gone",
+			masters: func() []ClusterNode {
+				masters := checkNodes()[:3]
+				masters[0].Migrating = []MigratingSlot{{Slot: 42, MigratingNodeID: "gone"}}
+				return masters
+			},
+			want: []string{"roll back migrating slot 42 from m0 to gone"},
+		},
+		{
+			name: "highest config epoch keeps a doubly owned slot",
+			masters: func() []ClusterNode {
+				masters := checkNodes()[:3]
+				masters[1].Slots = []SlotRange{{StartSlot: 5000, EndSlot: 10922}}
+				return masters
+			},
+			want: []string{"move slots 5000-5460 claimed by both m0 and m1 to m1"},
+		},
+		{
+			name: "uncovered slots go to the least loaded masters",
+			masters: func() []ClusterNode {
+				masters := checkNodes()[:3]
+				masters[0].Slots = []SlotRange{{StartSlot: 0, EndSlot: 99}}
+				masters[2].Slots = nil
+				return masters
+			},
+			// m2 is empty so it is filled up first
+			want: []string{
+				"assign uncovered slots 11024-16383 to m0",
+				"assign uncovered slots 100-5460 10923-11023 to m2",
+			},
+		},
+		{
+			name:    "no masters",
+			masters: func() []ClusterNode { return nil },
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actions, err := PlanFix(test.masters())
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(actions) != len(test.want) {
+				t.Fatalf("expected %d actions, got %v", len(test.want), actions)
+			}
+			for i, action := range actions {
+				if action.String() != test.want[i] {
+					t.Errorf("action %d = %q, want %q", i, action, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAssignUncoveredSlots(t *testing.T) {
+	uncovered := make([]uint16, 0, 100)
+	for slot := range uint16(100) {
+		uncovered = append(uncovered, slot)
+	}
+	loads := map[string]int{"a": 60, "b": 0, "c": 10}
+
+	assigned := assignUncoveredSlots(uncovered, loads, []string{"a", "b", "c"})
+	total := 0
+	for id, slots := range assigned {
+		total += len(slots)
+		if loads[id]+len(slots) > 57 {
+			t.Errorf("%s ends up with %d slots, more than the average", id, loads[id]+len(slots))
+		}
+	}
+	if total != len(uncovered) {
+		t.Errorf("assigned %d slots, want %d", total, len(uncovered))
+	}
+	if _, exists := assigned["a"]; exists {
+		t.Errorf("the most loaded master shouldn't get any slots: %v", assigned["a"])
+	}
+}
@@ -3,7 +3,6 @@ package valkey
 import (
 	"context"
 	"fmt"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -12,7 +11,174 @@ import (
 	valkeygo "github.com/valkey-io/valkey-go"
 )
 
-func GetClusterInfo(client valkeygo.Client) (string, error) {
+// https://valkey.io/commands/cluster-info/
+type ClusterInfo struct {
+	State         string // ok or fail
+	SlotsAssigned int
+	SlotsOK       int
+	SlotsPfail    int
+	SlotsFail     int
+	KnownNodes    int
+	Size          int // masters serving at least one slot
+	CurrentEpoch  int64
+	MyEpoch       int64
+}
+
+const ClusterStateOK = "ok"
+
+// https://valkey.io/commands/info/ (the replication section)
+type ReplicationInfo struct {
+	Role             string // RoleMaster or RoleReplica
+	MasterHost       string // replicas only
+	MasterPort       int    // replicas only
+	MasterLinkUp     bool   // replicas only
+	MasterReplOffset int64
+	ReplicaOffset    int64         // slave_repl_offset. replicas only
+	Replicas         []ReplicaInfo // connected replicas. masters only
+}
+
+const (
+	RoleMaster  = "master"
+	RoleReplica = "slave"
+)
+
+// one slave<n> line of a master's INFO replication
+type ReplicaInfo struct {
+	IP     string
+	Port   int
+	State  string // online, wait_bgsave, send_bulk...
+	Offset int64
+	Lag    int64 // seconds since the replica last acknowledged
+}
+
+// Offset is how far along the replication stream the node is: slave_repl_offset of a replica and
+// master_repl_offset of a master
+func (r ReplicationInfo) Offset() int64 {
+	if r.Role == RoleReplica {
+		return r.ReplicaOffset
+	}
+	return r.MasterReplOffset
+}
+
+// key:value lines of INFO style output. section headers (# Replication) and blank lines are skipped
+func parseInfoFields(info string) map[string]string {
+	fields := map[string]string{}
+	for line := range strings.Lines(info) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, found := strings.Cut(line, ":"); found {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// infoFields turns the fields of INFO style output into typed values. the first error sticks
+type infoFields struct {
+	fields map[string]string
+	err    error
+}
+
+func (f *infoFields) int64(key string) int64 {
+	value, exists := f.fields[key]
+	if !exists {
+		f.fail(fmt.Errorf("missing %s", key))
+		return 0
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		f.fail(fmt.Errorf("invalid %s %q: %w", key, value, err))
+	}
+	return parsed
+}
+
+func (f *infoFields) int(key string) int {
+	return int(f.int64(key))
+}
+
+func (f *infoFields) string(key string) string {
+	value, exists := f.fields[key]
+	if !exists {
+		f.fail(fmt.Errorf("missing %s", key))
+	}
+	return value
+}
+
+func (f *infoFields) fail(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+func ParseClusterInfo(info string) (ClusterInfo, error) {
+	fields := infoFields{fields: parseInfoFields(info)}
+	clusterInfo := ClusterInfo{
+		State:         fields.string("cluster_state"),
+		SlotsAssigned: fields.int("cluster_slots_assigned"),
+		SlotsOK:       fields.int("cluster_slots_ok"),
+		SlotsPfail:    fields.int("cluster_slots_pfail"),
+		SlotsFail:     fields.int("cluster_slots_fail"),
+		KnownNodes:    fields.int("cluster_known_nodes"),
+		Size:          fields.int("cluster_size"),
+		CurrentEpoch:  fields.int64("cluster_current_epoch"),
+		MyEpoch:       fields.int64("cluster_my_epoch"),
+	}
+	if fields.err != nil {
+		return ClusterInfo{}, fmt.Errorf("parse cluster info: %w", fields.err)
+	}
+	return clusterInfo, nil
+}
+
+func ParseReplicationInfo(info string) (ReplicationInfo, error) {
+	fields := infoFields{fields: parseInfoFields(info)}
+	replication := ReplicationInfo{
+		Role:             fields.string("role"),
+		MasterReplOffset: fields.int64("master_repl_offset"),
+	}
+	switch replication.Role {
+	case RoleMaster:
+		for i := range fields.int("connected_slaves") {
+			replica, err := parseReplicaInfo(fields.string(fmt.Sprintf("slave%d", i)))
+			if err != nil {
+				fields.fail(fmt.Errorf("invalid slave%d: %w", i, err))
+			}
+			replication.Replicas = append(replication.Replicas, replica)
+		}
+	case RoleReplica:
+		replication.MasterHost = fields.string("master_host")
+		replication.MasterPort = fields.int("master_port")
+		replication.MasterLinkUp = fields.string("master_link_status") == "up"
+		replication.ReplicaOffset = fields.int64("slave_repl_offset")
+	default:
+		fields.fail(fmt.Errorf("unknown role %q", replication.Role))
+	}
+	if fields.err != nil {
+		return ReplicationInfo{}, fmt.Errorf("parse replication info: %w", fields.err)
+	}
+	return replication, nil
+}
+
+// ip=10.0.0.2,port=6379,state=online,offset=1200,lag=0
+func parseReplicaInfo(value string) (ReplicaInfo, error) {
+	fields := infoFields{fields: map[string]string{}}
+	for pair := range strings.SplitSeq(value, ",") {
+		if key, value, found := strings.Cut(pair, "="); found {
+			fields.fields[key] = value
+		}
+	}
+	replica := ReplicaInfo{
+		IP:     fields.string("ip"),
+		Port:   fields.int("port"),
+		State:  fields.string("state"),
+		Offset: fields.int64("offset"),
+		Lag:    fields.int64("lag"),
+	}
+	return replica, fields.err
+}
+
+func GetClusterInfo(client valkeygo.Client) (ClusterInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	infoCmd := client.B().ClusterInfo().Build()
 	infoResponse := client.Do(ctx, infoCmd)
@@ -20,9 +186,17 @@ func GetClusterInfo(client valkeygo.Client) (string, error) {
 
 	info, err := infoResponse.ToString()
 	if err != nil {
-		return "", err
+		return ClusterInfo{}, err
 	}
-	return info, nil
+	return ParseClusterInfo(info)
+}
+
+func GetReplicationInfo(ctx context.Context, client valkeygo.Client) (ReplicationInfo, error) {
+	info, err := client.Do(ctx, client.B().Info().Section("replication").Build()).ToString()
+	if err != nil {
+		return ReplicationInfo{}, err
+	}
+	return ParseReplicationInfo(info)
 }
 
 func GetClusterNodes(client valkeygo.Client) (string, error) {
@@ -44,47 +218,22 @@ func GetClusterNodes(client valkeygo.Client) (string, error) {
 	return cleansedOutput, nil
 }
 
-// includes port in hostnames
-func GetClusterConnectionInfo(serviceName string, env utils.Env) (orderedClusterHostnames []string, err error) {
-	_, hostnames, err := utils.GetAllServicePods(serviceName)
-	if err != nil {
-		return nil, err
-	}
-
-	clientHostnames, err := filterClientHostnames(hostnames)
+// GetClusterConnectionInfo returns the client address (with port) of every ready pod that is part of a
+// cluster, in pod index order. a ready pod that can't be connected to or asked for CLUSTER INFO is an
+// error so an unreachable cluster isn't mistaken for one that was never initialized
+func GetClusterConnectionInfo(ctx context.Context, env utils.Env) (orderedClusterHostnames []string, err error) {
+	clientHostnames, err := GetPodAddresses(ctx, env)
 	if err != nil {
 		return nil, err
 	}
 
-	sort.Slice(clientHostnames, func(i, j int) bool {
-		hostnameI, hostnameJ := clientHostnames[i], clientHostnames[j]
-		lastColonIIndex, lastColonJIndex := strings.LastIndex(hostnameI, ":"), strings.LastIndex(hostnameJ, ":")
-		hostI, hostJ := hostnameI[:lastColonIIndex], hostnameJ[:lastColonJIndex]
-		podnameI, podnameJ := strings.Split(hostI, ".")[0], strings.Split(hostJ, ".")[0]
-		partsI, partsJ := strings.Split(podnameI, "-"), strings.Split(podnameJ, "-")
-		indexI, _ := strconv.Atoi(partsI[len(partsI)-1])
-		indexJ, _ := strconv.Atoi(partsJ[len(partsJ)-1])
-		return indexI < indexJ
-	})
-
-	orderedClusterHostnames = make([]string, 0, len(hostnames)/2) // NOTE: hostnames treats busport and client port as different so there are 2x the node amount
+	orderedClusterHostnames = make([]string, 0, len(clientHostnames))
 	for _, hostname := range clientHostnames {
-		nodeClient, err := NewClient(valkeygo.ClientOption{
-			InitAddress:       []string{hostname},
-			Username:          AdminUser,
-			Password:          env.AdminPassword,
-			ForceSingleClient: true,
-		})
+		clusterSize, err := getClusterSize(env, hostname)
 		if err != nil {
-			continue
+			return nil, err
 		}
-
-		clusterInfo, err := GetClusterInfo(nodeClient)
-		if err != nil {
-			continue
-		}
-		nodeClient.Close()
-		if strings.Contains(clusterInfo, "cluster_size:0") {
+		if clusterSize == 0 {
 			continue
 		}
 
@@ -94,261 +243,79 @@ func GetClusterConnectionInfo(serviceName string, env utils.Env) (orderedCluster
 	return orderedClusterHostnames, nil
 }
 
-func WaitForClusterInfoState(ctx context.Context, client *ValkeyClient, state string) error {
-	fmt.Println()
-	fmt.Println("Waiting for cluster to update info...")
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		if err := client.Refresh(); err != nil {
-			fmt.Printf("refresh client failed, retrying: %v\n", err)
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(2 * time.Second):
-			}
-			continue
-		}
-
-		clusterInfo, err := GetClusterInfo(client)
-		if err != nil {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(2 * time.Second):
-			}
-			continue
-		}
-		if strings.Contains(clusterInfo, state) {
-			break
-		}
-
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(2 * time.Second):
-		}
-	}
-
-	fmt.Println("✓ Cluster updated info")
-	fmt.Println()
-
-	return nil
-}
-
-func WaitForAllNodesClusterInfoState(ctx context.Context, env utils.Env, hostnames []string, state string) error {
-	fmt.Println("Waiting for cluster state in the cluster to be consistent across all nodes...")
-	fmt.Println("Pods to check:")
-	fmt.Println(hostnames)
-	fmt.Println("State to check:")
-	fmt.Println(state)
-
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	semaphore := make(chan struct{}, 10)
-	errChan := make(chan error, len(hostnames))
-	for _, hostname := range hostnames {
-		semaphore <- struct{}{}
-
-		fmt.Printf("Checking state for %s...\n", hostname)
-		go func(hostname string) {
-			defer func() { <-semaphore }()
-
-			nodeClient, err := NewClient(valkeygo.ClientOption{
-				InitAddress:       []string{hostname},
-				Username:          AdminUser,
-				Password:          env.AdminPassword,
-				ForceSingleClient: true,
-			})
-			if err != nil {
-				errChan <- err
-				return
-			}
-			defer nodeClient.Close()
-
-			if err = WaitForClusterInfoState(ctx, nodeClient, state); err != nil {
-				errChan <- err
-				return
-			}
-
-			fmt.Printf("✓ %s correct\n", hostname)
-			errChan <- nil
-		}(hostname)
-	}
-
-	for range hostnames {
-		if err := <-errChan; err != nil {
-			cancel()
-			return err
-		}
+// CheckUninitialized makes sure no pod is part of a cluster yet. every discovered pod has to be ready and
+// answer with cluster_size:0, a pod that can't be asked could still hold slots
+func CheckUninitialized(ctx context.Context, env utils.Env) error {
+	pods, err := utils.DiscoverPods(ctx, env)
+	if err != nil {
+		return err
 	}
-
-	fmt.Println()
-	fmt.Println("✓ All nodes are consistent and are in the desired cluster info state")
-	fmt.Println()
-
-	return nil
+	return checkUninitialized(pods, func(address string) (int, error) { return getClusterSize(env, address) })
 }
 
-// nodeIds is a list of lists of node ids. ids in the same list are "or" matched while ids in different lists are "and" matched
-func WaitForClusterNodeContains(ctx context.Context, client *ValkeyClient, matchingStrings ...[]string) error {
-	fmt.Println("Waiting for matching strings in the cluster...")
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		if err := client.Refresh(); err != nil {
-			fmt.Printf("refresh client failed, retrying: %v\n", err)
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(2 * time.Second):
-			}
-			continue
+func checkUninitialized(pods []utils.Pod, clusterSize func(address string) (int, error)) error {
+	for _, pod := range pods {
+		if !pod.Ready {
+			return fmt.Errorf("pod %s isn't ready so it can't be checked for cluster membership", pod.Name)
 		}
-		clusterNodes, err := GetClusterNodes(client)
+		size, err := clusterSize(pod.Address)
 		if err != nil {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(2 * time.Second):
-			}
-			continue
-		}
-
-		failed := false
-		for _, nodeIdList := range matchingStrings {
-			exists := false
-			for _, nodeId := range nodeIdList {
-				if strings.Contains(clusterNodes, nodeId) {
-					exists = true
-					break
-				}
-			}
-			if !exists {
-				failed = true
-				break
-			}
-		}
-		if !failed {
-			break
+			return err
 		}
-
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(2 * time.Second):
+		if size != 0 {
+			return fmt.Errorf("pod %s is already part of a cluster (cluster_size:%d)", pod.Name, size)
 		}
 	}
-
-	fmt.Println("✓ Node has matching strings")
-	fmt.Println()
-
 	return nil
 }
 
-// each node in the cluster needs to update its info via the bus. this function waits for all nodes to
-// contain the matching strings using WaitForEntireClusterConsistencyClusterNodeContains(). a node may
-// not have the same data as the rest of the cluster. this causes bugs when using a cluster client
-// because it will send the request to a random node that might not have the proper data. this function
-// will wait for all nodes to have the same data.
-//
-// NOTE: hostnames need port number
-func WaitForAllNodesClusterNodeContains(ctx context.Context, env utils.Env, hostnames []string, matchingStrings ...[]string) error {
-	fmt.Println("Waiting for matching strings in the cluster across all given nodes...")
-	fmt.Println("Pods to check:")
-	fmt.Println(hostnames)
-	fmt.Println("Matching strings:")
-	for _, matchingStringList := range matchingStrings {
-		fmt.Printf("  %s\n", matchingStringList)
-	}
-
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	semaphore := make(chan struct{}, 10)
-	errChan := make(chan error, len(hostnames))
-	for _, hostname := range hostnames {
-		semaphore <- struct{}{}
-
-		fmt.Printf("Matching %s...\n", hostname)
-		go func(hostname string) {
-			defer func() { <-semaphore }()
-
-			nodeClient, err := NewClient(valkeygo.ClientOption{
-				InitAddress:       []string{hostname},
-				Username:          AdminUser,
-				Password:          env.AdminPassword,
-				ForceSingleClient: true,
-			})
-			if err != nil {
-				errChan <- err
-				return
-			}
-			defer nodeClient.Close()
-
-			if err = WaitForClusterNodeContains(ctx, nodeClient, matchingStrings...); err != nil {
-				errChan <- err
-				return
-			}
-
-			fmt.Printf("✓ %s correct\n", hostname)
-			errChan <- nil
-		}(hostname)
+func getClusterSize(env utils.Env, address string) (int, error) {
+	nodeClient, err := NewNodeClient(ReconcilerAuth(env), address)
+	if err != nil {
+		return 0, fmt.Errorf("connect to %s: %w", address, err)
 	}
+	defer nodeClient.Close()
 
-	for range hostnames {
-		if err := <-errChan; err != nil {
-			cancel()
-			return err
-		}
+	clusterInfo, err := GetClusterInfo(nodeClient)
+	if err != nil {
+		return 0, fmt.Errorf("get cluster info of %s: %w", address, err)
 	}
-
-	fmt.Println()
-	fmt.Println("✓ All nodes have matching strings and are consistent")
-	fmt.Println()
-
-	return nil
+	return clusterInfo.Size, nil
 }
 
-func WaitForEntireClusterConsistencyClusterNodeContains(ctx context.Context, env utils.Env, matchingStrings ...[]string) error {
-	_, hostnames, err := utils.GetAllServicePods(utils.GetHeadlessServiceFQDN(env.ClusterName, env.Namespace))
+// GetPodAddresses returns the client address (with port) of every discovered pod that is ready to serve,
+// in pod index order, whether or not it has joined the cluster
+func GetPodAddresses(ctx context.Context, env utils.Env) ([]string, error) {
+	pods, err := utils.DiscoverPods(ctx, env)
 	if err != nil {
-		return err
-	}
-	clientHostnames, err := filterClientHostnames(hostnames)
-	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return WaitForAllNodesClusterNodeContains(ctx, env, clientHostnames, matchingStrings...)
+	addresses := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Ready {
+			addresses = append(addresses, pod.Address)
+		}
+	}
+	return addresses, nil
 }
 
-func filterClientHostnames(hostnames []string) (filteredHostnames []string, err error) {
-	filteredHostnames = make([]string, 0, len(hostnames))
-	for _, hostnames := range hostnames {
-		lastColonIndex := strings.LastIndex(hostnames, ":")
-		if lastColonIndex == -1 {
-			return nil, fmt.Errorf("invalid hostname: %s", hostnames)
-		}
+// ClusterInfoPredicate is what WaitForClusterInfo waits for. the name is only used in logs
+type ClusterInfoPredicate struct {
+	Name  string
+	Match func(ClusterInfo) bool
+}
 
-		port := hostnames[lastColonIndex+1:]
-		if port != "6379" {
-			continue
-		}
+// ClusterStateIsOK matches once the node serves every slot (cluster_state:ok)
+var ClusterStateIsOK = ClusterInfoPredicate{
+	Name:  "cluster_state:ok",
+	Match: func(info ClusterInfo) bool { return info.State == ClusterStateOK },
+}
 
-		filteredHostnames = append(filteredHostnames, hostnames)
+// KnownNodesAre matches once the node knows about exactly count nodes (itself included)
+func KnownNodesAre(count int) ClusterInfoPredicate {
+	return ClusterInfoPredicate{
+		Name:  fmt.Sprintf("cluster_known_nodes:%d", count),
+		Match: func(info ClusterInfo) bool { return info.KnownNodes == count },
 	}
-
-	return filteredHostnames, nil
 }
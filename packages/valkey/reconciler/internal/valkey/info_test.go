@@ -0,0 +1,217 @@
+package valkey
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"valkey/reconciler/internal/utils"
+)
+
+type stubDiscovery []utils.Pod
+
+func (d stubDiscovery) Pods(context.Context, utils.Env) ([]utils.Pod, error) {
+	return d, nil
+}
+
+func TestGetPodAddressesSkipsNotReady(t *testing.T) {
+	env := utils.Env{Discovery: stubDiscovery{
+		{Index: 2, Address: "pod-2:6379", Ready: true},
+		{Index: 1, Address: "pod-1:6379"},
+		{Index: 0, Address: "pod-0:6379", Ready: true},
+	}}
+	addresses, err := GetPodAddresses(context.Background(), env)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"pod-0:6379", "pod-2:6379"}; !slices.Equal(addresses, want) {
+		t.Errorf("GetPodAddresses() = %v, want %v", addresses, want)
+	}
+}
+
+func TestCheckUninitialized(t *testing.T) {
+	sizes := map[string]int{"pod-0:6379": 0, "pod-1:6379": 0, "pod-2:6379": 3}
+	clusterSize := func(address string) (int, error) {
+		size, exists := sizes[address]
+		if !exists {
+			return 0, errors.New("WRONGPASS invalid username-password pair")
+		}
+		return size, nil
+	}
+
+	tests := []struct {
+		name    string
+		pods    []utils.Pod
+		wantErr bool
+	}{
+		{name: "every pod is empty", pods: []utils.Pod{{Name: "pod-0", Address: "pod-0:6379", Ready: true}, {Name: "pod-1", Address: "pod-1:6379", Ready: true}}},
+		{name: "no pods", pods: nil},
+		{name: "a pod is in a cluster", pods: []utils.Pod{{Name: "pod-0", Address: "pod-0:6379", Ready: true}, {Name: "pod-2", Address: "pod-2:6379", Ready: true}}, wantErr: true},
+		// a rolling restart could be hiding a node that holds slots
+		{name: "a pod isn't ready", pods: []utils.Pod{{Name: "pod-0", Address: "pod-0:6379", Ready: true}, {Name: "pod-1", Address: "pod-1:6379"}}, wantErr: true},
+		{name: "a pod can't be asked", pods: []utils.Pod{{Name: "pod-3", Address: "pod-3:6379", Ready: true}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := checkUninitialized(test.pods, clusterSize); (err != nil) != test.wantErr {
+				t.Errorf("checkUninitialized() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseClusterInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    string
+		want    ClusterInfo
+		wantErr bool
+	}{
+		{
+			name: "healthy",
+			info: "cluster_enabled:1\r\ncluster_state:ok\r\ncluster_slots_assigned:16384\r\ncluster_slots_ok:16384\r\ncluster_slots_pfail:0\r\ncluster_slots_fail:0\r\ncluster_known_nodes:6\r\ncluster_size:3\r\ncluster_current_epoch:6\r\ncluster_my_epoch:2\r\ncluster_stats_messages_sent:1483\r\n",
+			want: ClusterInfo{
+				State:         ClusterStateOK,
+				SlotsAssigned: 16384,
+				SlotsOK:       16384,
+				KnownNodes:    6,
+				Size:          3,
+				CurrentEpoch:  6,
+				MyEpoch:       2,
+			},
+		},
+		{
+			name: "empty node",
+			info: "cluster_state:fail\r\ncluster_slots_assigned:0\r\ncluster_slots_ok:0\r\ncluster_slots_pfail:0\r\ncluster_slots_fail:0\r\ncluster_known_nodes:1\r\ncluster_size:0\r\ncluster_current_epoch:0\r\ncluster_my_epoch:0\r\n",
+			want: ClusterInfo{State: "fail", KnownNodes: 1},
+		},
+		{
+			name:    "missing field",
+			info:    "cluster_state:ok\r\ncluster_slots_assigned:16384\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid number",
+			info:    "cluster_state:ok\r\ncluster_slots_assigned:all\r\ncluster_slots_ok:16384\r\ncluster_slots_pfail:0\r\ncluster_slots_fail:0\r\ncluster_known_nodes:6\r\ncluster_size:3\r\ncluster_current_epoch:6\r\ncluster_my_epoch:2\r\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseClusterInfo(test.info)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("ParseClusterInfo() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseReplicationInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		info       string
+		want       ReplicationInfo
+		wantOffset int64
+		wantErr    bool
+	}{
+		{
+			name: "master",
+			info: "# Replication\r\nrole:master\r\nconnected_slaves:2\r\nslave0:ip=10.0.0.2,port=6379,state=online,offset=1200,lag=0\r\nslave1:ip=10.0.0.3,port=6379,state=wait_bgsave,offset=0,lag=1\r\nmaster_failover_state:no-failover\r\nmaster_repl_offset:1234\r\n",
+			want: ReplicationInfo{
+				Role:             RoleMaster,
+				MasterReplOffset: 1234,
+				Replicas: []ReplicaInfo{
+					{IP: "10.0.0.2", Port: 6379, State: "online", Offset: 1200},
+					{IP: "10.0.0.3", Port: 6379, State: "wait_bgsave", Lag: 1},
+				},
+			},
+			wantOffset: 1234,
+		},
+		{
+			name: "replica",
+			info: "# Replication\r\nrole:slave\r\nmaster_host:valkey-test-0.valkey-test-headless.default.svc.cluster.local\r\nmaster_port:6379\r\nmaster_link_status:up\r\nslave_repl_offset:1200\r\nconnected_slaves:0\r\nmaster_repl_offset:1200\r\n",
+			want: ReplicationInfo{
+				Role:             RoleReplica,
+				MasterHost:       "valkey-test-0.valkey-test-headless.default.svc.cluster.local",
+				MasterPort:       6379,
+				MasterLinkUp:     true,
+				MasterReplOffset: 1200,
+				ReplicaOffset:    1200,
+			},
+			wantOffset: 1200,
+		},
+		{
+			name: "replica with its link down",
+			info: "role:slave\r\nmaster_host:valkey-test-0\r\nmaster_port:6379\r\nmaster_link_status:down\r\nslave_repl_offset:900\r\nmaster_repl_offset:1000\r\n",
+			want: ReplicationInfo{
+				Role:             RoleReplica,
+				MasterHost:       "valkey-test-0",
+				MasterPort:       6379,
+				MasterReplOffset: 1000,
+				ReplicaOffset:    900,
+			},
+			wantOffset: 900,
+		},
+		{
+			name:    "missing offset",
+			info:    "role:master\r\nconnected_slaves:0\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing replica line",
+			info:    "role:master\r\nconnected_slaves:1\r\nmaster_repl_offset:0\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown role",
+			info:    "role:sentinel\r\nmaster_repl_offset:0\r\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseReplicationInfo(test.info)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseReplicationInfo() = %+v, want %+v", got, test.want)
+			}
+			if got.Offset() != test.wantOffset {
+				t.Errorf("Offset() = %d, want %d", got.Offset(), test.wantOffset)
+			}
+		})
+	}
+}
+
+func TestClusterInfoPredicates(t *testing.T) {
+	info := ClusterInfo{State: ClusterStateOK, KnownNodes: 6}
+	if !ClusterStateIsOK.Match(info) || ClusterStateIsOK.Match(ClusterInfo{State: "fail"}) {
+		t.Errorf("ClusterStateIsOK doesn't match on the state")
+	}
+	if !KnownNodesAre(6).Match(info) || KnownNodesAre(5).Match(info) {
+		t.Errorf("KnownNodesAre doesn't match on the known nodes")
+	}
+	if name := KnownNodesAre(6).Name; name != "cluster_known_nodes:6" {
+		t.Errorf("KnownNodesAre(6).Name = %q", name)
+	}
+}
@@ -3,6 +3,7 @@ package valkey
 import (
 	"context"
 	"fmt"
+	"net"
 	"slices"
 	"strconv"
 	"strings"
@@ -38,6 +39,34 @@ type SlotRange struct {
 	EndSlot   uint16
 }
 
+// String formats the range the way CLUSTER NODES does: 0-5460 or 5461 for a single slot
+func (r SlotRange) String() string {
+	if r.StartSlot == r.EndSlot {
+		return strconv.Itoa(int(r.StartSlot))
+	}
+	return fmt.Sprintf("%d-%d", r.StartSlot, r.EndSlot)
+}
+
+// MarshalText keeps the CLUSTER NODES format in json (ie. plan steps)
+func (r SlotRange) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *SlotRange) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		return fmt.Errorf("empty slot range")
+	}
+	slotRanges, importing, migrating, err := parseSlots(string(text))
+	if err != nil {
+		return err
+	}
+	if len(slotRanges) != 1 || len(importing)+len(migrating) > 0 || slotRanges[0].StartSlot > slotRanges[0].EndSlot || slotRanges[0].EndSlot >= TotalSlots {
+		return fmt.Errorf("invalid slot range: %s", text)
+	}
+	*r = slotRanges[0]
+	return nil
+}
+
 // going in
 type ImportingSlot struct {
 	Slot            uint16
@@ -70,10 +99,15 @@ type ClusterNode struct {
 
 // Gets the statefulset index of the node
 func (n ClusterNode) Index() int {
-	if n.Hostname == "" {
+	return HostnameIndex(n.Hostname)
+}
+
+// HostnameIndex gets the statefulset index of the pod from its hostname. -1 when it isn't a pod hostname
+func HostnameIndex(hostname string) int {
+	if hostname == "" {
 		return -1
 	}
-	hostnameParts := strings.Split(n.Hostname, ".")
+	hostnameParts := strings.Split(hostname, ".")
 	statefulsetParts := strings.Split(hostnameParts[0], "-")
 	index, err := strconv.Atoi(statefulsetParts[len(statefulsetParts)-1])
 	if err != nil {
@@ -82,6 +116,15 @@ func (n ClusterNode) Index() int {
 	return index
 }
 
+// hostname:port used to connect to the node. falls back to the ip when the node doesn't announce a hostname
+func (n ClusterNode) Address() string {
+	host := n.Hostname
+	if host == "" {
+		host = n.IP
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(n.Port)))
+}
+
 func ClusterNodes(client valkey.Client) ([]ClusterNode, error) {
 	clusterNodes, err := GetClusterNodes(client)
 	if err != nil {
@@ -157,7 +200,8 @@ func ClusterNodes(client valkey.Client) ([]ClusterNode, error) {
 	return nodes, nil
 }
 
-// ip:port@cport[,hostname]
+// ip:port@cport[,hostname[,aux=value...]]. port is the tls-port when CLUSTER NODES was asked over a tls
+// connection to a node with tls-cluster on
 func addressParts(address string) (string, uint16, uint16, string, error) {
 	lastColonIndex := strings.LastIndex(address, ":")
 	if lastColonIndex == -1 {
@@ -169,7 +213,7 @@ func addressParts(address string) (string, uint16, uint16, string, error) {
 	commaIndex := strings.Index(remainingAddress, ",")
 	hostname := ""
 	if commaIndex != -1 {
-		hostname = remainingAddress[commaIndex+1:]
+		hostname, _, _ = strings.Cut(remainingAddress[commaIndex+1:], ",")
 		remainingAddress = remainingAddress[:commaIndex]
 	}
 	ports := strings.Split(remainingAddress, "@")
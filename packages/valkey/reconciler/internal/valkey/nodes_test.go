@@ -1,6 +1,8 @@
 package valkey
 
 import (
+	"encoding/json"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -86,6 +88,15 @@ func TestAddressParts(t *testing.T) {
 			wantHost:   "valkey-0.valkey.default.svc.cluster.local",
 			wantErr:    false,
 		},
+		{
+			name:       "tls port with aux fields",
+			address:    "10.0.0.1:6380@16379,valkey-0.valkey.default.svc.cluster.local,shard-id=4f1d,tls-port=6380,tcp-port=0",
+			wantIP:     "10.0.0.1",
+			wantClient: 6380,
+			wantBus:    16379,
+			wantHost:   "valkey-0.valkey.default.svc.cluster.local",
+			wantErr:    false,
+		},
 		{
 			name:       "valid IPv4 without hostname",
 			address:    "192.168.1.100:6379@16379",
@@ -441,3 +452,28 @@ func TestParseSlots(t *testing.T) {
 		})
 	}
 }
+
+func TestSlotRangeText(t *testing.T) {
+	ranges := []SlotRange{{StartSlot: 0, EndSlot: 5460}, {StartSlot: 42, EndSlot: 42}}
+	data, err := json.Marshal(ranges)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != `["0-5460","42"]` {
+		t.Errorf("json.Marshal() = %s, want the CLUSTER NODES format", data)
+	}
+
+	var got []SlotRange
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, ranges) {
+		t.Errorf("json.Unmarshal() = %+v, want %+v", got, ranges)
+	}
+
+	for _, invalid := range []string{`[""]`, `["10-5"]`, `["[10->-node]"]`, `["1-2 3-4"]`} {
+		if err := json.Unmarshal([]byte(invalid), &got); err == nil {
+			t.Errorf("json.Unmarshal(%s) succeeded, want an error", invalid)
+		}
+	}
+}
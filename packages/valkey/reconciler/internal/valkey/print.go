@@ -1,28 +1,86 @@
 package valkey
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
+	"strings"
+	"valkey/reconciler/internal/logging"
 
 	valkeygo "github.com/valkey-io/valkey-go"
 )
 
-func PrintClusterInfo(client valkeygo.Client) {
-	fmt.Println("Cluster information:")
+// LogClusterInfo logs the CLUSTER INFO fields of the node the client is connected to at debug level
+func LogClusterInfo(ctx context.Context, client valkeygo.Client) {
+	logger := logging.FromContext(ctx)
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
 	info, err := GetClusterInfo(client)
 	if err != nil {
-		fmt.Printf("ERROR: %s\n", err)
+		logger.Warn("Failed to get cluster info", "error", err)
 		return
 	}
-	fmt.Println(info)
+
+	logger.Debug("Cluster info", "cluster_info", info)
 }
 
-func PrintClusterNodes(client valkeygo.Client) {
-	fmt.Println("Cluster nodes:")
+func (i ClusterInfo) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("state", i.State),
+		slog.Int("slots_assigned", i.SlotsAssigned),
+		slog.Int("slots_ok", i.SlotsOK),
+		slog.Int("slots_pfail", i.SlotsPfail),
+		slog.Int("slots_fail", i.SlotsFail),
+		slog.Int("known_nodes", i.KnownNodes),
+		slog.Int("size", i.Size),
+		slog.Int64("current_epoch", i.CurrentEpoch),
+		slog.Int64("my_epoch", i.MyEpoch),
+	)
+}
+
+// LogClusterNodes logs every node the client knows about at debug level
+func LogClusterNodes(ctx context.Context, client valkeygo.Client) {
+	logger := logging.FromContext(ctx)
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
 
-	clusterNodes, err := GetClusterNodes(client)
+	nodes, err := ClusterNodes(client)
 	if err != nil {
-		fmt.Printf("ERROR: %s\n", err)
+		logger.Warn("Failed to get cluster nodes", "error", err)
 		return
 	}
-	fmt.Println(clusterNodes)
+	for _, node := range nodes {
+		logger.Debug("Cluster node", "node", node)
+	}
+}
+
+func (n ClusterNode) LogValue() slog.Value {
+	role, master := "master", ""
+	if n.Master != "" {
+		role, master = "replica", n.Master
+	}
+	flags := make([]string, len(n.Flags))
+	for i, flag := range n.Flags {
+		flags[i] = string(flag)
+	}
+	return slog.GroupValue(
+		slog.String("node_id", n.ID),
+		slog.String("hostname", n.Hostname),
+		slog.String("address", n.Address()),
+		slog.String("role", role),
+		slog.String("master_id", master),
+		slog.String("flags", strings.Join(flags, ",")),
+		slog.String("link_state", string(n.LinkState)),
+		slog.Int("slots", slotCount(n.Slots)),
+	)
+}
+
+func slotCount(slotRanges []SlotRange) int {
+	count := 0
+	for _, slotRange := range slotRanges {
+		count += int(slotRange.EndSlot) - int(slotRange.StartSlot) + 1
+	}
+	return count
 }
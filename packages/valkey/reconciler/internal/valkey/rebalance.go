@@ -0,0 +1,631 @@
+package valkey
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/metrics"
+)
+
+const (
+	defaultRebalanceThreshold = 2.0
+	defaultMigrateTimeoutMS   = 60000
+	defaultMigratePipeline    = 10
+)
+
+type RebalanceOptions struct {
+	CliBaseOptions
+
+	// Rebalance behavior
+	Threshold       *float64           // Percent deviation from ideal number of slots; default: 2.0% WARNING: never use 0 or else it will skip the rebalance
+	UseEmptyMasters bool               // Allow empty masters to take on slots; default: false
+	Weights         map[string]float64 // nodeID -> weight; Ratio of slots to assign to each node (0 drains all slots from master); default 1 per node
+
+	// Execution behavior
+	TimeoutMS *int // default 60000 (1 minute)
+	Pipeline  *int // Keys per MIGRATE call; default 10
+	Replace   bool // Overwrite keys on collision; default false
+
+	Progress func(SlotMigration) // called after every slot is migrated; default logs the migration
+}
+
+func (o RebalanceOptions) threshold() float64 {
+	if o.Threshold == nil {
+		return defaultRebalanceThreshold
+	}
+	return *o.Threshold
+}
+
+func (o RebalanceOptions) timeoutMS() int {
+	if o.TimeoutMS == nil {
+		return defaultMigrateTimeoutMS
+	}
+	return *o.TimeoutMS
+}
+
+func (o RebalanceOptions) pipeline() int {
+	if o.Pipeline == nil {
+		return defaultMigratePipeline
+	}
+	return *o.Pipeline
+}
+
+func (o RebalanceOptions) validate() error {
+	if err := o.ValidateConnection(); err != nil {
+		return err
+	}
+	if err := o.ValidateAuth(); err != nil {
+		return err
+	}
+	if o.Threshold != nil && *o.Threshold < 0 {
+		return fmt.Errorf("threshold must be >= 0")
+	}
+	if o.TimeoutMS != nil && *o.TimeoutMS <= 0 {
+		return fmt.Errorf("timeout must be > 0")
+	}
+	if o.Pipeline != nil && *o.Pipeline <= 0 {
+		return fmt.Errorf("pipeline must be > 0")
+	}
+	for nodeID, weight := range o.Weights {
+		if weight < 0 {
+			return fmt.Errorf("weight for node %s must be >= 0", nodeID)
+		}
+	}
+	return nil
+}
+
+type SlotMove struct {
+	Slot     uint16
+	SourceID string
+	TargetID string
+}
+
+// SlotTransfer is a batch of slots moving from one master to another
+type SlotTransfer struct {
+	SourceID string
+	TargetID string
+	Slots    []SlotRange
+}
+
+func (t SlotTransfer) SlotCount() int {
+	return slotCount(t.Slots)
+}
+
+// GroupSlotMoves batches runs of moves between the same two masters, in the order they are migrated
+func GroupSlotMoves(moves []SlotMove) []SlotTransfer {
+	var transfers []SlotTransfer
+	for start := 0; start < len(moves); {
+		end := start + 1
+		for end < len(moves) && moves[end].SourceID == moves[start].SourceID && moves[end].TargetID == moves[start].TargetID {
+			end++
+		}
+
+		slots := make([]uint16, 0, end-start)
+		for _, move := range moves[start:end] {
+			slots = append(slots, move.Slot)
+		}
+		slices.Sort(slots)
+		transfers = append(transfers, SlotTransfer{SourceID: moves[start].SourceID, TargetID: moves[start].TargetID, Slots: compressSlots(slots)})
+		start = end
+	}
+	return transfers
+}
+
+type SlotMigration struct {
+	SlotMove
+	Keys      int // keys moved for this slot
+	Completed int // slots migrated so far including this one
+	Total     int
+}
+
+// PlanRebalance works out which slots need to move between masters to match their weights. it follows
+// the same algorithm as `valkey-cli --cluster rebalance` so the options mean the same thing: every
+// master is expected to own TotalSlots * weight / total weight slots, nothing is moved unless a master
+// deviates from that by more than the threshold percentage and slots are taken from the start of the
+// most overloaded masters and given to the most underloaded ones.
+//
+// NOTE: only pass in masters
+func PlanRebalance(masters []ClusterNode, options RebalanceOptions) []SlotMove {
+	type balancedNode struct {
+		node    ClusterNode
+		slots   []uint16
+		balance int
+	}
+
+	threshold := options.threshold()
+	totalWeight := 0.0
+	involved := make([]*balancedNode, 0, len(masters))
+	for _, master := range masters {
+		slots := expandSlotRanges(master.Slots)
+		if !options.UseEmptyMasters && len(slots) == 0 {
+			continue
+		}
+		totalWeight += nodeWeight(options.Weights, master.ID)
+		involved = append(involved, &balancedNode{node: master, slots: slots})
+	}
+	if totalWeight == 0 {
+		return nil
+	}
+
+	thresholdReached := false
+	totalBalance := 0
+	for _, node := range involved {
+		weight := nodeWeight(options.Weights, node.node.ID)
+		expected := int(math.Floor(float64(TotalSlots) / totalWeight * weight))
+		node.balance = len(node.slots) - expected
+		totalBalance += node.balance
+
+		// NOTE: a threshold of 0 disables the check which means nothing is ever moved (same as valkey-cli).
+		// an empty master only counts when it should own more than a slot so a drained one (weight 0) is
+		// already balanced
+		if threshold > 0 {
+			if len(node.slots) > 0 {
+				if math.Abs(100-100*float64(expected)/float64(len(node.slots))) > threshold {
+					thresholdReached = true
+				}
+			} else if expected > 1 {
+				thresholdReached = true
+			}
+		}
+	}
+	if !thresholdReached {
+		return nil
+	}
+
+	// rounding down the expected slots leaves some slots unaccounted for. give them to the nodes that
+	// aren't over their share so the balances sum to 0. like valkey-cli this includes nodes that are
+	// exactly balanced, otherwise it never ends when no node is under its share. drained nodes (weight 0)
+	// are skipped so they don't get a slot back
+	for totalBalance > 0 {
+		for _, node := range involved {
+			if node.balance <= 0 && totalBalance > 0 && nodeWeight(options.Weights, node.node.ID) > 0 {
+				node.balance--
+				totalBalance--
+			}
+		}
+	}
+
+	sort.SliceStable(involved, func(i, j int) bool {
+		return involved[i].balance < involved[j].balance
+	})
+
+	var moves []SlotMove
+	targetIndex, sourceIndex := 0, len(involved)-1
+	for targetIndex < sourceIndex {
+		target, source := involved[targetIndex], involved[sourceIndex]
+		slotCount := min(-target.balance, source.balance)
+		for _, slot := range source.slots[:slotCount] {
+			moves = append(moves, SlotMove{Slot: slot, SourceID: source.node.ID, TargetID: target.node.ID})
+		}
+		source.slots = source.slots[slotCount:]
+
+		target.balance += slotCount
+		source.balance -= slotCount
+		if target.balance == 0 {
+			targetIndex++
+		}
+		if source.balance == 0 {
+			sourceIndex--
+		}
+	}
+
+	return moves
+}
+
+func nodeWeight(weights map[string]float64, nodeID string) float64 {
+	if weight, exists := weights[nodeID]; exists {
+		return weight
+	}
+	return 1
+}
+
+func expandSlotRanges(slotRanges []SlotRange) []uint16 {
+	var slots []uint16
+	for _, slotRange := range slotRanges {
+		for slot := int(slotRange.StartSlot); slot <= int(slotRange.EndSlot); slot++ {
+			slots = append(slots, uint16(slot))
+		}
+	}
+	return slots
+}
+
+// ApplySlotMoves returns a copy of nodes with the slots reassigned as if the moves already happened
+func ApplySlotMoves(nodes []ClusterNode, moves []SlotMove) []ClusterNode {
+	owners := make(map[uint16]string, TotalSlots)
+	for _, node := range nodes {
+		for _, slot := range expandSlotRanges(node.Slots) {
+			owners[slot] = node.ID
+		}
+	}
+	for _, move := range moves {
+		owners[move.Slot] = move.TargetID
+	}
+
+	movedNodes := make([]ClusterNode, len(nodes))
+	for i, node := range nodes {
+		var slots []uint16
+		for slot, owner := range owners {
+			if owner == node.ID {
+				slots = append(slots, slot)
+			}
+		}
+		slices.Sort(slots)
+		node.Slots = compressSlots(slots)
+		movedNodes[i] = node
+	}
+	return movedNodes
+}
+
+// NOTE: slots need to be sorted
+func compressSlots(slots []uint16) []SlotRange {
+	var slotRanges []SlotRange
+	for _, slot := range slots {
+		if last := len(slotRanges) - 1; last >= 0 && slotRanges[last].EndSlot+1 == slot {
+			slotRanges[last].EndSlot = slot
+			continue
+		}
+		slotRanges = append(slotRanges, SlotRange{StartSlot: slot, EndSlot: slot})
+	}
+	return slotRanges
+}
+
+// OpenSlotMoves finds migrations that were interrupted part way through. CLUSTER NODES only shows
+// importing/migrating slots on the "myself" line so myselfNodes needs every master's view of itself.
+func OpenSlotMoves(myselfNodes []ClusterNode) []SlotMove {
+	moves := make(map[uint16]SlotMove)
+	for _, node := range myselfNodes {
+		for _, migrating := range node.Migrating {
+			moves[migrating.Slot] = SlotMove{Slot: migrating.Slot, SourceID: node.ID, TargetID: migrating.MigratingNodeID}
+		}
+	}
+	for _, node := range myselfNodes {
+		for _, importing := range node.Importing {
+			if _, exists := moves[importing.Slot]; exists {
+				continue
+			}
+			moves[importing.Slot] = SlotMove{Slot: importing.Slot, SourceID: importing.ImportingNodeID, TargetID: node.ID}
+		}
+	}
+
+	openMoves := make([]SlotMove, 0, len(moves))
+	for _, move := range moves {
+		openMoves = append(openMoves, move)
+	}
+	slices.SortFunc(openMoves, func(a, b SlotMove) int {
+		return int(a.Slot) - int(b.Slot)
+	})
+	return openMoves
+}
+
+// Rebalance moves slots between masters with CLUSTER SETSLOT and MIGRATE. migrations that were left
+// open by a previous (interrupted) run are finished first so it's always safe to run again. cancelling
+// ctx stops after the current MIGRATE batch and leaves the slot open to be resumed on the next run.
+func Rebalance(ctx context.Context, options RebalanceOptions) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	masterClients, masters, err := connectToMasters(options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, masterClient := range masterClients {
+			masterClient.Close()
+		}
+	}()
+
+	logger := logging.FromContext(ctx)
+	progress := options.progress(logger)
+
+	masterClients, masters, err = finishOpenSlotMoves(ctx, masterClients, masters, options)
+	if err != nil {
+		return err
+	}
+
+	moves := PlanRebalance(masters, options)
+	if len(moves) == 0 {
+		logger.Info("No rebalancing needed")
+		return nil
+	}
+
+	startTime := time.Now()
+	logger.Info("Moving slots", "slots", len(moves))
+	events.Normal(ctx, events.ReasonRebalanceStarted, "Moving %d slots between %d masters", len(moves), len(masters))
+	if err := migrateSlots(ctx, masterClients, moves, options, progress); err != nil {
+		return err
+	}
+	logger.Info("Slots moved", "slots", len(moves), "duration", time.Since(startTime))
+	events.Normal(ctx, events.ReasonRebalanceFinished, "Moved %d slots in %s", len(moves), time.Since(startTime).Round(time.Second))
+	return nil
+}
+
+// TransferSlots migrates the slots of the transfer. slots the target already owns (ie. moved by a run
+// that was interrupted) are skipped and migrations left open are finished first, so it's safe to run
+// the same transfer again
+func TransferSlots(ctx context.Context, options RebalanceOptions, transfer SlotTransfer) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	masterClients, masters, err := connectToMasters(options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, masterClient := range masterClients {
+			masterClient.Close()
+		}
+	}()
+
+	masterClients, masters, err = finishOpenSlotMoves(ctx, masterClients, masters, options)
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[uint16]string, TotalSlots)
+	for _, master := range masters {
+		for _, slot := range expandSlotRanges(master.Slots) {
+			owners[slot] = master.ID
+		}
+	}
+	var moves []SlotMove
+	for _, slot := range expandSlotRanges(transfer.Slots) {
+		switch owners[slot] {
+		case transfer.TargetID:
+			continue
+		case transfer.SourceID:
+			moves = append(moves, SlotMove{Slot: slot, SourceID: transfer.SourceID, TargetID: transfer.TargetID})
+		default:
+			return fmt.Errorf("slot %d is owned by %q, expected %s or %s", slot, owners[slot], transfer.SourceID, transfer.TargetID)
+		}
+	}
+	if len(moves) == 0 {
+		return nil
+	}
+
+	logger := logging.FromContext(ctx)
+	startTime := time.Now()
+	logger.Info("Moving slots", "slots", len(moves), "source_id", transfer.SourceID, "target_id", transfer.TargetID)
+	if err := migrateSlots(ctx, masterClients, moves, options, options.progress(logger)); err != nil {
+		return err
+	}
+	logger.Info("Slots moved", "slots", len(moves), "duration", time.Since(startTime))
+	events.Normal(ctx, events.ReasonRebalanceFinished, "Moved %d slots from %s to %s in %s",
+		len(moves), transfer.SourceID, transfer.TargetID, time.Since(startTime).Round(time.Second))
+	return nil
+}
+
+// the default progress logs every slot at debug level
+func (o RebalanceOptions) progress(logger *slog.Logger) func(SlotMigration) {
+	if o.Progress != nil {
+		return o.Progress
+	}
+	return func(migration SlotMigration) {
+		logger.Debug("Moved slot",
+			"slot", migration.Slot,
+			"source_id", migration.SourceID,
+			"target_id", migration.TargetID,
+			"keys", migration.Keys,
+			"completed", migration.Completed,
+			"total", migration.Total,
+		)
+	}
+}
+
+// finishes migrations an interrupted run left open and reconnects so masters shows where the slots ended up
+func finishOpenSlotMoves(ctx context.Context, masterClients map[string]*ValkeyClient, masters []ClusterNode, options RebalanceOptions) (map[string]*ValkeyClient, []ClusterNode, error) {
+	openMoves := OpenSlotMoves(masters)
+	if len(openMoves) == 0 {
+		return masterClients, masters, nil
+	}
+
+	logging.FromContext(ctx).Info("Resuming interrupted slot migrations", "slots", len(openMoves))
+	events.Normal(ctx, events.ReasonRebalanceStarted, "Resuming %d interrupted slot migrations", len(openMoves))
+	if err := migrateSlots(ctx, masterClients, openMoves, options, options.progress(logging.FromContext(ctx))); err != nil {
+		return masterClients, masters, err
+	}
+	events.Normal(ctx, events.ReasonRebalanceFinished, "Finished %d interrupted slot migrations", len(openMoves))
+
+	return reconnectToMasters(masterClients, options)
+}
+
+func reconnectToMasters(masterClients map[string]*ValkeyClient, options RebalanceOptions) (map[string]*ValkeyClient, []ClusterNode, error) {
+	for _, masterClient := range masterClients {
+		masterClient.Close()
+	}
+	return connectToMasters(options)
+}
+
+// returns a single node client per master (keyed by node id) along with each master's view of itself
+func connectToMasters(options RebalanceOptions) (_ map[string]*ValkeyClient, _ []ClusterNode, err error) {
+	seedClient, err := NewNodeClient(options.Auth, options.Address())
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := ClusterNodes(seedClient)
+	seedClient.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	masterClients := make(map[string]*ValkeyClient)
+	defer func() {
+		if err != nil {
+			for _, masterClient := range masterClients {
+				masterClient.Close()
+			}
+		}
+	}()
+
+	masters := make([]ClusterNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Master != "" {
+			continue
+		}
+		for _, flag := range node.Flags {
+			if flag == Fail || flag == Pfail {
+				return nil, nil, fmt.Errorf("master %s is in %s state. refusing to move slots", node.ID, flag)
+			}
+		}
+
+		masterClient, err := NewNodeClient(options.Auth, node.Address())
+		if err != nil {
+			return nil, nil, err
+		}
+		masterClients[node.ID] = masterClient
+
+		masterNodes, err := ClusterNodes(masterClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		myself, err := myselfNode(masterNodes)
+		if err != nil {
+			return nil, nil, err
+		}
+		masters = append(masters, myself)
+	}
+
+	return masterClients, masters, nil
+}
+
+func myselfNode(nodes []ClusterNode) (ClusterNode, error) {
+	for _, node := range nodes {
+		if slices.Contains(node.Flags, Myself) {
+			return node, nil
+		}
+	}
+	return ClusterNode{}, fmt.Errorf("myself not found in cluster nodes")
+}
+
+func migrateSlots(ctx context.Context, masterClients map[string]*ValkeyClient, moves []SlotMove, options RebalanceOptions, progress func(SlotMigration)) error {
+	for i, move := range moves {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		keys, err := MigrateSlot(ctx, masterClients, move, options)
+		if err != nil {
+			return fmt.Errorf("migrate slot %d from %s to %s: %w", move.Slot, move.SourceID, move.TargetID, err)
+		}
+		metrics.SlotMigrated()
+		progress(SlotMigration{SlotMove: move, Keys: keys, Completed: i + 1, Total: len(moves)})
+	}
+	return nil
+}
+
+// MigrateSlot moves a single slot and all of its keys from the source to the target master. every step
+// is safe to repeat so an interrupted migration can be resumed by calling it again with the same move.
+//
+// NOTE: masterClients needs a single node client for every master keyed by node id
+func MigrateSlot(ctx context.Context, masterClients map[string]*ValkeyClient, move SlotMove, options RebalanceOptions) (keysMoved int, err error) {
+	sourceClient, exists := masterClients[move.SourceID]
+	if !exists {
+		return 0, fmt.Errorf("source master %s not found", move.SourceID)
+	}
+	targetClient, exists := masterClients[move.TargetID]
+	if !exists {
+		return 0, fmt.Errorf("target master %s not found", move.TargetID)
+	}
+
+	slot := int64(move.Slot)
+
+	importingCmd := targetClient.B().ClusterSetslot().Slot(slot).Importing().NodeId(move.SourceID).Build()
+	err = targetClient.Do(ctx, importingCmd).Error()
+	// the target only becomes the owner after all keys have moved so the previous run got as far as
+	// finalizing the slot on the target
+	targetOwnsSlot := err != nil && strings.Contains(err.Error(), "already the owner")
+	if err != nil && !targetOwnsSlot {
+		return 0, fmt.Errorf("set importing on target: %w", err)
+	}
+
+	if !targetOwnsSlot {
+		migratingCmd := sourceClient.B().ClusterSetslot().Slot(slot).Migrating().NodeId(move.TargetID).Build()
+		if err := sourceClient.Do(ctx, migratingCmd).Error(); err != nil {
+			return 0, fmt.Errorf("set migrating on source: %w", err)
+		}
+
+		keysMoved, err = migrateKeys(ctx, sourceClient, targetClient, move.Slot, options)
+		if err != nil {
+			return keysMoved, err
+		}
+	}
+
+	// the target has to be told first or the source could redirect clients to a node that still
+	// considers itself as importing
+	finalizeOrder := []string{move.TargetID, move.SourceID}
+	for nodeID := range masterClients {
+		if nodeID != move.TargetID && nodeID != move.SourceID {
+			finalizeOrder = append(finalizeOrder, nodeID)
+		}
+	}
+	for i, nodeID := range finalizeOrder {
+		masterClient := masterClients[nodeID]
+		nodeCmd := masterClient.B().ClusterSetslot().Slot(slot).Node().NodeId(move.TargetID).Build()
+		if err := masterClient.Do(ctx, nodeCmd).Error(); err != nil {
+			if i < 2 {
+				return keysMoved, fmt.Errorf("set slot owner on %s: %w", nodeID, err)
+			}
+			// the rest of the masters learn the new owner through the cluster bus anyway
+			logging.FromContext(ctx).Warn("Failed to set slot owner", "slot", slot, "node_id", nodeID, "error", err)
+		}
+	}
+
+	return keysMoved, nil
+}
+
+// migrateKeys MIGRATEs every key in the slot from the source to the target in batches of
+// options.Pipeline keys. the slot has to be migrating/importing or already owned by the target
+func migrateKeys(ctx context.Context, sourceClient, targetClient *ValkeyClient, slot uint16, options RebalanceOptions) (keysMoved int, err error) {
+	targetAddress := targetClient.options.InitAddress[0]
+	lastColonIndex := strings.LastIndex(targetAddress, ":")
+	targetHost, targetPort := targetAddress[:lastColonIndex], targetAddress[lastColonIndex+1:]
+
+	for {
+		select {
+		case <-ctx.Done():
+			return keysMoved, ctx.Err()
+		default:
+		}
+
+		getKeysCmd := sourceClient.B().ClusterGetkeysinslot().Slot(int64(slot)).Count(int64(options.pipeline())).Build()
+		keys, err := sourceClient.Do(ctx, getKeysCmd).AsStrSlice()
+		if err != nil {
+			return keysMoved, fmt.Errorf("get keys in slot: %w", err)
+		}
+		if len(keys) == 0 {
+			return keysMoved, nil
+		}
+
+		migrateArgs := []string{targetHost, targetPort, "", "0", strconv.Itoa(options.timeoutMS())}
+		if options.Replace {
+			migrateArgs = append(migrateArgs, "REPLACE")
+		}
+		if options.Username != "" {
+			migrateArgs = append(migrateArgs, "AUTH2", options.Username, options.Password)
+		} else if options.Password != "" {
+			migrateArgs = append(migrateArgs, "AUTH", options.Password)
+		}
+		migrateArgs = append(migrateArgs, "KEYS")
+		migrateArgs = append(migrateArgs, keys...)
+
+		migrateCmd := sourceClient.B().Arbitrary("MIGRATE").Args(migrateArgs...).Build()
+		if err := sourceClient.Do(ctx, migrateCmd).Error(); err != nil {
+			if strings.Contains(err.Error(), "BUSYKEY") && !options.Replace {
+				return keysMoved, fmt.Errorf("target already has keys from slot %d. use Replace to overwrite them: %w", slot, err)
+			}
+			return keysMoved, fmt.Errorf("migrate keys: %w", err)
+		}
+		keysMoved += len(keys)
+	}
+}
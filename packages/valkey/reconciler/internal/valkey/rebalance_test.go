@@ -0,0 +1,248 @@
+package valkey
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPlanRebalance(t *testing.T) {
+	zero := 0.0
+
+	// applies the planned moves to the masters and returns how many slots each master ends up with
+	applyMoves := func(t *testing.T, masters []ClusterNode, moves []SlotMove) map[string]int {
+		t.Helper()
+		owners := make(map[uint16]string)
+		for _, master := range masters {
+			for _, slot := range expandSlotRanges(master.Slots) {
+				owners[slot] = master.ID
+			}
+		}
+		for _, move := range moves {
+			if owners[move.Slot] != move.SourceID {
+				t.Fatalf("slot %d is owned by %s, not the planned source %s", move.Slot, owners[move.Slot], move.SourceID)
+			}
+			owners[move.Slot] = move.TargetID
+		}
+		counts := make(map[string]int)
+		for _, owner := range owners {
+			counts[owner]++
+		}
+		return counts
+	}
+
+	tests := []struct {
+		name       string
+		masters    []ClusterNode
+		options    RebalanceOptions
+		wantMoves  int
+		wantCounts map[string]int
+	}{
+		{
+			name: "already balanced",
+			masters: []ClusterNode{
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 8191}}},
+				{ID: "master2", Slots: []SlotRange{{StartSlot: 8192, EndSlot: 16383}}},
+			},
+			wantMoves: 0,
+		},
+		{
+			name: "empty master is ignored without use empty masters",
+			masters: []ClusterNode{
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 16383}}},
+				{ID: "master2"},
+			},
+			wantMoves: 0,
+		},
+		{
+			name: "empty master takes half the slots",
+			masters: []ClusterNode{
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 16383}}},
+				{ID: "master2"},
+			},
+			options:    RebalanceOptions{UseEmptyMasters: true},
+			wantMoves:  8192,
+			wantCounts: map[string]int{"master1": 8192, "master2": 8192},
+		},
+		{
+			name: "zero weight drains a master",
+			masters: []ClusterNode{
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 5460}}},
+				{ID: "master2", Slots: []SlotRange{{StartSlot: 5461, EndSlot: 10921}}},
+				{ID: "master3", Slots: []SlotRange{{StartSlot: 10922, EndSlot: 16383}}},
+			},
+			options: RebalanceOptions{
+				UseEmptyMasters: true,
+				Weights:         map[string]float64{"master1": 1, "master2": 1, "master3": 0},
+			},
+			wantMoves:  5462,
+			wantCounts: map[string]int{"master1": 8192, "master2": 8192},
+		},
+		{
+			name: "uneven slot counts within the threshold are left alone",
+			masters: []ClusterNode{
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 8250}}},
+				{ID: "master2", Slots: []SlotRange{{StartSlot: 8251, EndSlot: 16383}}},
+			},
+			wantMoves: 0,
+		},
+		{
+			name: "threshold of 0 never moves slots",
+			masters: []ClusterNode{
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 16383}}},
+				{ID: "master2"},
+			},
+			options:   RebalanceOptions{UseEmptyMasters: true, Threshold: &zero},
+			wantMoves: 0,
+		},
+		{
+			name: "rounding remainder goes to the masters that need slots",
+			masters: []ClusterNode{
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 16383}}},
+				{ID: "master2"},
+				{ID: "master3"},
+			},
+			options:    RebalanceOptions{UseEmptyMasters: true},
+			wantMoves:  10923,
+			wantCounts: map[string]int{"master1": 5461, "master2": 5462, "master3": 5461},
+		},
+		{
+			// a resumed DelShard after the drain but before del-node. valkey-cli --cluster rebalance
+			// --cluster-weight drained=0 --cluster-use-empty-masters prints "No rebalancing needed!" here
+			name: "drained empty master is already balanced",
+			masters: []ClusterNode{
+				{ID: "drained"},
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 5461}}},
+				{ID: "master2", Slots: []SlotRange{{StartSlot: 5462, EndSlot: 10922}}},
+				{ID: "master3", Slots: []SlotRange{{StartSlot: 10923, EndSlot: 16383}}},
+			},
+			options: RebalanceOptions{
+				UseEmptyMasters: true,
+				Weights:         map[string]float64{"drained": 0},
+			},
+			wantMoves: 0,
+		},
+		{
+			// the empty master with a weight still triggers the rebalance. the remainder skips the drained one
+			name: "rounding remainder with a drained master and one over the threshold",
+			masters: []ClusterNode{
+				{ID: "drained"},
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 8191}}},
+				{ID: "master2", Slots: []SlotRange{{StartSlot: 8192, EndSlot: 16383}}},
+				{ID: "master3"},
+			},
+			options: RebalanceOptions{
+				UseEmptyMasters: true,
+				Weights:         map[string]float64{"drained": 0},
+			},
+			wantMoves:  5462,
+			wantCounts: map[string]int{"master1": 5461, "master2": 5461, "master3": 5462},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			moves := PlanRebalance(test.masters, test.options)
+			if len(moves) != test.wantMoves {
+				t.Fatalf("expected %d moves, got %d", test.wantMoves, len(moves))
+			}
+			if test.wantCounts == nil {
+				return
+			}
+
+			counts := applyMoves(t, test.masters, moves)
+			for id, count := range counts {
+				if count != test.wantCounts[id] {
+					t.Errorf("%s owns %d slots after rebalance, want %d", id, count, test.wantCounts[id])
+				}
+			}
+		})
+	}
+}
+
+func TestOpenSlotMoves(t *testing.T) {
+	tests := []struct {
+		name        string
+		myselfNodes []ClusterNode
+		want        []SlotMove
+	}{
+		{
+			name: "no open slots",
+			myselfNodes: []ClusterNode{
+				{ID: "master1", Slots: []SlotRange{{StartSlot: 0, EndSlot: 16383}}},
+				{ID: "master2"},
+			},
+			want: []SlotMove{},
+		},
+		{
+			name: "migrating and importing sides of the same slot",
+			myselfNodes: []ClusterNode{
+				{ID: "master1", Migrating: []MigratingSlot{{Slot: 10, MigratingNodeID: "master2"}}},
+				{ID: "master2", Importing: []ImportingSlot{{Slot: 10, ImportingNodeID: "master1"}}},
+			},
+			want: []SlotMove{{Slot: 10, SourceID: "master1", TargetID: "master2"}},
+		},
+		{
+			name: "interrupted before the source was set to migrating",
+			myselfNodes: []ClusterNode{
+				{ID: "master1"},
+				{ID: "master2", Importing: []ImportingSlot{{Slot: 42, ImportingNodeID: "master1"}}},
+			},
+			want: []SlotMove{{Slot: 42, SourceID: "master1", TargetID: "master2"}},
+		},
+		{
+			name: "target already finalized the slot",
+			myselfNodes: []ClusterNode{
+				{ID: "master1", Migrating: []MigratingSlot{{Slot: 7, MigratingNodeID: "master3"}, {Slot: 3, MigratingNodeID: "master2"}}},
+				{ID: "master2"},
+				{ID: "master3"},
+			},
+			want: []SlotMove{
+				{Slot: 3, SourceID: "master1", TargetID: "master2"},
+				{Slot: 7, SourceID: "master1", TargetID: "master3"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := OpenSlotMoves(test.myselfNodes)
+			if len(got) != len(test.want) {
+				t.Fatalf("OpenSlotMoves() = %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("move[%d] = %v, want %v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGroupSlotMoves(t *testing.T) {
+	moves := []SlotMove{
+		{Slot: 3, SourceID: "master1", TargetID: "master3"},
+		{Slot: 1, SourceID: "master1", TargetID: "master3"},
+		{Slot: 2, SourceID: "master1", TargetID: "master3"},
+		{Slot: 9, SourceID: "master1", TargetID: "master3"},
+		{Slot: 5, SourceID: "master2", TargetID: "master3"},
+		{Slot: 10, SourceID: "master1", TargetID: "master3"},
+	}
+
+	got := GroupSlotMoves(moves)
+	want := []SlotTransfer{
+		{SourceID: "master1", TargetID: "master3", Slots: []SlotRange{{StartSlot: 1, EndSlot: 3}, {StartSlot: 9, EndSlot: 9}}},
+		{SourceID: "master2", TargetID: "master3", Slots: []SlotRange{{StartSlot: 5, EndSlot: 5}}},
+		{SourceID: "master1", TargetID: "master3", Slots: []SlotRange{{StartSlot: 10, EndSlot: 10}}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GroupSlotMoves() = %+v, want %+v", got, want)
+	}
+	for i := range got {
+		if got[i].SourceID != want[i].SourceID || got[i].TargetID != want[i].TargetID || !slices.Equal(got[i].Slots, want[i].Slots) {
+			t.Errorf("transfer[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got[0].SlotCount() != 4 {
+		t.Errorf("SlotCount() = %d, want 4", got[0].SlotCount())
+	}
+}
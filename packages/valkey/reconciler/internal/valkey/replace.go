@@ -0,0 +1,282 @@
+package valkey
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/metrics"
+)
+
+// NodeReplacement is a pod that came back without its data (empty pvc or no persistence) and so
+// started as a brand new node. the cluster still has the old node id, stuck in fail/noaddr.
+type NodeReplacement struct {
+	Address string      // the pod's client address (with port)
+	Stale   ClusterNode // the cluster's entry for the pod's old node
+	New     ClusterNode // the pod's view of itself
+
+	// how the pod gets its role back. Promote and TakeSlots are only set for lost masters
+	Promote   string      // replica that takes over the stale master's slots first
+	ReplicaOf string      // master the new node replicates
+	TakeSlots []SlotRange // the stale master had no replicas. the new node gets its slots back (without the data)
+}
+
+func (r NodeReplacement) String() string {
+	switch {
+	case r.Promote != "":
+		return fmt.Sprintf("promote %s in place of master %s and attach %s as its replica", r.Promote, r.Stale.ID, r.New.ID)
+	case r.ReplicaOf != "":
+		return fmt.Sprintf("replace %s with %s as a replica of %s", r.Stale.ID, r.New.ID, r.ReplicaOf)
+	default:
+		return fmt.Sprintf("replace master %s with %s as an empty master", r.Stale.ID, r.New.ID)
+	}
+}
+
+// StaleNodes are the nodes the cluster can't reach anymore (fail or noaddr) that still map to a pod
+func StaleNodes(topology Topology) []ClusterNode {
+	var stale []ClusterNode
+	for _, node := range topology.OrderedNodes {
+		if isStale(node) && node.Index() >= 0 {
+			stale = append(stale, node)
+		}
+	}
+	return stale
+}
+
+func isStale(node ClusterNode) bool {
+	return slices.Contains(node.Flags, Fail) || slices.Contains(node.Flags, NoAddr)
+}
+
+// PlanNodeReplacement decides whether the pod that used to run stale now runs a fresh node (one that
+// only knows itself, owns no slots and has a different id) and how to give it stale's role back.
+// podNodes is CLUSTER NODES from podAddress.
+func PlanNodeReplacement(topology Topology, stale ClusterNode, podAddress string, podNodes []ClusterNode) (NodeReplacement, bool) {
+	if len(podNodes) != 1 {
+		return NodeReplacement{}, false
+	}
+	fresh := podNodes[0]
+	if fresh.ID == stale.ID || fresh.Master != "" || len(fresh.Slots) > 0 {
+		return NodeReplacement{}, false
+	}
+
+	replacement := NodeReplacement{Address: podAddress, Stale: stale, New: fresh}
+	switch {
+	case stale.Master != "":
+		// the master could be gone too. it's replaced on its own and this replica goes wherever there's room
+		if master, exists := topology.Masters[stale.Master]; exists && !isStale(master.Node) {
+			replacement.ReplicaOf = stale.Master
+		} else {
+			replacement.ReplicaOf = leastReplicatedMaster(topology)
+		}
+
+	case len(stale.Slots) > 0:
+		if replica, exists := lowestIndexReplica(topology, stale.ID); exists {
+			replacement.Promote = replica.ID
+			replacement.ReplicaOf = replica.ID
+		} else {
+			replacement.TakeSlots = stale.Slots
+		}
+
+	default:
+		// a replica already failed over and took the slots. the shard it left is the one short a replica
+		replacement.ReplicaOf = leastReplicatedMaster(topology)
+	}
+
+	if replacement.ReplicaOf == "" && replacement.TakeSlots == nil {
+		return NodeReplacement{}, false
+	}
+	return replacement, true
+}
+
+func lowestIndexReplica(topology Topology, masterID string) (ClusterNode, bool) {
+	var lowest ClusterNode
+	found := false
+	for _, slaveID := range topology.Masters[masterID].SlaveIds {
+		replica := topology.Slaves[slaveID]
+		if isStale(replica) {
+			continue
+		}
+		if !found || replica.Index() < lowest.Index() {
+			lowest, found = replica, true
+		}
+	}
+	return lowest, found
+}
+
+// healthy master with a slot range and the fewest healthy replicas. ties go to the lowest shard
+func leastReplicatedMaster(topology Topology) string {
+	leastID, leastReplicas := "", -1
+	for _, shard := range topology.OrderedShards {
+		master := topology.Masters[shard.MasterId]
+		if isStale(master.Node) || len(master.Node.Slots) == 0 {
+			continue
+		}
+		replicas := 0
+		for _, slaveID := range master.SlaveIds {
+			if !isStale(topology.Slaves[slaveID]) {
+				replicas++
+			}
+		}
+		if leastReplicas == -1 || replicas < leastReplicas {
+			leastID, leastReplicas = master.Node.ID, replicas
+		}
+	}
+	return leastID
+}
+
+type ReplaceNodeOptions struct {
+	Auth
+
+	Replacement NodeReplacement
+	Topology    Topology // the cluster with the stale node still in it
+	BusPort     int      // cluster bus port of every node (env.BusPort)
+}
+
+// ReplaceNode forgets the stale node everywhere, joins the fresh node to the cluster and gives it the
+// stale node's role back
+func ReplaceNode(ctx context.Context, options ReplaceNodeOptions) error {
+	if options.BusPort == 0 {
+		return fmt.Errorf("bus port is required")
+	}
+	replacement := options.Replacement
+	ctx = logging.With(ctx, "node_id", replacement.Stale.ID, "hostname", replacement.Stale.Hostname)
+	logger := logging.FromContext(ctx)
+	logger.Info("Replacing node that lost its data", "new_node_id", replacement.New.ID, "plan", replacement.String())
+
+	nodeClient := func(node ClusterNode) (*ValkeyClient, error) {
+		return NewNodeClient(options.Auth, node.Address())
+	}
+
+	if replacement.Promote != "" {
+		replica := options.Topology.Slaves[replacement.Promote]
+		replicaClient, err := nodeClient(replica)
+		if err != nil {
+			return err
+		}
+		defer replicaClient.Close()
+
+		// the master is gone so there is nobody to agree with
+		failoverCmd := replicaClient.B().ClusterFailover().Takeover().Build()
+		if err := replicaClient.Do(ctx, failoverCmd).Error(); err != nil {
+			// the cluster may have failed over on its own in the meantime
+			if nodes, nodesErr := ClusterNodes(replicaClient); nodesErr != nil || !MyselfIsMaster.Match(nodes) {
+				return fmt.Errorf("failover to %s: %w", replica.ID, err)
+			}
+		}
+		timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		defer cancel()
+		if err := WaitForNode(timeoutCtx, replicaClient, MyselfIsMaster, DefaultWaitOptions); err != nil {
+			return err
+		}
+		logger.Info("Promoted replica", "promoted_id", replica.ID)
+		events.Normal(ctx, events.ReasonFailover, "Promoted %s (%s) in place of master %s, whose pod lost its data", replica.ID, replica.Hostname, replacement.Stale.ID)
+	}
+
+	var healthyNodes []ClusterNode
+	for _, node := range options.Topology.OrderedNodes {
+		if node.ID != replacement.Stale.ID && !isStale(node) {
+			healthyNodes = append(healthyNodes, node)
+		}
+	}
+	if len(healthyNodes) == 0 {
+		return fmt.Errorf("no healthy node left to join %s to", replacement.New.ID)
+	}
+	seed := healthyNodes[0]
+
+	// every node has to forget within a minute or the ones that still know it gossip it back. replicas
+	// refuse to forget their master until they have followed the promoted replica so the whole round is
+	// repeated until every node agrees
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	for {
+		pending, err := forgetNode(timeoutCtx, healthyNodes, replacement.Stale.ID, nodeClient)
+		if err != nil {
+			return err
+		}
+		if pending == 0 {
+			break
+		}
+		logger.Debug("Replicas still follow the forgotten node, retrying", "pending", pending)
+		select {
+		case <-timeoutCtx.Done():
+			return fmt.Errorf("forget %s: %w", replacement.Stale.ID, timeoutCtx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+	metrics.NodesRemoved(1)
+	events.Normal(ctx, events.ReasonNodeRemoved, "Forgot node %s (%s) after its pod came back without data", replacement.Stale.ID, replacement.Stale.Hostname)
+
+	newClient, err := NewNodeClient(options.Auth, replacement.Address)
+	if err != nil {
+		return err
+	}
+	defer newClient.Close()
+
+	ip, port, err := resolveAddress(ctx, seed.Address())
+	if err != nil {
+		return err
+	}
+	meetCmd := newClient.B().ClusterMeet().Ip(ip).Port(int64(port)).ClusterBusPort(int64(options.BusPort)).Build()
+	if err := newClient.Do(ctx, meetCmd).Error(); err != nil {
+		return fmt.Errorf("meet %s: %w", seed.ID, err)
+	}
+	timeoutCtx, cancel = context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	if err := WaitForNode(timeoutCtx, newClient, KnowsNode(seed.ID), DefaultWaitOptions); err != nil {
+		return err
+	}
+	metrics.NodesAdded(1)
+	events.Normal(ctx, events.ReasonNodeAdded, "Added node %s (%s) in place of %s", replacement.New.ID, replacement.Stale.Hostname, replacement.Stale.ID)
+
+	if replacement.ReplicaOf != "" {
+		// the replica needs to know the master before it can replicate it
+		if err := WaitForNode(timeoutCtx, newClient, KnowsNode(replacement.ReplicaOf), DefaultWaitOptions); err != nil {
+			return err
+		}
+		if err := Replicate(newClient, replacement.ReplicaOf); err != nil {
+			return fmt.Errorf("replicate %s: %w", replacement.ReplicaOf, err)
+		}
+		logger.Info("Node replaced", "new_node_id", replacement.New.ID, "master_id", replacement.ReplicaOf)
+		events.Normal(ctx, events.ReasonReplicaAttached, "Attached replica %s (%s) to master %s", replacement.New.ID, replacement.Stale.Hostname, replacement.ReplicaOf)
+		return nil
+	}
+
+	addSlotsCmd := newClient.B().ClusterAddslotsrange().StartSlotEndSlot()
+	for _, slotRange := range replacement.TakeSlots {
+		addSlotsCmd = addSlotsCmd.StartSlotEndSlot(int64(slotRange.StartSlot), int64(slotRange.EndSlot))
+	}
+	if err := newClient.Do(ctx, addSlotsCmd.Build()).Error(); err != nil {
+		return fmt.Errorf("add slots to %s: %w", replacement.New.ID, err)
+	}
+	// a fresh node starts at epoch 0 which would lose every slot conflict
+	if err := newClient.Do(ctx, newClient.B().ClusterBumpepoch().Build()).Error(); err != nil {
+		return fmt.Errorf("bump epoch on %s: %w", replacement.New.ID, err)
+	}
+	logger.Warn("Master replaced without replicas. Its data is lost", "new_node_id", replacement.New.ID, "slots", slotCount(replacement.TakeSlots))
+	events.Warning(ctx, events.ReasonNodeAdded, "Master %s lost its data and had no replicas. %s took over its %d slots empty", replacement.Stale.ID, replacement.New.ID, slotCount(replacement.TakeSlots))
+	return nil
+}
+
+// sends CLUSTER FORGET to every node. pending counts the replicas that can't forget it yet because it
+// is still their master
+func forgetNode(ctx context.Context, nodes []ClusterNode, nodeID string, nodeClient func(ClusterNode) (*ValkeyClient, error)) (pending int, err error) {
+	for _, node := range nodes {
+		client, err := nodeClient(node)
+		if err != nil {
+			return 0, err
+		}
+		err = client.Do(ctx, client.B().ClusterForget().NodeId(nodeID).Build()).Error()
+		client.Close()
+		switch {
+		case err == nil, strings.Contains(err.Error(), "Unknown node"):
+		case strings.Contains(err.Error(), "Can't forget my master"):
+			pending++
+		default:
+			return 0, fmt.Errorf("forget %s on %s: %w", nodeID, node.ID, err)
+		}
+	}
+	return pending, nil
+}
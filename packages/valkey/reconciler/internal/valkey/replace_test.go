@@ -0,0 +1,156 @@
+package valkey
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// two masters (pods 0 and 1) with one replica each (pods 2 and 3)
+func replaceNodes() []ClusterNode {
+	node := func(index int, master string, slots []SlotRange) ClusterNode {
+		flags := []Flag{Master}
+		if master != "" {
+			flags = []Flag{Slave}
+		}
+		return ClusterNode{
+			ID:        fmt.Sprintf("node%d", index),
+			Hostname:  fmt.Sprintf("valkey-test-%d.valkey-test-headless.default.svc.cluster.local", index),
+			Port:      6379,
+			Flags:     flags,
+			Master:    master,
+			LinkState: Connected,
+			Slots:     slots,
+		}
+	}
+	return []ClusterNode{
+		node(0, "", []SlotRange{{StartSlot: 0, EndSlot: 8191}}),
+		node(1, "", []SlotRange{{StartSlot: 8192, EndSlot: 16383}}),
+		node(2, "node0", nil),
+		node(3, "node1", nil),
+	}
+}
+
+func TestPlanNodeReplacement(t *testing.T) {
+	fresh := []ClusterNode{{ID: "fresh", Flags: []Flag{Myself, Master}}}
+
+	tests := []struct {
+		name          string
+		nodes         func() []ClusterNode
+		staleIndex    int
+		podNodes      []ClusterNode
+		wantOK        bool
+		wantPromote   string
+		wantReplicaOf string
+		wantTakeSlots bool
+	}{
+		{
+			name: "lost replica goes back to its master",
+			nodes: func() []ClusterNode {
+				nodes := replaceNodes()
+				nodes[2].Flags = []Flag{Slave, Fail}
+				return nodes
+			},
+			staleIndex:    2,
+			podNodes:      fresh,
+			wantOK:        true,
+			wantReplicaOf: "node0",
+		},
+		{
+			name: "lost master is failed over to its replica",
+			nodes: func() []ClusterNode {
+				nodes := replaceNodes()
+				nodes[0].Flags = []Flag{Master, Fail}
+				return nodes
+			},
+			staleIndex:    0,
+			podNodes:      fresh,
+			wantOK:        true,
+			wantPromote:   "node2",
+			wantReplicaOf: "node2",
+		},
+		{
+			name: "lost master that already failed over joins the shard short a replica",
+			nodes: func() []ClusterNode {
+				nodes := replaceNodes()
+				nodes[0].Flags = []Flag{Master, Fail}
+				nodes[0].Slots = nil
+				nodes[2].Flags = []Flag{Master}
+				nodes[2].Master = ""
+				nodes[2].Slots = []SlotRange{{StartSlot: 0, EndSlot: 8191}}
+				return nodes
+			},
+			staleIndex:    0,
+			podNodes:      fresh,
+			wantOK:        true,
+			wantReplicaOf: "node2",
+		},
+		{
+			name: "lost master without replicas takes its slots back",
+			nodes: func() []ClusterNode {
+				nodes := replaceNodes()[:2]
+				nodes[1].Flags = []Flag{Master, NoAddr}
+				return nodes
+			},
+			staleIndex:    1,
+			podNodes:      fresh,
+			wantOK:        true,
+			wantTakeSlots: true,
+		},
+		{
+			name: "pod still runs the old node",
+			nodes: func() []ClusterNode {
+				nodes := replaceNodes()
+				nodes[2].Flags = []Flag{Slave, Fail}
+				return nodes
+			},
+			staleIndex: 2,
+			podNodes:   []ClusterNode{{ID: "node2", Flags: []Flag{Myself, Slave}}},
+			wantOK:     false,
+		},
+		{
+			name: "pod already knows other nodes",
+			nodes: func() []ClusterNode {
+				nodes := replaceNodes()
+				nodes[2].Flags = []Flag{Slave, Fail}
+				return nodes
+			},
+			staleIndex: 2,
+			podNodes:   append(slices.Clone(fresh), ClusterNode{ID: "node0", Flags: []Flag{Master}}),
+			wantOK:     false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topology, err := ClusterTopology(test.nodes())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			stale := StaleNodes(topology)
+			if len(stale) != 1 || stale[0].Index() != test.staleIndex {
+				t.Fatalf("expected pod %d to be stale, got %v", test.staleIndex, stale)
+			}
+
+			replacement, ok := PlanNodeReplacement(topology, stale[0], "pod:6379", test.podNodes)
+			if ok != test.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, test.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if replacement.Promote != test.wantPromote {
+				t.Errorf("promote = %q, want %q", replacement.Promote, test.wantPromote)
+			}
+			if replacement.ReplicaOf != test.wantReplicaOf {
+				t.Errorf("replica of = %q, want %q", replacement.ReplicaOf, test.wantReplicaOf)
+			}
+			if got := len(replacement.TakeSlots) > 0; got != test.wantTakeSlots {
+				t.Errorf("takes slots = %v, want %v", got, test.wantTakeSlots)
+			}
+			if replacement.Address != "pod:6379" || replacement.New.ID != "fresh" {
+				t.Errorf("unexpected replacement %+v", replacement)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package valkey
+
+import (
+	"valkey/reconciler/internal/utils"
+)
+
+// what two pods of the same shard sharing a failure domain costs. losing a kubernetes node takes down
+// everything on it so sharing one is much worse than sharing a zone
+const (
+	sameNodeCost = 10
+	sameZoneCost = 1
+)
+
+func placementCost(a, b utils.Placement) int {
+	switch {
+	case a.Node != "" && a.Node == b.Node:
+		return sameNodeCost
+	case a.Zone != "" && a.Zone == b.Zone:
+		return sameZoneCost
+	default:
+		return 0
+	}
+}
+
+// adds up the cost of every pair of pods in the shard
+func shardCost(pods []int, placements map[int]utils.Placement) int {
+	cost := 0
+	for i, a := range pods {
+		for _, b := range pods[i+1:] {
+			cost += placementCost(placements[a], placements[b])
+		}
+	}
+	return cost
+}
+
+// ShardPods is the pod indexes of the shard's master and its replicas
+func (t Topology) ShardPods(masterID string) []int {
+	master, exists := t.Masters[masterID]
+	if !exists {
+		return nil
+	}
+	pods := make([]int, 0, len(master.SlaveIds)+1)
+	pods = append(pods, master.Node.Index())
+	for _, slaveID := range master.SlaveIds {
+		pods = append(pods, t.Slaves[slaveID].Index())
+	}
+	return pods
+}
+
+// PickReplica returns the index of the candidate hostname that shares the fewest failure domains with
+// the shard's pods. ties go to the earliest candidate so without placements it is always the first one
+func PickReplica(shardPods []int, candidates []string, placements map[int]utils.Placement) int {
+	best, bestCost := 0, -1
+	for i, candidate := range candidates {
+		candidatePlacement := placements[HostnameIndex(candidate)]
+		cost := 0
+		for _, pod := range shardPods {
+			cost += placementCost(candidatePlacement, placements[pod])
+		}
+		if bestCost == -1 || cost < bestCost {
+			best, bestCost = i, cost
+		}
+	}
+	return best
+}
+
+// ReplicaMove has a replica replicate another master
+type ReplicaMove struct {
+	Replica  ClusterNode
+	MasterID string
+}
+
+// PlanReplicaSpread swaps replicas between shards for as long as a swap lowers how many failure domains
+// the pods of a shard share and returns the replicas that end up with a different master, in pod order.
+// masters never move and a shard keeps its number of replicas
+func PlanReplicaSpread(topology Topology, placements map[int]utils.Placement) []ReplicaMove {
+	if len(placements) == 0 {
+		return nil
+	}
+
+	var replicas []ClusterNode
+	masterOf := make(map[string]string, len(topology.Slaves))
+	for _, node := range topology.OrderedNodes {
+		if _, isReplica := topology.Slaves[node.ID]; isReplica {
+			replicas = append(replicas, node)
+			masterOf[node.ID] = node.Master
+		}
+	}
+	cost := func(masterID string) int {
+		pods := []int{topology.Masters[masterID].Node.Index()}
+		for _, replica := range replicas {
+			if masterOf[replica.ID] == masterID {
+				pods = append(pods, replica.Index())
+			}
+		}
+		return shardCost(pods, placements)
+	}
+
+	// every swap lowers the total cost so this only bounds the search
+	for range len(replicas) * len(replicas) {
+		bestGain, bestA, bestB := 0, -1, -1
+		for i, a := range replicas {
+			for j := i + 1; j < len(replicas); j++ {
+				b := replicas[j]
+				masterA, masterB := masterOf[a.ID], masterOf[b.ID]
+				if masterA == masterB {
+					continue
+				}
+				before := cost(masterA) + cost(masterB)
+				masterOf[a.ID], masterOf[b.ID] = masterB, masterA
+				after := cost(masterA) + cost(masterB)
+				masterOf[a.ID], masterOf[b.ID] = masterA, masterB
+				if gain := before - after; gain > bestGain {
+					bestGain, bestA, bestB = gain, i, j
+				}
+			}
+		}
+		if bestA == -1 {
+			break
+		}
+		a, b := replicas[bestA].ID, replicas[bestB].ID
+		masterOf[a], masterOf[b] = masterOf[b], masterOf[a]
+	}
+
+	var moves []ReplicaMove
+	for _, replica := range replicas {
+		if masterOf[replica.ID] != replica.Master {
+			moves = append(moves, ReplicaMove{Replica: replica, MasterID: masterOf[replica.ID]})
+		}
+	}
+	return moves
+}
@@ -0,0 +1,150 @@
+package valkey
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"valkey/reconciler/internal/utils"
+)
+
+func spreadNode(index int, master string) ClusterNode {
+	return ClusterNode{
+		ID:        fmt.Sprintf("node%d", index),
+		Hostname:  fmt.Sprintf("valkey-test-%d.valkey-test-headless.default.svc.cluster.local", index),
+		Master:    master,
+		LinkState: Connected,
+	}
+}
+
+func TestPickReplica(t *testing.T) {
+	candidates := []string{
+		"valkey-test-2.valkey-test-headless.default.svc.cluster.local",
+		"valkey-test-3.valkey-test-headless.default.svc.cluster.local",
+		"valkey-test-4.valkey-test-headless.default.svc.cluster.local",
+	}
+
+	tests := []struct {
+		name       string
+		shardPods  []int
+		placements map[int]utils.Placement
+		want       int
+	}{
+		{
+			name:      "no placements takes the first",
+			shardPods: []int{0},
+			want:      0,
+		},
+		{
+			name:      "other zone",
+			shardPods: []int{0},
+			placements: map[int]utils.Placement{
+				0: {Node: "a1", Zone: "a"},
+				2: {Node: "a2", Zone: "a"},
+				3: {Node: "b1", Zone: "b"},
+				4: {Node: "c1", Zone: "c"},
+			},
+			want: 1,
+		},
+		{
+			name:      "same zone beats same node",
+			shardPods: []int{0},
+			placements: map[int]utils.Placement{
+				0: {Node: "a1", Zone: "a"},
+				2: {Node: "a1", Zone: "a"},
+				3: {Node: "a1", Zone: "a"},
+				4: {Node: "a2", Zone: "a"},
+			},
+			want: 2,
+		},
+		{
+			name:      "zone not used by the shard yet",
+			shardPods: []int{0, 1},
+			placements: map[int]utils.Placement{
+				0: {Node: "a1", Zone: "a"},
+				1: {Node: "b1", Zone: "b"},
+				2: {Node: "a2", Zone: "a"},
+				3: {Node: "b2", Zone: "b"},
+				4: {Node: "c1", Zone: "c"},
+			},
+			want: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := PickReplica(test.shardPods, candidates, test.placements); got != test.want {
+				t.Errorf("PickReplica() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPlanReplicaSpread(t *testing.T) {
+	// two shards: node0 with node2 and node1 with node3
+	nodes := []ClusterNode{spreadNode(0, ""), spreadNode(1, ""), spreadNode(2, "node0"), spreadNode(3, "node1")}
+
+	tests := []struct {
+		name       string
+		placements map[int]utils.Placement
+		want       []string
+	}{
+		{
+			name: "no placements",
+		},
+		{
+			name: "already spread",
+			placements: map[int]utils.Placement{
+				0: {Node: "a1", Zone: "a"},
+				1: {Node: "b1", Zone: "b"},
+				2: {Node: "b2", Zone: "b"},
+				3: {Node: "a2", Zone: "a"},
+			},
+		},
+		{
+			name: "replicas in their master's zone",
+			placements: map[int]utils.Placement{
+				0: {Node: "a1", Zone: "a"},
+				1: {Node: "b1", Zone: "b"},
+				2: {Node: "a2", Zone: "a"},
+				3: {Node: "b2", Zone: "b"},
+			},
+			want: []string{"node2 -> node1", "node3 -> node0"},
+		},
+		{
+			name: "replica on its master's kubernetes node",
+			placements: map[int]utils.Placement{
+				0: {Node: "n1"},
+				1: {Node: "n2"},
+				2: {Node: "n1"},
+				3: {Node: "n3"},
+			},
+			want: []string{"node2 -> node1", "node3 -> node0"},
+		},
+		{
+			name: "nothing better to swap to",
+			placements: map[int]utils.Placement{
+				0: {Node: "a1", Zone: "a"},
+				1: {Node: "a2", Zone: "a"},
+				2: {Node: "a3", Zone: "a"},
+				3: {Node: "a4", Zone: "a"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topology, err := ClusterTopology(nodes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, move := range PlanReplicaSpread(topology, test.placements) {
+				got = append(got, fmt.Sprintf("%s -> %s", move.Replica.ID, move.MasterID))
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("PlanReplicaSpread() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
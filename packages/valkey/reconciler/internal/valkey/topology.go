@@ -2,11 +2,16 @@ package valkey
 
 import (
 	"fmt"
+	"log/slog"
+	"slices"
 	"sort"
+	"valkey/reconciler/internal/utils"
 
 	"github.com/valkey-io/valkey-go"
 )
 
+const TotalSlots = 16384
+
 type masterNode struct {
 	Node     ClusterNode
 	SlaveIds []string
@@ -77,23 +82,42 @@ func ClusterTopology(nodes []ClusterNode) (Topology, error) {
 }
 
 func (t Topology) IsHealthy() (bool, error) {
-	nodeIndex := 0
+	if err := t.CheckNodes(); err != nil {
+		return false, err
+	}
+	if err := t.CheckShape(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CheckNodes makes sure every node is reachable and fully part of the cluster
+func (t Topology) CheckNodes() error {
 	for _, node := range t.OrderedNodes {
 		for _, flag := range node.Flags {
 			switch flag {
 			case Fail, Pfail, Handshake, NoAddr:
-				return false, fmt.Errorf("node %s is in %s state", node.ID, flag)
+				return fmt.Errorf("node %s is in %s state", node.ID, flag)
 			default:
 				continue
 			}
 		}
 		if node.LinkState == Disconnected {
-			return false, fmt.Errorf("node %s is disconnected", node.ID)
+			return fmt.Errorf("node %s is disconnected", node.ID)
 		}
+	}
+	return nil
+}
 
+// CheckShape makes sure the nodes are laid out the way init and scaling leave them: one node for every
+// statefulset index and the same number of replicas for every master. an interrupted scale operation
+// breaks the shape until it is resumed.
+func (t Topology) CheckShape() error {
+	nodeIndex := 0
+	for _, node := range t.OrderedNodes {
 		index := node.Index()
 		if index != nodeIndex {
-			return false, fmt.Errorf("missing node index. expected %d", index)
+			return fmt.Errorf("missing node index. expected %d", index)
 		}
 		nodeIndex += 1
 	}
@@ -106,15 +130,51 @@ func (t Topology) IsHealthy() (bool, error) {
 		}
 
 		if len(masterNode.SlaveIds) != replicasPerMaster {
-			return false, fmt.Errorf("master %s has %d replicas, expected %d", masterNode.Node.Hostname, len(masterNode.SlaveIds), replicasPerMaster)
+			return fmt.Errorf("master %s has %d replicas, expected %d", masterNode.Node.Hostname, len(masterNode.SlaveIds), replicasPerMaster)
 		}
 	}
 
 	if len(t.OrderedShards) != len(t.Masters) {
-		return false, fmt.Errorf("expected %d shards, got %d. there should be one shard per master", len(t.Masters), len(t.OrderedShards))
+		return fmt.Errorf("expected %d shards, got %d. there should be one shard per master", len(t.Masters), len(t.OrderedShards))
 	}
 
-	return true, nil
+	return nil
+}
+
+// number of slots owned by masters. a fully covered cluster has TotalSlots assigned
+func (t Topology) AssignedSlots() int {
+	assigned := 0
+	for _, master := range t.Masters {
+		assigned += slotCount(master.Node.Slots)
+	}
+	return assigned
+}
+
+// PodRoles is the role, shard and node id of every pod in the cluster keyed by pod index. shards are
+// numbered by their position in OrderedShards. failed nodes are left out so their pods drop out of role
+// selectors until they are back
+func (t Topology) PodRoles() map[int]utils.PodRole {
+	roles := make(map[int]utils.PodRole, len(t.OrderedNodes))
+	for shard, orderedShard := range t.OrderedShards {
+		master := t.Masters[orderedShard.MasterId]
+		nodes := []ClusterNode{master.Node}
+		for _, slaveID := range master.SlaveIds {
+			nodes = append(nodes, t.Slaves[slaveID])
+		}
+
+		for _, node := range nodes {
+			index := node.Index()
+			if index < 0 || slices.Contains(node.Flags, Fail) {
+				continue
+			}
+			role := utils.RoleMaster
+			if node.Master != "" {
+				role = utils.RoleReplica
+			}
+			roles[index] = utils.PodRole{Role: role, Shard: shard, NodeID: node.ID}
+		}
+	}
+	return roles
 }
 
 func GetClusterTopology(client valkey.Client) (Topology, error) {
@@ -125,24 +185,17 @@ func GetClusterTopology(client valkey.Client) (Topology, error) {
 	return ClusterTopology(nodes)
 }
 
-func (t Topology) Print() {
-	fmt.Println("Cluster Topology:")
-	fmt.Println("  Masters:")
-	for _, master := range t.Masters {
-		fmt.Printf("    %s\n", master.Node.Hostname)
-	}
-	fmt.Println("  Slaves:")
-	for _, slave := range t.Slaves {
-		fmt.Printf("    %s\n", slave.Hostname)
-	}
-	fmt.Println("  Ordered Nodes:")
-	for _, node := range t.OrderedNodes {
-		fmt.Printf("    %s\n", node.Hostname)
-	}
-	fmt.Println("  Ordered Shards:")
-	shardList := ""
-	for _, shard := range t.OrderedShards {
-		shardList += fmt.Sprintf("[%d] ", shard.Index)
+// logged as counts plus the hostnames in pod order. the nodes themselves are logged by LogClusterNodes
+func (t Topology) LogValue() slog.Value {
+	hostnames := make([]string, len(t.OrderedNodes))
+	for i, node := range t.OrderedNodes {
+		hostnames[i] = node.Hostname
 	}
-	fmt.Printf("    %s\n", shardList)
+	return slog.GroupValue(
+		slog.Int("masters", len(t.Masters)),
+		slog.Int("replicas", len(t.Slaves)),
+		slog.Int("shards", len(t.OrderedShards)),
+		slog.Int("assigned_slots", t.AssignedSlots()),
+		slog.Any("nodes", hostnames),
+	)
 }
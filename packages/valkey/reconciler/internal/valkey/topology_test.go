@@ -1,8 +1,10 @@
 package valkey
 
 import (
+	"maps"
 	"strings"
 	"testing"
+	"valkey/reconciler/internal/utils"
 )
 
 func TestClusterTopology(t *testing.T) {
@@ -918,3 +920,144 @@ func TestTopology_IsHealthy(t *testing.T) {
 		})
 	}
 }
+
+func TestTopology_AssignedSlots(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []ClusterNode
+		want  int
+	}{
+		{
+			name: "no slots assigned",
+			nodes: []ClusterNode{
+				{ID: "master1", Hostname: "valkey-0.valkey.default.svc.cluster.local"},
+			},
+			want: 0,
+		},
+		{
+			name: "single master owns every slot",
+			nodes: []ClusterNode{
+				{
+					ID:       "master1",
+					Hostname: "valkey-0.valkey.default.svc.cluster.local",
+					Slots:    []SlotRange{{StartSlot: 0, EndSlot: 16383}},
+				},
+			},
+			want: TotalSlots,
+		},
+		{
+			name: "slots split across masters with single slot ranges",
+			nodes: []ClusterNode{
+				{
+					ID:       "master1",
+					Hostname: "valkey-0.valkey.default.svc.cluster.local",
+					Slots:    []SlotRange{{StartSlot: 0, EndSlot: 8190}, {StartSlot: 8192, EndSlot: 8192}},
+				},
+				{
+					ID:       "master2",
+					Hostname: "valkey-1.valkey.default.svc.cluster.local",
+					Slots:    []SlotRange{{StartSlot: 10000, EndSlot: 16383}},
+				},
+			},
+			want: 8191 + 1 + 6384,
+		},
+		{
+			name: "replica slots are not counted",
+			nodes: []ClusterNode{
+				{
+					ID:       "master1",
+					Hostname: "valkey-0.valkey.default.svc.cluster.local",
+					Slots:    []SlotRange{{StartSlot: 0, EndSlot: 99}},
+				},
+				{
+					ID:       "slave1",
+					Hostname: "valkey-1.valkey.default.svc.cluster.local",
+					Master:   "master1",
+					Slots:    []SlotRange{{StartSlot: 0, EndSlot: 99}},
+				},
+			},
+			want: 100,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topology, err := ClusterTopology(test.nodes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := topology.AssignedSlots(); got != test.want {
+				t.Errorf("AssignedSlots() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTopology_CheckNodesAndShape(t *testing.T) {
+	tests := []struct {
+		name         string
+		nodes        []ClusterNode
+		wantNodesErr bool
+		wantShapeErr bool
+	}{
+		{
+			name: "healthy",
+			nodes: []ClusterNode{
+				{ID: "master1", Hostname: "valkey-0.valkey.default.svc.cluster.local", LinkState: Connected},
+				{ID: "slave1", Hostname: "valkey-1.valkey.default.svc.cluster.local", Master: "master1", LinkState: Connected},
+			},
+		},
+		{
+			name: "interrupted shard removal leaves a gap and uneven replicas",
+			nodes: []ClusterNode{
+				{ID: "master1", Hostname: "valkey-0.valkey.default.svc.cluster.local", LinkState: Connected},
+				{ID: "master2", Hostname: "valkey-1.valkey.default.svc.cluster.local", LinkState: Connected},
+				{ID: "slave1", Hostname: "valkey-3.valkey.default.svc.cluster.local", Master: "master1", LinkState: Connected},
+			},
+			wantShapeErr: true,
+		},
+		{
+			name: "failed node",
+			nodes: []ClusterNode{
+				{ID: "master1", Hostname: "valkey-0.valkey.default.svc.cluster.local", LinkState: Connected},
+				{ID: "slave1", Hostname: "valkey-1.valkey.default.svc.cluster.local", Master: "master1", LinkState: Connected, Flags: []Flag{Slave, Fail}},
+			},
+			wantNodesErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topology, err := ClusterTopology(test.nodes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := topology.CheckNodes(); (err != nil) != test.wantNodesErr {
+				t.Errorf("CheckNodes() error = %v, want error %v", err, test.wantNodesErr)
+			}
+			if err := topology.CheckShape(); (err != nil) != test.wantShapeErr {
+				t.Errorf("CheckShape() error = %v, want error %v", err, test.wantShapeErr)
+			}
+		})
+	}
+}
+
+func TestTopology_PodRoles(t *testing.T) {
+	// shards of node1 (pods 1, 3) and node0 (pods 0, 2) after node0 failed over to node2
+	failed := spreadNode(0, "node2")
+	failed.Flags = []Flag{Slave, Fail}
+	nodes := []ClusterNode{failed, spreadNode(1, ""), spreadNode(2, ""), spreadNode(3, "node1")}
+	topology, err := ClusterTopology(nodes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[int]utils.PodRole{
+		1: {Role: utils.RoleMaster, Shard: 1, NodeID: "node1"},
+		2: {Role: utils.RoleMaster, Shard: 0, NodeID: "node2"},
+		3: {Role: utils.RoleReplica, Shard: 1, NodeID: "node3"},
+	}
+	if got := topology.PodRoles(); !maps.Equal(got, want) {
+		t.Errorf("PodRoles() = %v, want %v", got, want)
+	}
+}
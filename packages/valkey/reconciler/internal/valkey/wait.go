@@ -0,0 +1,341 @@
+package valkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/metrics"
+	"valkey/reconciler/internal/utils"
+)
+
+// WaitOptions control how a node is polled while waiting for it to converge. the interval between
+// polls starts at PollInterval and grows by Multiplier after every poll that didn't match, up to
+// MaxInterval. zero fields take the value from DefaultWaitOptions
+type WaitOptions struct {
+	PollInterval time.Duration
+	MaxInterval  time.Duration
+	Multiplier   float64       // 1 polls at a fixed interval
+	NodeTimeout  time.Duration // how long each node gets to converge. 0 waits until ctx is done
+}
+
+var DefaultWaitOptions = WaitOptions{
+	PollInterval: 200 * time.Millisecond,
+	MaxInterval:  5 * time.Second,
+	Multiplier:   2,
+}
+
+func (o WaitOptions) withDefaults() WaitOptions {
+	if o.PollInterval <= 0 {
+		o.PollInterval = DefaultWaitOptions.PollInterval
+	}
+	if o.MaxInterval <= 0 {
+		o.MaxInterval = DefaultWaitOptions.MaxInterval
+	}
+	if o.Multiplier < 1 {
+		o.Multiplier = DefaultWaitOptions.Multiplier
+	}
+	return o
+}
+
+func (o WaitOptions) nextInterval(interval time.Duration) time.Duration {
+	return min(time.Duration(float64(interval)*o.Multiplier), max(o.MaxInterval, o.PollInterval))
+}
+
+// poll calls check until it reports done. errors from check are retried since the node may just be
+// restarting or busy, the last one is returned together with ctx's error when time runs out
+func poll(ctx context.Context, options WaitOptions, check func(context.Context) (bool, error)) error {
+	options = options.withDefaults()
+	if options.NodeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.NodeTimeout)
+		defer cancel()
+	}
+
+	interval := options.PollInterval
+	var lastErr error
+	for {
+		done, err := check(ctx)
+		if err == nil && done {
+			return nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("%w (last error: %w)", ctx.Err(), lastErr)
+			}
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		interval = options.nextInterval(interval)
+	}
+}
+
+// WaitError is returned when a wait gives up. it lists every node that hadn't converged
+type WaitError struct {
+	Condition string
+	Nodes     map[string]error // address -> why the node hadn't converged
+}
+
+func (e *WaitError) Error() string {
+	addresses := slices.Sorted(maps.Keys(e.Nodes))
+	reasons := make([]string, len(addresses))
+	for i, address := range addresses {
+		reasons[i] = fmt.Sprintf("%s: %v", address, e.Nodes[address])
+	}
+	return fmt.Sprintf("%d nodes didn't converge on %s: %s", len(addresses), e.Condition, strings.Join(reasons, "; "))
+}
+
+// Unwrap lets errors.Is find context.DeadlineExceeded and friends
+func (e *WaitError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Nodes))
+	for _, address := range slices.Sorted(maps.Keys(e.Nodes)) {
+		errs = append(errs, e.Nodes[address])
+	}
+	return errs
+}
+
+// NodesPredicate is a condition on one node's view of the cluster (its CLUSTER NODES). the name is
+// only used in logs and errors
+type NodesPredicate struct {
+	Name  string
+	Match func(nodes []ClusterNode) bool
+}
+
+func nodesPredicate(name string, match func(node ClusterNode) bool) NodesPredicate {
+	return NodesPredicate{
+		Name:  name,
+		Match: func(nodes []ClusterNode) bool { return slices.ContainsFunc(nodes, match) },
+	}
+}
+
+// KnowsNode matches once the node knows about the node with the id
+func KnowsNode(id string) NodesPredicate {
+	return nodesPredicate(fmt.Sprintf("knows %s", id), func(node ClusterNode) bool {
+		return node.ID == id
+	})
+}
+
+// KnowsHostname matches once the node knows about a node announcing the hostname
+func KnowsHostname(hostname string) NodesPredicate {
+	return nodesPredicate(fmt.Sprintf("knows %s", hostname), func(node ClusterNode) bool {
+		return node.Hostname == hostname
+	})
+}
+
+// HostnameIsMaster matches once the node sees the node announcing the hostname as a master
+func HostnameIsMaster(hostname string) NodesPredicate {
+	return nodesPredicate(fmt.Sprintf("%s is a master", hostname), func(node ClusterNode) bool {
+		return node.Hostname == hostname && slices.Contains(node.Flags, Master)
+	})
+}
+
+// HostnameIsReplica matches once the node sees the node announcing the hostname as a replica of any master
+func HostnameIsReplica(hostname string) NodesPredicate {
+	return nodesPredicate(fmt.Sprintf("%s is a replica", hostname), func(node ClusterNode) bool {
+		return node.Hostname == hostname && slices.Contains(node.Flags, Slave)
+	})
+}
+
+// HostnameIsReplicaOf matches once the node sees the node announcing the hostname as a replica of masterID
+func HostnameIsReplicaOf(hostname, masterID string) NodesPredicate {
+	return nodesPredicate(fmt.Sprintf("%s is a replica of %s", hostname, masterID), func(node ClusterNode) bool {
+		return node.Hostname == hostname && slices.Contains(node.Flags, Slave) && node.Master == masterID
+	})
+}
+
+// MyselfIsMaster matches once the node considers itself a master
+var MyselfIsMaster = nodesPredicate("myself is a master", func(node ClusterNode) bool {
+	return slices.Contains(node.Flags, Myself) && slices.Contains(node.Flags, Master)
+})
+
+// TopologyMatches builds the node's view into a Topology first. a view that isn't a valid topology
+// (ie. a replica of a master the node doesn't know yet) doesn't match
+func TopologyMatches(name string, match func(Topology) bool) NodesPredicate {
+	return NodesPredicate{
+		Name: name,
+		Match: func(nodes []ClusterNode) bool {
+			topology, err := ClusterTopology(nodes)
+			return err == nil && match(topology)
+		},
+	}
+}
+
+// AllOf matches once every predicate matches the same view
+func AllOf(predicates ...NodesPredicate) NodesPredicate {
+	names := make([]string, len(predicates))
+	for i, predicate := range predicates {
+		names[i] = predicate.Name
+	}
+	return NodesPredicate{
+		Name: strings.Join(names, " and "),
+		Match: func(nodes []ClusterNode) bool {
+			for _, predicate := range predicates {
+				if !predicate.Match(nodes) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+func clientAddress(client *ValkeyClient) string {
+	return strings.Join(client.options.InitAddress, ",")
+}
+
+// WaitForNode polls the node's CLUSTER NODES until predicate matches
+func WaitForNode(ctx context.Context, client *ValkeyClient, predicate NodesPredicate, options WaitOptions) error {
+	logger := logging.FromContext(ctx)
+	logger.Debug("Waiting for the node's view of the cluster", "condition", predicate.Name)
+
+	err := poll(ctx, options, func(context.Context) (bool, error) {
+		nodes, err := ClusterNodes(client)
+		if err != nil {
+			// the connection may have gone stale while the node restarted
+			if refreshErr := client.Refresh(); refreshErr != nil {
+				logger.Warn("Refresh client failed, retrying", "error", refreshErr)
+			}
+			return false, err
+		}
+		return predicate.Match(nodes), nil
+	})
+	if err != nil {
+		return &WaitError{Condition: predicate.Name, Nodes: map[string]error{clientAddress(client): err}}
+	}
+
+	logger.Debug("Node's view of the cluster matches", "condition", predicate.Name)
+	return nil
+}
+
+// WaitForClusterInfo polls the node's CLUSTER INFO until predicate matches
+func WaitForClusterInfo(ctx context.Context, client *ValkeyClient, predicate ClusterInfoPredicate, options WaitOptions) error {
+	logger := logging.FromContext(ctx)
+	logger.Debug("Waiting for cluster to update info", "state", predicate.Name)
+
+	err := poll(ctx, options, func(context.Context) (bool, error) {
+		clusterInfo, err := GetClusterInfo(client)
+		if err != nil {
+			if refreshErr := client.Refresh(); refreshErr != nil {
+				logger.Warn("Refresh client failed, retrying", "error", refreshErr)
+			}
+			return false, err
+		}
+		return predicate.Match(clusterInfo), nil
+	})
+	if err != nil {
+		return &WaitError{Condition: predicate.Name, Nodes: map[string]error{clientAddress(client): err}}
+	}
+
+	logger.Debug("Cluster updated info", "state", predicate.Name)
+	return nil
+}
+
+// each node in the cluster needs to update its view via the bus. a node may not have the same data as
+// the rest of the cluster yet, which causes bugs when using a cluster client because it sends the
+// request to whichever node owns the slot. this waits for every node to match predicate
+//
+// NOTE: hostnames need port number
+func WaitForAllNodes(ctx context.Context, env utils.Env, hostnames []string, predicate NodesPredicate, options WaitOptions) (err error) {
+	startTime := time.Now()
+	defer metrics.ObserveWait("cluster_nodes", startTime, &err)
+
+	logger := logging.FromContext(ctx)
+	logger.Info("Waiting for every node's view of the cluster", "hostnames", hostnames, "condition", predicate.Name)
+
+	err = waitForAll(ctx, env, hostnames, predicate.Name, func(ctx context.Context, client *ValkeyClient) error {
+		return WaitForNode(ctx, client, predicate, options)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Every node's view of the cluster matches", "condition", predicate.Name, "duration", time.Since(startTime))
+	return nil
+}
+
+// WaitForAllNodesClusterInfo waits for the CLUSTER INFO of every node to match predicate
+//
+// NOTE: hostnames need port number
+func WaitForAllNodesClusterInfo(ctx context.Context, env utils.Env, hostnames []string, predicate ClusterInfoPredicate, options WaitOptions) (err error) {
+	startTime := time.Now()
+	defer metrics.ObserveWait("cluster_info", startTime, &err)
+
+	logger := logging.FromContext(ctx)
+	logger.Info("Waiting for cluster info state to be consistent across all nodes", "hostnames", hostnames, "state", predicate.Name)
+
+	err = waitForAll(ctx, env, hostnames, predicate.Name, func(ctx context.Context, client *ValkeyClient) error {
+		return WaitForClusterInfo(ctx, client, predicate, options)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("All nodes are consistent and are in the desired cluster info state", "state", predicate.Name, "duration", time.Since(startTime))
+	return nil
+}
+
+// WaitForEntireCluster runs WaitForAllNodes against every pod behind the headless service, whether or
+// not it has joined the cluster yet
+func WaitForEntireCluster(ctx context.Context, env utils.Env, predicate NodesPredicate, options WaitOptions) error {
+	clientHostnames, err := GetPodAddresses(ctx, env)
+	if err != nil {
+		return err
+	}
+	return WaitForAllNodes(ctx, env, clientHostnames, predicate, options)
+}
+
+// runs wait against up to 10 nodes at a time. unlike a single node it doesn't give up on the first node
+// that fails so the error can name every node that hadn't converged
+func waitForAll(ctx context.Context, env utils.Env, hostnames []string, condition string, wait func(context.Context, *ValkeyClient) error) error {
+	type result struct {
+		hostname string
+		err      error
+	}
+
+	semaphore := make(chan struct{}, 10)
+	results := make(chan result, len(hostnames))
+	for _, hostname := range hostnames {
+		semaphore <- struct{}{}
+
+		go func(hostname string) {
+			defer func() { <-semaphore }()
+
+			nodeClient, err := NewNodeClient(ReconcilerAuth(env), hostname)
+			if err != nil {
+				results <- result{hostname, err}
+				return
+			}
+			defer nodeClient.Close()
+
+			results <- result{hostname, wait(logging.With(ctx, "hostname", hostname), nodeClient)}
+		}(hostname)
+	}
+
+	pending := map[string]error{}
+	for range hostnames {
+		result := <-results
+		if result.err == nil {
+			continue
+		}
+		// unwrap the single node errors so the nodes are listed once
+		var waitErr *WaitError
+		if errors.As(result.err, &waitErr) {
+			maps.Copy(pending, waitErr.Nodes)
+		} else {
+			pending[result.hostname] = result.err
+		}
+	}
+	if len(pending) > 0 {
+		return &WaitError{Condition: condition, Nodes: pending}
+	}
+	return nil
+}
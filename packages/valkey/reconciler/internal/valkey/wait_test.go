@@ -0,0 +1,137 @@
+package valkey
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNodesPredicates(t *testing.T) {
+	// node1 is a replica of node0, node2 a master that has been told it is node1's master
+	myself := spreadNode(0, "")
+	myself.Flags = []Flag{Myself, Master}
+	replica := spreadNode(1, "node0")
+	replica.Flags = []Flag{Slave}
+	master := spreadNode(2, "")
+	master.Flags = []Flag{Master}
+	nodes := []ClusterNode{myself, replica, master}
+	hostname := func(index int) string { return spreadNode(index, "").Hostname }
+
+	tests := []struct {
+		name      string
+		predicate NodesPredicate
+		want      bool
+	}{
+		{name: "knows node", predicate: KnowsNode("node2"), want: true},
+		{name: "doesn't know node", predicate: KnowsNode("node3")},
+		{name: "knows hostname", predicate: KnowsHostname(hostname(1)), want: true},
+		{name: "doesn't know hostname", predicate: KnowsHostname(hostname(3))},
+		{name: "myself flag isn't in the way", predicate: HostnameIsMaster(hostname(0)), want: true},
+		{name: "replica isn't a master", predicate: HostnameIsMaster(hostname(1))},
+		{name: "replica", predicate: HostnameIsReplica(hostname(1)), want: true},
+		{name: "replica of its master", predicate: HostnameIsReplicaOf(hostname(1), "node0"), want: true},
+		{name: "replica of another master", predicate: HostnameIsReplicaOf(hostname(1), "node2")},
+		{name: "myself is a master", predicate: MyselfIsMaster, want: true},
+		{name: "all of", predicate: AllOf(KnowsNode("node2"), HostnameIsReplicaOf(hostname(1), "node0")), want: true},
+		{name: "not all of", predicate: AllOf(KnowsNode("node2"), KnowsNode("node3"))},
+		{
+			name: "topology",
+			predicate: TopologyMatches("two masters", func(topology Topology) bool {
+				return len(topology.Masters) == 2
+			}),
+			want: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.predicate.Match(nodes); got != test.want {
+				t.Errorf("%s = %v, want %v", test.predicate.Name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestWaitOptionsBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		options WaitOptions
+		want    []time.Duration
+	}{
+		{
+			name: "defaults",
+			want: []time.Duration{200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, 1600 * time.Millisecond, 3200 * time.Millisecond, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name:    "fixed interval",
+			options: WaitOptions{PollInterval: 2 * time.Second, Multiplier: 1},
+			want:    []time.Duration{2 * time.Second, 2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:    "max below the first interval",
+			options: WaitOptions{PollInterval: 10 * time.Second},
+			want:    []time.Duration{10 * time.Second, 10 * time.Second},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := test.options.withDefaults()
+			interval := options.PollInterval
+			for i, want := range test.want {
+				if interval != want {
+					t.Fatalf("interval %d = %s, want %s", i, interval, want)
+				}
+				interval = options.nextInterval(interval)
+			}
+		})
+	}
+}
+
+func TestPoll(t *testing.T) {
+	options := WaitOptions{PollInterval: time.Millisecond, MaxInterval: time.Millisecond}
+	errRefused := errors.New("connection refused")
+
+	t.Run("converges", func(t *testing.T) {
+		calls := 0
+		err := poll(context.Background(), options, func(context.Context) (bool, error) {
+			calls++
+			if calls == 1 {
+				return false, errRefused
+			}
+			return calls == 3, nil
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("poll() = %v after %d calls, want nil after 3", err, calls)
+		}
+	})
+
+	t.Run("node timeout", func(t *testing.T) {
+		options := options
+		options.NodeTimeout = 20 * time.Millisecond
+		err := poll(context.Background(), options, func(context.Context) (bool, error) {
+			return false, errRefused
+		})
+		if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, errRefused) {
+			t.Errorf("poll() = %v, want the deadline and the last error", err)
+		}
+	})
+}
+
+func TestWaitError(t *testing.T) {
+	var err error = &WaitError{
+		Condition: "knows node0",
+		Nodes: map[string]error{
+			"valkey-test-2:6379": context.DeadlineExceeded,
+			"valkey-test-1:6379": context.DeadlineExceeded,
+		},
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("errors.Is(%v, context.DeadlineExceeded) = false", err)
+	}
+	want := "2 nodes didn't converge on knows node0: valkey-test-1:6379: context deadline exceeded; valkey-test-2:6379: context deadline exceeded"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
@@ -1,48 +1,223 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 	"valkey/reconciler/internal/commands"
+	"valkey/reconciler/internal/events"
+	"valkey/reconciler/internal/logging"
+	"valkey/reconciler/internal/metrics"
 	"valkey/reconciler/internal/utils"
+	"valkey/reconciler/internal/valkey"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "usage: valkey-reconciler <init|scale-up|scale-down>")
+		fmt.Fprintln(os.Stderr, "usage: valkey-reconciler <init|scale-up|scale-down|reconcile|plan|status|check|fix|failover|rotate-credentials|controller>")
 		os.Exit(2)
 	}
 
 	subcommand := os.Args[1]
+	args := os.Args[2:]
 
-	env, err := utils.Load()
+	switch subcommand {
+	case "init", "scale-up", "scale-down", "reconcile", "plan", "status", "check", "fix", "failover", "rotate-credentials", "controller":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", subcommand)
+		fmt.Fprintln(os.Stderr, "available commands: init, scale-up, scale-down, reconcile, plan, status, check, fix, failover, rotate-credentials, controller")
+		os.Exit(2)
+	}
+
+	planOptions := commands.PlanOptions{Command: subcommand}
+	if subcommand == "plan" {
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "usage: valkey-reconciler plan <scale-up|scale-down|reconcile> [--output text|json]")
+			os.Exit(2)
+		}
+		planOptions.Command, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the planned operations without changing the cluster (scale-up, scale-down, reconcile, fix and failover only)")
+	output := flags.String("output", string(commands.OutputText), "plan, status and check output format: text or json")
+	users := flags.String("users", "admin,client", "comma separated acl users to give new passwords (rotate-credentials only)")
+	failoverOptions := commands.FailoverCommandOptions{}
+	flags.StringVar(&failoverOptions.Shard, "shard", "", "node id or pod name of any node in the shard to fail over (failover only)")
+	flags.StringVar(&failoverOptions.Replica, "replica", "", "node id or pod name of the replica to promote. the one furthest along when empty (failover only)")
+	mode := flags.String("mode", string(valkey.FailoverDefault), "failover mode: default, force or takeover (failover only)")
+	flags.Int64Var(&failoverOptions.MaxLag, "max-lag", valkey.DefaultMaxFailoverLag, "bytes the replica may be behind the master (failover only)")
+	flags.BoolVar(&failoverOptions.Unsafe, "unsafe", false, "fail over even when the replica is behind or the mode doesn't fit (failover only)")
+	if err := flags.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+	planOptions.Output = commands.OutputFormat(*output)
+	failoverMode, err := valkey.ParseFailoverMode(*mode)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+	failoverOptions.Mode, failoverOptions.DryRun = failoverMode, *dryRun
+	if *dryRun && subcommand != "scale-up" && subcommand != "scale-down" && subcommand != "reconcile" && subcommand != "fix" && subcommand != "failover" {
+		fmt.Fprintf(os.Stderr, "--dry-run is not supported by %s\n", subcommand)
+		os.Exit(2)
+	}
+
+	// logs go to stderr so plan output on stdout stays parseable
+	logger, err := logging.New(os.Stderr, os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	env, err := utils.Load()
+	if err != nil {
+		logger.Error("Invalid configuration", "error", err)
 		os.Exit(1)
 	}
 
-	switch subcommand {
-	case "scale-up":
-		if err := commands.ScaleUp(env); err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = logging.WithLogger(ctx, logger.With("cluster", env.ClusterName, "namespace", env.Namespace))
+	logger = logging.FromContext(ctx)
+
+	// the controller re-reads the spec on every pass
+	if env.SpecSource == utils.SpecFromResource && subcommand != "controller" {
+		dynamicClient, err := utils.NewDynamicClient()
+		if err != nil {
+			logger.Error("Failed to create kubernetes client", "error", err)
 			os.Exit(1)
 		}
+		env, err = utils.ApplyValkeyClusterSpec(ctx, dynamicClient, env)
+		if err != nil {
+			logger.Error("Failed to read the ValkeyCluster spec", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	clientset, err := utils.NewKubernetesClient()
+	if err != nil {
+		logger.Error("Failed to create kubernetes client", "error", err)
+		os.Exit(1)
+	}
 
-	case "scale-down":
-		if err := commands.ScaleDown(env); err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
+	// rotate-credentials may have changed the reconciler's password since the pod started. commands exec'd
+	// into the controller pod would otherwise fail the permission check below with the old one
+	if password, err := utils.CurrentPassword(ctx, clientset, env); err != nil {
+		logger.Warn("Failed to read the reconciler password from the secret. Using the one from the environment", "error", err)
+	} else if password != "" {
+		env.Password = password
+	}
+
+	// a misconfigured acl user is reported up front instead of half way through an operation
+	if err := commands.VerifyPermissions(ctx, env); err != nil {
+		logger.Error("Reconciler acl user can't run the commands it needs", "username", env.Username, "error", err)
+		os.Exit(1)
+	}
+
+	// planning never touches the cluster so there is no operation to record
+	if subcommand == "fix" && *dryRun {
+		if err := commands.Fix(ctx, env, true); err != nil {
+			logger.Error("Failed to plan fix", "error", err)
 			os.Exit(1)
 		}
+		return
+	}
+	if subcommand == "failover" && *dryRun {
+		if err := commands.ManualFailover(ctx, env, failoverOptions); err != nil {
+			logger.Error("Failed to check failover", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	case "init":
-		if err := commands.Init(env); err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
+	if subcommand == "plan" || *dryRun {
+		if err := commands.Plan(ctx, env, planOptions); err != nil {
+			logger.Error("Failed to plan", "error", err)
 			os.Exit(1)
 		}
+		return
+	}
 
-	default:
-		fmt.Fprintf(os.Stderr, "unknown command: %s\n", subcommand)
-		fmt.Fprintln(os.Stderr, "available commands: init, scale-up, scale-down")
-		os.Exit(2)
+	if subcommand == "status" {
+		if err := commands.Status(ctx, env, planOptions.Output); err != nil {
+			logger.Error("Failed to get cluster status", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if subcommand == "check" {
+		if err := commands.Check(ctx, env, planOptions.Output); err != nil {
+			logger.Error("Cluster check failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if subcommand == "controller" {
+		// the controller takes the lock on every pass that changes the cluster
+		if err := commands.Controller(ctx, env); err != nil {
+			logger.Error("Controller failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	recorder := commands.NewEventRecorder(ctx, clientset, env)
+	ctx = events.WithRecorder(ctx, recorder)
+
+	startTime := time.Now()
+	started := false
+	err = utils.WithLock(ctx, clientset, env, func(ctx context.Context) error {
+		started = true
+		switch subcommand {
+		case "scale-up":
+			return commands.ScaleUp(ctx, env)
+		case "scale-down":
+			return commands.ScaleDown(ctx, env)
+		case "reconcile":
+			_, err := commands.Reconcile(ctx, clientset, env)
+			return err
+		case "fix":
+			return commands.Fix(ctx, env, false)
+		case "failover":
+			return commands.ManualFailover(ctx, env, failoverOptions)
+		case "rotate-credentials":
+			return commands.RotateCredentials(ctx, clientset, env, strings.Split(*users, ","))
+		default:
+			return commands.Init(ctx, env)
+		}
+	})
+
+	if statusErr := commands.RecordStatus(ctx, env, commands.NewOperation(subcommand, startTime, err)); statusErr != nil {
+		logger.Warn("Failed to record status", "error", statusErr)
+	}
+	if labelErr := commands.SyncPodLabels(ctx, clientset, env); labelErr != nil {
+		logger.Warn("Failed to update pod role labels", "error", labelErr)
+	}
+	// nothing would be around to scrape a job that is about to exit
+	if env.PushgatewayURL != "" {
+		pushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		if pushErr := metrics.Push(pushCtx, env.PushgatewayURL, subcommand, env.ClusterName, env.Namespace); pushErr != nil {
+			logger.Warn("Failed to push metrics", "error", pushErr)
+		}
+		cancel()
+	}
+	recorder.Shutdown(10 * time.Second)
+	if err != nil {
+		// the commands log their own failures
+		if !started {
+			logger.Error("Failed to acquire lock", "error", err)
+		}
+		os.Exit(1)
 	}
 }
@@ -115,6 +115,10 @@ declare module "sst" {
       "type": "sst.sst.Secret"
       "value": string
     }
+    "MainMainValkeyReconcilerPassword": {
+      "type": "sst.sst.Secret"
+      "value": string
+    }
     "MichellePhoneNumber": {
       "type": "sst.sst.Secret"
       "value": string